@@ -0,0 +1,438 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Prior is the prior distribution of a model parameter
+type Prior struct {
+	Name    string
+	Sample  func(r *rand.Rand) float64
+	Density func(x float64) float64 // zero outside of the support
+	Integer bool                    // the parameter is passed as int
+}
+
+// UniformPrior is uniform on [min,max]
+func UniformPrior(name string, min, max float64) Prior {
+	return Prior{
+		Name:   name,
+		Sample: func(r *rand.Rand) float64 { return min + r.Float64()*(max-min) },
+		Density: func(x float64) float64 {
+			if x < min || x > max {
+				return 0
+			}
+			return 1 / (max - min)
+		},
+	}
+}
+
+// UniformIntPrior is uniform on the integers min to max
+func UniformIntPrior(name string, min, max int) Prior {
+	return Prior{
+		Name:   name,
+		Sample: func(r *rand.Rand) float64 { return float64(min + r.Intn(max-min+1)) },
+		Density: func(x float64) float64 {
+			if x < float64(min) || x > float64(max) {
+				return 0
+			}
+			return 1 / float64(max-min+1)
+		},
+		Integer: true,
+	}
+}
+
+// NormalPrior is a normal distribution
+func NormalPrior(name string, mean, stddev float64) Prior {
+	return Prior{
+		Name:   name,
+		Sample: func(r *rand.Rand) float64 { return mean + r.NormFloat64()*stddev },
+		Density: func(x float64) float64 {
+			z := (x - mean) / stddev
+			return math.Exp(-z*z/2) / (stddev * math.Sqrt(2*math.Pi))
+		},
+	}
+}
+
+// value converts a sampled value to the parameter value
+func (p Prior) value(x float64) interface{} {
+	if p.Integer {
+		return int(math.Floor(x + 0.5))
+	}
+	return x
+}
+
+// EuclideanDistance is the default distance of ABC
+func EuclideanDistance(sim, observed []float64) float64 {
+	var d float64
+	for i := range sim {
+		d += (sim[i] - observed[i]) * (sim[i] - observed[i])
+	}
+	return math.Sqrt(d)
+}
+
+// Particle is a parameter set accepted by ABC
+type Particle struct {
+	Params   ParamSet
+	Values   []float64 // the parameter values in the order of the priors
+	Seed     int64
+	Summary  []float64
+	Distance float64
+	Weight   float64 // normalised importance weight
+}
+
+// Posterior is the result of ABC
+type Posterior struct {
+	Names     []string
+	Particles []Particle
+	Epsilon   []float64 // tolerance of every generation
+	Runs      int       // number of simulations
+}
+
+// Samples returns the posterior samples of a parameter
+func (p *Posterior) Samples(name string) []float64 {
+	for i, n := range p.Names {
+		if n == name {
+			res := make([]float64, len(p.Particles))
+			for j, pt := range p.Particles {
+				res[j] = pt.Values[i]
+			}
+			return res
+		}
+	}
+	return nil
+}
+
+// Mean returns the weighted posterior mean of a parameter
+func (p *Posterior) Mean(name string) float64 {
+	var m float64
+	for j, v := range p.Samples(name) {
+		m += p.Particles[j].Weight * v
+	}
+	return m
+}
+
+// ABC calibrates a model with approximate Bayesian computation: parameter
+// sets are drawn from the priors, the simulation returned by Build is run
+// for Steps steps, until Until returns true or a condition of Stop is
+// met, and the parameter set is accepted if the Distance between its
+// Summary statistics and Observed is at most the tolerance. The simulations run in parallel,
+// without outputs unless Outputs is set.
+type ABC struct {
+	Priors    []Prior
+	Build     func(p ParamSet, seed int64) (*Simulation, error)
+	Steps     int
+	Until     func(s *Simulation) bool
+	Stop      []StopCondition
+	Summary   func(s *Simulation) []float64
+	Observed  []float64
+	Distance  func(sim, observed []float64) float64 // EuclideanDistance if nil
+	Epsilon   float64                               // final tolerance
+	Particles int                                   // size of the posterior, 100 if 0
+	Seed      int64
+	Workers   int  // parallel runs, number of CPUs if 0
+	MaxRuns   int  // give up after this many proposals per generation, simulated or rejected by the priors, 1000 per particle if 0
+	Outputs   bool // keep the run directory and the catalogue entry of every simulation
+}
+
+func (a *ABC) particles() int {
+	if a.Particles <= 0 {
+		return 100
+	}
+	return a.Particles
+}
+
+// maxRuns is the number of proposals per generation before ABC gives up
+func (a *ABC) maxRuns(n int) int {
+	if a.MaxRuns > 0 {
+		return a.MaxRuns
+	}
+	return 1000 * n
+}
+
+func (a *ABC) distance(sim []float64) float64 {
+	if a.Distance != nil {
+		return a.Distance(sim, a.Observed)
+	}
+	return EuclideanDistance(sim, a.Observed)
+}
+
+func (a *ABC) names() []string {
+	names := make([]string, len(a.Priors))
+	for i, p := range a.Priors {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// fromPrior draws parameter values from the priors
+func (a *ABC) fromPrior(r *rand.Rand) []float64 {
+	x := make([]float64, len(a.Priors))
+	for i, p := range a.Priors {
+		x[i] = p.Sample(r)
+		if p.Integer {
+			x[i] = math.Floor(x[i] + 0.5)
+		}
+	}
+	return x
+}
+
+// priorDensity is the joint prior density of the values
+func (a *ABC) priorDensity(x []float64) float64 {
+	d := 1.0
+	for i, p := range a.Priors {
+		d *= p.Density(x[i])
+	}
+	return d
+}
+
+// simulate runs the model for the parameter values
+func (a *ABC) simulate(x []float64, seed int64) (Particle, error) {
+	p := make(ParamSet, len(a.Priors))
+	for i, pr := range a.Priors {
+		p[pr.Name] = pr.value(x[i])
+	}
+	build := a.Build
+	if !a.Outputs {
+		build = func(p ParamSet, seed int64) (*Simulation, error) {
+			sim, err := a.Build(p, seed)
+			if sim != nil {
+				sim.AbstInterface.NoOutput = true
+			}
+			return sim, err
+		}
+	}
+	sim, err := runBuilt(build, p, seed, stopConditions(a.Steps, a.Until, a.Stop))
+	if err != nil {
+		return Particle{}, err
+	}
+	summary := a.Summary(sim)
+	return Particle{Params: p, Values: x, Seed: seed, Summary: summary, Distance: a.distance(summary)}, nil
+}
+
+// generation simulates proposals in parallel until n of them are within
+// eps. Proposal i of the generation uses its own derived random source, so
+// the result does not depend on the number of workers. propose returns nil
+// for values which are rejected without simulation, they count as
+// proposals like the simulated ones. It returns the number of simulations
+// and an error if n particles are not accepted within the budget of
+// proposals.
+func (a *ABC) generation(gen, n int, eps float64, propose func(r *rand.Rand) []float64) ([]Particle, int, error) {
+	workers := a.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	chunk := n
+	if chunk < workers {
+		chunk = workers
+	}
+
+	budget := a.maxRuns(n)
+	var accepted []Particle
+	runs := 0
+	for next := 0; len(accepted) < n; next += chunk {
+		if next >= budget {
+			return nil, runs, fmt.Errorf("abc: only %d of %d particles accepted after %d proposals", len(accepted), n, next)
+		}
+		type proposal struct {
+			particle Particle
+			ok       bool
+			err      error
+		}
+		size := chunk
+		if size > budget-next {
+			size = budget - next
+		}
+		proposals := make([]proposal, size)
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					r := rand.New(rand.NewSource(DeriveSeed(a.Seed, gen, next+i)))
+					x := propose(r)
+					if x == nil {
+						continue
+					}
+					p, err := a.simulate(x, r.Int63())
+					proposals[i] = proposal{p, err == nil && p.Distance <= eps, err}
+				}
+			}()
+		}
+		for i := range proposals {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+
+		for _, p := range proposals {
+			if p.err != nil {
+				return nil, runs, p.err
+			}
+			if p.particle.Params != nil {
+				runs++
+			}
+			if p.ok && len(accepted) < n {
+				accepted = append(accepted, p.particle)
+			}
+		}
+	}
+	return accepted, runs, nil
+}
+
+// Rejection runs ABC rejection sampling with the tolerance Epsilon
+func (a *ABC) Rejection() (*Posterior, error) {
+	if err := a.check(); err != nil {
+		return nil, err
+	}
+	ps, runs, err := a.generation(0, a.particles(), a.Epsilon, a.fromPrior)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ps {
+		ps[i].Weight = 1 / float64(len(ps))
+	}
+	return &Posterior{Names: a.names(), Particles: ps, Epsilon: []float64{a.Epsilon}, Runs: runs}, nil
+}
+
+// SMC runs ABC sequential Monte Carlo (Beaumont et al. 2009). The first
+// generation is drawn from the priors, every following generation
+// perturbs the particles of the previous one with a gaussian kernel and
+// lowers the tolerance to the given quantile (0.5 if 0) of the previous
+// distances. It stops after the given number of generations or when the
+// tolerance reaches Epsilon.
+func (a *ABC) SMC(generations int, quantile float64) (*Posterior, error) {
+	if err := a.check(); err != nil {
+		return nil, err
+	}
+	if quantile <= 0 || quantile >= 1 {
+		quantile = 0.5
+	}
+	n := a.particles()
+	post := &Posterior{Names: a.names()}
+
+	eps := math.Inf(1)
+	ps, runs, err := a.generation(0, n, eps, a.fromPrior)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ps {
+		ps[i].Weight = 1 / float64(n)
+	}
+	post.Epsilon = append(post.Epsilon, eps)
+	post.Runs += runs
+
+	for gen := 1; gen < generations && eps > a.Epsilon; gen++ {
+		distances := make([]float64, len(ps))
+		for i, p := range ps {
+			distances[i] = p.Distance
+		}
+		sort.Float64s(distances)
+		eps = math.Max(distances[int(quantile*float64(len(distances)-1))], a.Epsilon)
+
+		prev := ps
+		sigma := a.kernelWidth(prev)
+		cumulative := make([]float64, len(prev))
+		var sum float64
+		for i, p := range prev {
+			sum += p.Weight
+			cumulative[i] = sum
+		}
+		propose := func(r *rand.Rand) []float64 {
+			j := sort.SearchFloat64s(cumulative, r.Float64()*sum)
+			if j >= len(prev) {
+				j = len(prev) - 1
+			}
+			x := make([]float64, len(a.Priors))
+			for i, pr := range a.Priors {
+				x[i] = prev[j].Values[i] + r.NormFloat64()*sigma[i]
+				if pr.Integer {
+					x[i] = math.Floor(x[i] + 0.5)
+				}
+			}
+			if a.priorDensity(x) == 0 {
+				return nil
+			}
+			return x
+		}
+
+		ps, runs, err = a.generation(gen, n, eps, propose)
+		post.Runs += runs
+		if err != nil {
+			return nil, err
+		}
+		var total float64
+		for i := range ps {
+			var k float64
+			for _, q := range prev {
+				k += q.Weight * kernelDensity(ps[i].Values, q.Values, sigma)
+			}
+			ps[i].Weight = a.priorDensity(ps[i].Values) / k
+			total += ps[i].Weight
+		}
+		for i := range ps {
+			ps[i].Weight /= total
+		}
+		post.Epsilon = append(post.Epsilon, eps)
+	}
+	post.Particles = ps
+	return post, nil
+}
+
+// kernelWidth is the standard deviation of the perturbation kernel: twice
+// the weighted variance of the particles
+func (a *ABC) kernelWidth(ps []Particle) []float64 {
+	sigma := make([]float64, len(a.Priors))
+	for i := range sigma {
+		var mean, v float64
+		for _, p := range ps {
+			mean += p.Weight * p.Values[i]
+		}
+		for _, p := range ps {
+			v += p.Weight * (p.Values[i] - mean) * (p.Values[i] - mean)
+		}
+		sigma[i] = math.Sqrt(2 * v)
+		if a.Priors[i].Integer && sigma[i] < 0.5 {
+			// keep moving integer parameters
+			sigma[i] = 0.5
+		}
+	}
+	return sigma
+}
+
+// kernelDensity is the density of the gaussian kernel centered at y at x,
+// without the constant factor which cancels in the weights
+func kernelDensity(x, y, sigma []float64) float64 {
+	d := 1.0
+	for i := range x {
+		if sigma[i] == 0 {
+			if x[i] != y[i] {
+				return 0
+			}
+			continue
+		}
+		z := (x[i] - y[i]) / sigma[i]
+		d *= math.Exp(-z*z/2) / sigma[i]
+	}
+	return d
+}
+
+func (a *ABC) check() error {
+	if a.Build == nil || a.Summary == nil {
+		return fmt.Errorf("abc: Build and Summary are required")
+	}
+	if len(a.Priors) == 0 {
+		return fmt.Errorf("abc: no priors")
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// total sums the counts of the agents of a testModel
+func total(s *Simulation) []float64 {
+	n := 0
+	for _, a := range *s.Landscape.GetAgents() {
+		n += a.(*testAgent).V
+	}
+	return []float64{float64(n)}
+}
+
+// testABC calibrates P of a testModel: 9 agents count up with
+// probability P for 20 steps, 54 counts are expected for P=0.3
+func testABC() *ABC {
+	return &ABC{
+		Priors:    []Prior{UniformPrior("P", 0, 1)},
+		Build:     buildTest,
+		Steps:     20,
+		Summary:   total,
+		Observed:  []float64{54},
+		Epsilon:   6,
+		Particles: 40,
+		Seed:      3,
+		Workers:   4,
+	}
+}
+
+func TestABCRejection(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		a := testABC()
+		post, err := a.Rejection()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(post.Particles) != a.Particles || post.Runs < a.Particles {
+			t.Errorf("%d particles after %d runs", len(post.Particles), post.Runs)
+		}
+		if m := post.Mean("P"); math.Abs(m-0.3) > 0.05 {
+			t.Errorf("posterior mean of P is %.3f, want 0.3", m)
+		}
+		for _, p := range post.Particles {
+			if p.Distance > a.Epsilon {
+				t.Errorf("accepted particle at distance %v", p.Distance)
+			}
+		}
+
+		// the result does not depend on the number of workers
+		a.Workers = 1
+		again, err := a.Rejection()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.Mean("P") != post.Mean("P") || again.Runs != post.Runs {
+			t.Errorf("1 worker: mean %v after %d runs, 4 workers: %v after %d", again.Mean("P"), again.Runs, post.Mean("P"), post.Runs)
+		}
+
+		// the runs write no outputs by default
+		if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) > 0 {
+			t.Errorf("the runs wrote %v", files)
+		}
+	})
+}
+
+func TestABCSMC(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		a := testABC()
+		a.Epsilon = 3
+		post, err := a.SMC(5, 0.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		eps := post.Epsilon
+		if len(eps) < 2 {
+			t.Fatalf("%d generations", len(eps))
+		}
+		for i := 1; i < len(eps); i++ {
+			if eps[i] > eps[i-1] {
+				t.Errorf("the tolerances %v do not decrease", eps)
+			}
+		}
+		for _, p := range post.Particles {
+			if p.Distance > eps[len(eps)-1] {
+				t.Errorf("particle at distance %v", p.Distance)
+			}
+		}
+		var sum float64
+		for _, p := range post.Particles {
+			sum += p.Weight
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("the weights sum to %v", sum)
+		}
+		if m := post.Mean("P"); math.Abs(m-0.3) > 0.05 {
+			t.Errorf("posterior mean of P is %.3f, want 0.3", m)
+		}
+	})
+}
+
+func TestABCBudget(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		tests := []struct {
+			name    string
+			maxRuns int
+			propose func(r *rand.Rand) []float64
+			runs    int // simulations until ABC gives up
+		}{
+			{"rejected by the priors", 50, func(r *rand.Rand) []float64 { return nil }, 0},
+			{"not accepted", 50, func(r *rand.Rand) []float64 { return []float64{r.Float64()} }, 50},
+			{"default budget", 0, func(r *rand.Rand) []float64 { return nil }, 0},
+		}
+		for _, tt := range tests {
+			a := testABC()
+			a.MaxRuns = tt.maxRuns
+			a.Observed = []float64{-100} // never reached
+			_, runs, err := a.generation(0, 5, a.Epsilon, tt.propose)
+			if err == nil || !strings.Contains(err.Error(), "proposals") {
+				t.Errorf("%s: got the error %v", tt.name, err)
+			}
+			if runs != tt.runs {
+				t.Errorf("%s: %d runs, want %d", tt.name, runs, tt.runs)
+			}
+		}
+	})
+}
+
+func TestABCOutputs(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		a := testABC()
+		a.Particles = 2
+		a.Epsilon = math.Inf(1)
+		a.Outputs = true
+		post, err := a.Rejection()
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs, _ := filepath.Glob(filepath.Join(dir, "goabm.*"))
+		if len(runs) != post.Runs {
+			t.Errorf("%d run dirs for %d runs", len(runs), post.Runs)
+		}
+		if _, err := os.Stat(filepath.Join(dir, CatalogFile)); err != nil {
+			t.Error(err)
+		}
+	})
+}
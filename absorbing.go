@@ -0,0 +1,122 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+// FrozenPairer is implemented by models which end in an absorbing state:
+// Frozen reports whether two neighbors can not interact with each other
+// as long as neither of them changes, e.g. agents which share all or none
+// of their traits in Axelrod's model
+type FrozenPairer interface {
+	Frozen(a, b Agenter) bool
+}
+
+// ActiveLinks tracks the number of links between neighbors which are not
+// frozen. A simulation whose model is a FrozenPairer and whose landscape
+// is a Neighborer without movement keeps it up to date: after an agent
+// acted only the links of that agent are examined again, an act which
+// changes other agents has to report them with Touch. Neighbors has to be
+// symmetric and list the agents the model interacts with.
+// In landscapes where agents move a count of zero is only absorbing if
+// all pairs of agents are frozen, not only the neighbors, so there are no
+// ActiveLinks and Absorbed compares all pairs.
+type ActiveLinks struct {
+	model  FrozenPairer
+	ls     Landscaper
+	nb     Neighborer
+	active map[AgentID]map[AgentID]bool
+	count  int
+}
+
+// NewActiveLinks examines all links of the landscape
+func NewActiveLinks(model FrozenPairer, ls Landscaper) *ActiveLinks {
+	nb, ok := ls.(Neighborer)
+	if !ok {
+		panic("absorbing state detection needs a landscape with Neighbors")
+	}
+	t := &ActiveLinks{model: model, ls: ls, nb: nb, active: make(map[AgentID]map[AgentID]bool)}
+	for _, a := range *ls.GetAgents() {
+		t.Touch(a.ID())
+	}
+	return t
+}
+
+// Count is the number of links which are not frozen
+func (t *ActiveLinks) Count() int {
+	return t.count
+}
+
+// Touch examines the links of an agent which changed again
+func (t *ActiveLinks) Touch(id AgentID) {
+	for n := range t.active[id] {
+		delete(t.active[n], id)
+		t.count--
+	}
+	delete(t.active, id)
+
+	a := t.ls.GetAgentById(id)
+	if a == nil {
+		// the agent was removed
+		return
+	}
+	for _, n := range t.nb.Neighbors(id) {
+		if n == id || t.active[id][n] {
+			continue
+		}
+		b := t.ls.GetAgentById(n)
+		if b == nil || t.model.Frozen(a, b) {
+			continue
+		}
+		t.link(id, n)
+		t.link(n, id)
+		t.count++
+	}
+}
+
+func (t *ActiveLinks) link(a, b AgentID) {
+	if t.active[a] == nil {
+		t.active[a] = make(map[AgentID]bool)
+	}
+	t.active[a][b] = true
+}
+
+// moves reports whether the agents of the landscape move, their neighbors
+// change without the model
+func moves(ls Landscaper) bool {
+	switch l := ls.(type) {
+	case *FixedLandscapeWithMovement, *FixedLandscapeWithMovement3D:
+		return true
+	case *MultiplexLandscape:
+		return moves(l.Base)
+	}
+	return false
+}
+
+// allFrozen reports whether every pair of agents is frozen
+func allFrozen(model FrozenPairer, agents []Agenter) bool {
+	for i, a := range agents {
+		for _, b := range agents[i+1:] {
+			if !model.Frozen(a, b) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Absorbed stops the run when no link is active any more, the model has
+// to be a FrozenPairer. In landscapes where agents move the run stops when
+// all pairs of agents are frozen.
+func Absorbed() StopCondition {
+	return stopFunc{name: "absorbed", done: func(s *Simulation) bool {
+		if s.Active != nil {
+			return s.Active.Count() == 0
+		}
+		fp, ok := s.Model.(FrozenPairer)
+		if !ok {
+			panic("the model does not implement FrozenPairer")
+		}
+		return allFrozen(fp, *s.Landscape.GetAgents())
+	}}
+}
@@ -0,0 +1,118 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// frozenModel is a testModel in which neighbors with the same count are
+// frozen
+type frozenModel struct {
+	testModel
+}
+
+func (m *frozenModel) Frozen(a, b Agenter) bool {
+	return a.(*testAgent).V == b.(*testAgent).V
+}
+
+// absorbing returns an initialized simulation of a frozenModel
+func absorbing(l Landscaper) *Simulation {
+	s := &Simulation{Landscape: l, Model: &frozenModel{}, Seed: 1}
+	s.AbstInterface.NoOutput = true
+	s.Init()
+	return s
+}
+
+func TestAbsorbed(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		s := absorbing(&FixedLandscapeNoMovement{Size: 3})
+		defer s.Stop()
+		absorbed := Absorbed()
+		if s.Active == nil || !absorbed.Done(s) {
+			t.Fatal("a frozen lattice is not absorbed")
+		}
+
+		// one agent differs from its four neighbors
+		a := s.Landscape.GetAgentById(4).(*testAgent)
+		a.V = 1
+		s.Active.Touch(a.ID())
+		if got := s.Active.Count(); got != 4 || absorbed.Done(s) {
+			t.Errorf("%d active links, want 4 and not absorbed", got)
+		}
+		a.V = 0
+		s.Active.Touch(a.ID())
+		if got := s.Active.Count(); got != 0 || !absorbed.Done(s) {
+			t.Errorf("%d active links, want 0 and absorbed", got)
+		}
+	})
+}
+
+func TestAbsorbedMoving(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		// agents which meet later are not frozen, so all pairs count
+		s := absorbing(&FixedLandscapeWithMovement{Size: 10, NAgents: 5, Sight: 1})
+		defer s.Stop()
+		absorbed := Absorbed()
+		if s.Active != nil {
+			t.Error("active links are tracked although agents move")
+		}
+		if !absorbed.Done(s) {
+			t.Error("equal agents are not absorbed")
+		}
+		(*s.Landscape.GetAgents())[0].(*testAgent).V = 1
+		if absorbed.Done(s) {
+			t.Error("an agent which differs from all others is absorbed")
+		}
+	})
+}
+
+func TestFLNMNeighbors(t *testing.T) {
+	for _, size := range []int{1, 2, 3, 4} {
+		l := &FixedLandscapeNoMovement{Size: size}
+		l.Init(&testModel{})
+		for i := range l.Agents {
+			a := &l.Agents[i]
+			if got := l.GetAgent(a.X, a.Y); got.ID() != a.ID() {
+				t.Errorf("size %d: agent at %d/%d is %d, want %d", size, a.X, a.Y, got.ID(), a.ID())
+			}
+			// outerbounds enter on the opposite side
+			if got := l.GetAgent(a.X+size, a.Y-size); got.ID() != a.ID() {
+				t.Errorf("size %d: agent at %d/%d is %d, want %d", size, a.X+size, a.Y-size, got.ID(), a.ID())
+			}
+		}
+
+		// the links of the dump are the neighbors, in both directions
+		links := make(map[AgentID][]AgentID)
+		for _, link := range l.Dump().Links {
+			links[link.Source] = append(links[link.Source], link.Target)
+		}
+		for i := range l.Agents {
+			id := AgentID(i)
+			got, want := links[id], l.Neighbors(id)
+			sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+			sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+			if len(want) != min(size-1, 2)*2 || !reflect.DeepEqual(got, want) {
+				t.Errorf("size %d: links of %d are %v, neighbors %v", size, id, got, want)
+			}
+			for _, n := range want {
+				if !contains(l.Neighbors(n), id) {
+					t.Errorf("size %d: %d is a neighbor of %d but not the other way round", size, n, id)
+				}
+			}
+		}
+	}
+}
+
+func contains(ids []AgentID, id AgentID) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -23,27 +23,41 @@ package goabm
 import (
 	"flag"
 	"fmt"
-	"math/rand"
+	"io/ioutil"
 	"os"
-	"time"
+	"path/filepath"
+	"strings"
 	"io"
 	"log"
 	"compress/gzip"
 )
 
+// the output settings, set by the flags of InitFlags or by a Config
 var JournaledSimulation bool
-var JournaledSimulationZip bool
+var JournaledSimulationZip = true
 var LogToFile bool
-var OutputDir string
-var RunID string
+var LogFormat = "csv"
+var SnapshotInterval int
+var OutputDir = "out"
+var RunID string // id of the next run, unique if empty
+var Catalogue = true
 
-// add some flags
+// add some flags to the command line, see InitFlags
 func Init() {
-	flag.BoolVar(&JournaledSimulation, "abst.journal", false, "log all simulation states (agent moves)")
-	flag.BoolVar(&JournaledSimulationZip, "abst.journal.zip", true, "zip the log")
-	flag.BoolVar(&LogToFile, "abst.logtofile", false, "log aggregated states to file in abst.out")
-	flag.StringVar(&OutputDir, "abst.out", "out", "output dir")
-	flag.StringVar(&RunID, "abst.runid", "", "id of the run, random if not provided")
+	InitFlags(flag.CommandLine)
+}
+
+// InitFlags adds the flags of the output settings to fs, so programs
+// with their own flag sets do not collide with the global one
+func InitFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&JournaledSimulation, "abst.journal", false, "log all simulation states (agent moves)")
+	fs.BoolVar(&JournaledSimulationZip, "abst.journal.zip", true, "zip the log")
+	fs.BoolVar(&LogToFile, "abst.logtofile", false, "log aggregated states to file in abst.out")
+	fs.StringVar(&LogFormat, "abst.logformat", "csv", "format of the log and snapshots: csv, tsv, jsonl or arrow (Arrow IPC)")
+	fs.IntVar(&SnapshotInterval, "abst.snapshot", 0, "write a snapshot of all agents to abst.out every n steps, never if 0")
+	fs.StringVar(&OutputDir, "abst.out", "out", "output dir")
+	fs.StringVar(&RunID, "abst.runid", "", "id of the run, unique if not provided")
+	fs.BoolVar(&Catalogue, "abst.catalog", true, "add every run to the results catalogue in abst.out")
 }
 
 func GetAbstPath() {
@@ -54,55 +68,97 @@ type Abst struct {
 	Log     *os.File
 	Journal *os.File
 	ZipJournal io.WriteCloser
+	RunID   string // id of the run, the RunID of the settings or a unique one if empty
+	NoOutput bool  // no run directory, log file, journal or catalogue entry, e.g. for calibration runs
+	RunDir  string
+	// paths of the outputs, empty if they are not written
+	LogPath      string
+	JournalPath  string
+	SnapshotPath string
+	out *OutputConfig // settings of the outputs, the global ones if nil
 }
 
-func (a *Abst) Init() {
-rand.Seed(int64(time.Now().Nanosecond()))
-	_, err := os.Stat(OutputDir)
-	if err != nil {
-		// create directory
-		err = os.Mkdir(OutputDir, 0700)
-		if err != nil {
-			panic(err)
-		}
+// output returns the output settings of the run
+func (a *Abst) output() OutputConfig {
+	if a.out != nil {
+		return *a.out
 	}
-	//if RunID == "" {
-		RunID = fmt.Sprintf("%d", rand.Int())
-		
-	//}
-	runDir := OutputDir + "/goabm." + RunID
-	err = os.Mkdir(runDir, 0700)
+	return globalOutput()
+}
+
+// createRunDir creates the directory of the run in the output dir. Without an
+// id the directory gets a unique name and its suffix is the id, so
+// parallel runs never collide.
+func (a *Abst) createRunDir() error {
+	out := a.output()
+	// parallel runs may create the output dir at the same time
+	if err := os.MkdirAll(out.Dir, 0700); err != nil {
+		return err
+	}
+	if a.RunID == "" {
+		a.RunID = out.RunID
+	}
+	if a.RunID == "" {
+		dir, err := ioutil.TempDir(out.Dir, "goabm.")
 		if err != nil {
-			panic(err)
+			return err
+		}
+		if err := os.Chmod(dir, 0700); err != nil {
+			return err
 		}
-		
+		a.RunDir = dir
+		a.RunID = strings.TrimPrefix(filepath.Base(dir), "goabm.")
+		return nil
+	}
+	a.RunDir = filepath.Join(out.Dir, "goabm."+a.RunID)
+	if err := os.Mkdir(a.RunDir, 0700); err != nil {
+		return fmt.Errorf("run %s: %v", a.RunID, err)
+	}
+	return nil
+}
+
+// Init creates the run directory and the output files
+func (a *Abst) Init() error {
+	if a.NoOutput {
+		a.Log = os.Stdout
+		return nil
+	}
+	if err := a.createRunDir(); err != nil {
+		return err
+	}
+	runDir := a.RunDir
+	out := a.output()
+
 	// create output streams
-	if LogToFile {
+	if out.LogToFile {
 		f, err := os.Create(runDir + "/log")
 		if err != nil {
-			panic(err)
+			return err
 		}
 		a.Log = f
+		a.LogPath = runDir + "/log"
 
 	} else {
 		// just use stdout
 		a.Log = os.Stdout
 
 	}
-	if JournaledSimulation {
+	if out.Journal {
 		// create journal file
 		f, err := os.Create(runDir + "/journal.gz")
 		if err != nil {
-			panic(err)
+			return err
 		}
 		a.Journal = f
+		a.JournalPath = runDir + "/journal.gz"
 		fmt.Println("Using journal: ",runDir + "/journal.gz")
 		a.ZipJournal = gzip.NewWriter(a.Journal)
 	}
+	return nil
 }
 
 func (a *Abst) Close() {
-if JournaledSimulation {
+if a.ZipJournal != nil {
  err := a.ZipJournal.Close()
  if err != nil {
     		log.Fatal(err)
@@ -0,0 +1,68 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// withOutputDir runs f with the outputs in a temporary directory
+func withOutputDir(t *testing.T, f func(dir string)) {
+	dir, out, id := t.TempDir(), OutputDir, RunID
+	OutputDir, RunID = dir, ""
+	defer func() { OutputDir, RunID = out, id }()
+	f(dir)
+}
+
+func TestAbstRunDir(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		// parallel runs without an id get their own directories
+		const n = 50
+		runs := make([]Abst, n)
+		var wg sync.WaitGroup
+		for i := range runs {
+			wg.Add(1)
+			go func(a *Abst) {
+				defer wg.Done()
+				if err := a.Init(); err != nil {
+					t.Error(err)
+				}
+			}(&runs[i])
+		}
+		wg.Wait()
+		seen := make(map[string]bool)
+		for _, a := range runs {
+			if a.RunID == "" || seen[a.RunID] {
+				t.Fatalf("run id %q is empty or used twice", a.RunID)
+			}
+			seen[a.RunID] = true
+			if want := filepath.Join(dir, "goabm."+a.RunID); a.RunDir != want {
+				t.Errorf("run dir is %s, want %s", a.RunDir, want)
+			}
+			if _, err := os.Stat(a.RunDir); err != nil {
+				t.Error(err)
+			}
+		}
+
+		// the id of the run, then the global one
+		a := &Abst{RunID: "mine"}
+		if err := a.Init(); err != nil || a.RunDir != filepath.Join(dir, "goabm.mine") {
+			t.Errorf("got %s %v, want the dir goabm.mine", a.RunDir, err)
+		}
+		RunID = "global"
+		a = &Abst{}
+		if err := a.Init(); err != nil || a.RunID != "global" {
+			t.Errorf("got the id %s %v, want global", a.RunID, err)
+		}
+
+		// an id can not be used twice
+		if err := (&Abst{RunID: "mine"}).Init(); err == nil {
+			t.Error("the run dir of mine was created twice")
+		}
+	})
+}
@@ -0,0 +1,379 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ParamSet is one combination of parameter values, by parameter name
+type ParamSet map[string]interface{}
+
+// Range is the set of values a parameter takes in a sweep, either an
+// explicit list of Values or Samples draws from the distribution Sample
+type Range struct {
+	Name    string
+	Values  []interface{}
+	Sample  func(r *rand.Rand) interface{}
+	Samples int
+}
+
+// Values sweeps a parameter over a list of values
+func Values(name string, values ...interface{}) Range {
+	return Range{Name: name, Values: values}
+}
+
+// IntRange sweeps an integer parameter from min to max (inclusive)
+func IntRange(name string, min, max, step int) Range {
+	if step <= 0 {
+		step = 1
+	}
+	r := Range{Name: name}
+	for v := min; v <= max; v += step {
+		r.Values = append(r.Values, v)
+	}
+	return r
+}
+
+// FloatRange sweeps a float parameter from min to max (inclusive)
+func FloatRange(name string, min, max, step float64) Range {
+	r := Range{Name: name}
+	if step <= 0 {
+		return Values(name, min)
+	}
+	for i := 0; ; i++ {
+		// avoid accumulating rounding errors
+		v := min + float64(i)*step
+		if v > max+step*1e-9 {
+			break
+		}
+		r.Values = append(r.Values, v)
+	}
+	return r
+}
+
+// Uniform draws n values of a float parameter uniformly from [min,max)
+func Uniform(name string, min, max float64, n int) Range {
+	return Range{Name: name, Samples: n, Sample: func(r *rand.Rand) interface{} {
+		return r.Float64()*(max-min) + min
+	}}
+}
+
+// UniformInt draws n values of an integer parameter uniformly from [min,max]
+func UniformInt(name string, min, max int, n int) Range {
+	return Range{Name: name, Samples: n, Sample: func(r *rand.Rand) interface{} {
+		return min + r.Intn(max-min+1)
+	}}
+}
+
+// Normal draws n values of a float parameter from a normal distribution
+func Normal(name string, mean, stddev float64, n int) Range {
+	return Range{Name: name, Samples: n, Sample: func(r *rand.Rand) interface{} {
+		return r.NormFloat64()*stddev + mean
+	}}
+}
+
+// DeriveSeed derives a well mixed seed for the run with the given indices
+// from a base seed (splitmix64), so replicates get distinct seeds which
+// can be reproduced
+func DeriveSeed(base int64, indices ...int) int64 {
+	z := uint64(base)
+	for _, i := range indices {
+		z += 0x9e3779b97f4a7c15 * uint64(i+1)
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		z = z ^ (z >> 31)
+	}
+	return int64(z >> 1)
+}
+
+// BatchResult is the outcome of one run of a batch
+type BatchResult struct {
+	Run         int // position in the batch
+	Combination int
+	Replicate   int
+	Seed        int64
+	Params      ParamSet
+	RunID       string
+	Dir         string
+	Stats       Statistics
+	StoppedBy   string
+	Values      map[string]interface{} // final values of the logged model fields and the reporters of the Collector
+	Err         error
+}
+
+// Batch runs a model for every combination of parameter values, with
+// Replicates runs per combination, in parallel.
+// Build has to return a new simulation for the parameters, the seed is
+// also used as Simulation.Seed. A run ends after Steps steps, when Until
+// returns true or when a condition of Stop is met. The results of all runs
+// are written to Output, each run has its own directory in OutputDir as
+// usual. A Design is saved next to the results, so the runs can be
+// reproduced with LoadDesign.
+type Batch struct {
+	Params     []Range
+	Samples    []ParamSet // explicit parameter sets, used instead of Params if set
+	Design     *Design    // design of experiments, used instead of Params and Samples if set
+	Replicates int        // runs per combination, 1 if 0
+	Seed       int64      // base seed of the derived seeds
+	Workers    int        // parallel runs, number of CPUs if 0
+	Build      func(p ParamSet, seed int64) (*Simulation, error)
+	Steps      int
+	Until      func(s *Simulation) bool
+	Stop       []StopCondition
+	Output     string // results table (.csv, .tsv, .jsonl, .arrow), OutputDir/batch.csv if empty
+}
+
+// Combinations returns all parameter sets of the batch: the cartesian
+// product of the ranges, distributions are sampled from the batch seed
+func (b *Batch) Combinations() []ParamSet {
+	if b.Design != nil {
+		return b.Design.Samples
+	}
+	if b.Samples != nil {
+		return b.Samples
+	}
+	r := rand.New(rand.NewSource(b.Seed))
+	sets := []ParamSet{{}}
+	for _, p := range b.Params {
+		values := p.Values
+		if p.Sample != nil {
+			values = make([]interface{}, p.Samples)
+			for i := range values {
+				values[i] = p.Sample(r)
+			}
+		}
+		var next []ParamSet
+		for _, set := range sets {
+			for _, v := range values {
+				n := make(ParamSet, len(set)+1)
+				for k, x := range set {
+					n[k] = x
+				}
+				n[p.Name] = v
+				next = append(next, n)
+			}
+		}
+		sets = next
+	}
+	return sets
+}
+
+// paramNames returns the parameter names in the order of the ranges
+func (b *Batch) paramNames(sets []ParamSet) []string {
+	var names []string
+	if b.Design != nil {
+		for _, d := range b.Design.Dimensions {
+			names = append(names, d.Name)
+		}
+		return names
+	}
+	if b.Samples == nil {
+		for _, p := range b.Params {
+			names = append(names, p.Name)
+		}
+		return names
+	}
+	seen := make(map[string]bool)
+	for _, s := range sets {
+		for k := range s {
+			if !seen[k] {
+				seen[k] = true
+				names = append(names, k)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runBuilt builds one simulation and runs it until one of the conditions
+// is met, panics of the model are returned as errors
+func runBuilt(build func(ParamSet, int64) (*Simulation, error), p ParamSet, seed int64, conds []StopCondition) (sim *Simulation, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	if len(conds) == 0 {
+		return nil, fmt.Errorf("no stop condition")
+	}
+	sim, err = build(p, seed)
+	if err != nil {
+		return nil, err
+	}
+	sim.Seed = seed
+	// the runs share a configured id, the seed tells them apart
+	out := sim.output()
+	if id := sim.AbstInterface.RunID; id != "" || out.RunID != "" {
+		if id == "" {
+			id = out.RunID
+		}
+		sim.AbstInterface.RunID = fmt.Sprintf("%s.%d", id, seed)
+	}
+	if !out.LogToFile || sim.AbstInterface.NoOutput {
+		// parallel runs would mix their logs on stdout
+		sim.Log.StdOut = false
+	}
+	sim.Run(conds...)
+	return sim, nil
+}
+
+// runSimulation runs one simulation of the batch until it stops
+func (b *Batch) runSimulation(res *BatchResult) {
+	sim, err := runBuilt(b.Build, res.Params, res.Seed, stopConditions(b.Steps, b.Until, b.Stop))
+	if err != nil {
+		res.Err = fmt.Errorf("run %d: %v", res.Run, err)
+		return
+	}
+
+	res.RunID = sim.AbstInterface.RunID
+	res.Dir = sim.AbstInterface.RunDir
+	res.Stats = sim.Stats
+	res.StoppedBy = sim.StoppedBy
+	res.Values = modelValues(sim.Model)
+	if sim.Collector != nil {
+		for k, v := range sim.Collector.ModelValues(sim.Model) {
+			res.Values[k] = v
+		}
+	}
+}
+
+// Run executes all runs and writes the results table
+func (b *Batch) Run() ([]BatchResult, error) {
+	if b.Build == nil {
+		return nil, fmt.Errorf("batch: no Build function")
+	}
+	replicates := b.Replicates
+	if replicates <= 0 {
+		replicates = 1
+	}
+	workers := b.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	sets := b.Combinations()
+	results := make([]BatchResult, 0, len(sets)*replicates)
+	for c, set := range sets {
+		for r := 0; r < replicates; r++ {
+			seed := DeriveSeed(b.Seed, c, r)
+			if b.Design != nil {
+				// the seeds of a design are stored with it
+				seed = DeriveSeed(b.Design.Seeds[c], r)
+			}
+			results = append(results, BatchResult{
+				Run:         len(results),
+				Combination: c,
+				Replicate:   r,
+				Seed:        seed,
+				Params:      set,
+			})
+		}
+	}
+	if b.Design != nil {
+		path := b.designPath()
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		if err := b.Design.Save(path); err != nil {
+			return nil, err
+		}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				b.runSimulation(&results[i])
+			}
+		}()
+	}
+	for i := range results {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, b.writeResults(sets, results)
+}
+
+// ResultsPath is the path Run writes the results table to, Output or
+// batch.csv in the output dir
+func (b *Batch) ResultsPath() string {
+	if b.Output == "" {
+		return filepath.Join(OutputDir, "batch.csv")
+	}
+	return b.Output
+}
+
+// designPath is the path the design is saved to, next to the results
+func (b *Batch) designPath() string {
+	path := b.ResultsPath()
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".design.json"
+}
+
+// writeResults writes one row per run: the run, its parameters, the
+// statistics and the final values of the model
+func (b *Batch) writeResults(sets []ParamSet, results []BatchResult) error {
+	sink, err := CreateSink(b.ResultsPath())
+	if err != nil {
+		return err
+	}
+
+	params := b.paramNames(sets)
+	valueSet := make(map[string]bool)
+	for _, r := range results {
+		for k := range r.Values {
+			valueSet[k] = true
+		}
+	}
+	var values []string
+	for k := range valueSet {
+		values = append(values, k)
+	}
+	sort.Strings(values)
+
+	columns := []string{"Run", "Combination", "Replicate", "Seed", "RunID"}
+	columns = append(columns, params...)
+	columns = append(columns, "Steps", "Events", "StoppedBy")
+	columns = append(columns, values...)
+	columns = append(columns, "Error")
+	if err := sink.WriteHeader(columns); err != nil {
+		sink.Close()
+		return err
+	}
+	for _, r := range results {
+		row := []interface{}{r.Run, r.Combination, r.Replicate, r.Seed, r.RunID}
+		for _, p := range params {
+			row = append(row, r.Params[p])
+		}
+		row = append(row, r.Stats.Steps, r.Stats.Events, r.StoppedBy)
+		for _, v := range values {
+			row = append(row, r.Values[v])
+		}
+		e := ""
+		if r.Err != nil {
+			e = r.Err.Error()
+		}
+		row = append(row, e)
+		if err := sink.WriteRow(row); err != nil {
+			sink.Close()
+			return err
+		}
+	}
+	return sink.Close()
+}
@@ -0,0 +1,81 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildTest returns a testModel simulation on a 3x3 grid
+func buildTest(p ParamSet, seed int64) (*Simulation, error) {
+	m := &testModel{}
+	if err := ApplyParams(m, p); err != nil {
+		return nil, err
+	}
+	return &Simulation{Landscape: &FixedLandscapeNoMovement{Size: 3}, Model: m}, nil
+}
+
+func TestBatchRunIDs(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		for _, id := range []string{"", "sweep"} {
+			b := &Batch{
+				Params:     []Range{{Name: "P", Values: []interface{}{0.1, 0.9}}},
+				Replicates: 3,
+				Seed:       1,
+				Steps:      2,
+				Build: func(p ParamSet, seed int64) (*Simulation, error) {
+					sim, err := buildTest(p, seed)
+					if sim != nil {
+						sim.AbstInterface.RunID = id
+					}
+					return sim, err
+				},
+			}
+			results, err := b.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen := make(map[string]bool)
+			for _, r := range results {
+				if r.Err != nil {
+					t.Fatal(r.Err)
+				}
+				if seen[r.RunID] || !strings.HasPrefix(r.RunID, id) {
+					t.Errorf("run %d: the id %q is used twice or does not start with %q", r.Run, r.RunID, id)
+				}
+				seen[r.RunID] = true
+			}
+		}
+	})
+}
+
+func TestBatchFailedRunArrow(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		// P=2 is greater than the maximum, the run fails and has no values
+		b := &Batch{
+			Params: []Range{{Name: "P", Values: []interface{}{2.0, 0.5}}},
+			Seed:   1,
+			Steps:  2,
+			Build:  buildTest,
+			Output: filepath.Join(dir, "batch.arrow"),
+		}
+		if _, err := b.Run(); err != nil {
+			t.Fatal(err)
+		}
+		tab, err := ReadTable(b.Output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total, errs := tab.Column("Total"), tab.Column("Error")
+		if len(total) != 2 || total[0] != nil || total[1] == nil {
+			t.Errorf("the totals are %v, want null for the failed run", total)
+		}
+		if len(errs) != 2 || !strings.Contains(errs[0].(string), "maximum") || errs[1] != "" {
+			t.Errorf("the errors are %q", errs)
+		}
+	})
+}
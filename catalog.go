@@ -0,0 +1,273 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CatalogFile is the name of the results catalogue in OutputDir
+const CatalogFile = "catalog.jsonl"
+
+// RunRecord describes one run in the results catalogue
+type RunRecord struct {
+	RunID     string                 `json:"run_id"`
+	Seed      int64                  `json:"seed"`
+	Params    map[string]interface{} `json:"params"` // model fields tagged `goabm:"param"`
+	Stats     Statistics             `json:"stats"`
+	StoppedBy string                 `json:"stopped_by,omitempty"`
+	Final     map[string]interface{} `json:"final"` // values of the logged model fields at the end of the run
+	Dir       string                 `json:"dir"`
+	Log       string                 `json:"log,omitempty"`
+	Journal   string                 `json:"journal,omitempty"`
+	Snapshots string                 `json:"snapshots,omitempty"`
+	Started   time.Time              `json:"started"`
+	Finished  time.Time              `json:"finished"`
+}
+
+// Value returns a final value of the run as a number, Steps and Events
+// are taken from the statistics
+func (r *RunRecord) Value(name string) (float64, bool) {
+	switch name {
+	case "Steps":
+		return float64(r.Stats.Steps), true
+	case "Events":
+		return float64(r.Stats.Events), true
+	}
+	if v, ok := r.Final[name]; ok {
+		return toFloat64(v)
+	}
+	return 0, false
+}
+
+// ModelParams returns the fields of the model tagged with `goabm:"param"`,
+// also those of embedded structs
+func ModelParams(model Modeler) map[string]interface{} {
+	params := make(map[string]interface{})
+	addParams(params, reflect.ValueOf(model).Elem())
+	return params
+}
+
+func addParams(params map[string]interface{}, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && !hasTagOption(f, "param") {
+			addParams(params, v.Field(i))
+			continue
+		}
+		if f.PkgPath == "" && hasTagOption(f, "param") {
+			params[f.Name] = v.Field(i).Interface()
+		}
+	}
+}
+
+// modelValues returns the last value of every logged model field
+func modelValues(model Modeler) map[string]interface{} {
+	values := make(map[string]interface{})
+	names, reporters := structReporters(model, nil)
+	for i := range names {
+		values[names[i]] = reporters[i](model)
+	}
+	return values
+}
+
+var catalogLock sync.Mutex
+
+// AppendRun adds a record to the catalogue in dir
+func AppendRun(dir string, r RunRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+	f, err := os.OpenFile(filepath.Join(dir, CatalogFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Catalog is the list of all runs in an output directory
+type Catalog struct {
+	Runs []RunRecord
+}
+
+// OpenCatalog reads the catalogue of the output directory dir
+func OpenCatalog(dir string) (*Catalog, error) {
+	f, err := os.Open(filepath.Join(dir, CatalogFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := &Catalog{}
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for s.Scan() {
+		line++
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+		var r RunRecord
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", CatalogFile, line, err)
+		}
+		c.Runs = append(c.Runs, r)
+	}
+	return c, s.Err()
+}
+
+// Run returns the run with the given id, nil if it does not exist
+func (c *Catalog) Run(id string) *RunRecord {
+	for i := range c.Runs {
+		if c.Runs[i].RunID == id {
+			return &c.Runs[i]
+		}
+	}
+	return nil
+}
+
+// Filter returns the runs for which match is true
+func (c *Catalog) Filter(match func(r *RunRecord) bool) *Catalog {
+	res := &Catalog{}
+	for i := range c.Runs {
+		if match(&c.Runs[i]) {
+			res.Runs = append(res.Runs, c.Runs[i])
+		}
+	}
+	return res
+}
+
+// sameValue compares a parameter read from the catalogue with a Go value,
+// numbers are compared by value since JSON turns them into float64
+func sameValue(a, b interface{}) bool {
+	fa, oka := toFloat64(a)
+	fb, okb := toFloat64(b)
+	if oka && okb {
+		return fa == fb
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// Where returns the runs whose parameter has the given value
+func (c *Catalog) Where(param string, value interface{}) *Catalog {
+	return c.Filter(func(r *RunRecord) bool {
+		v, ok := r.Params[param]
+		return ok && sameValue(v, value)
+	})
+}
+
+// Aggregate is a summary of a reporter over the replicates of one
+// parameter combination
+type Aggregate struct {
+	Params map[string]interface{}
+	N      int
+	Mean   float64
+	Std    float64 // sample standard deviation
+	Min    float64
+	Max    float64
+}
+
+// Aggregate summarises the final value of reporter over all runs which
+// share the values of the groupBy parameters, runs without the reporter
+// are left out. The groups are sorted by their parameter values.
+func (c *Catalog) Aggregate(reporter string, groupBy ...string) []Aggregate {
+	groups := make(map[string]*Aggregate)
+	values := make(map[string][]float64)
+	var keys []string
+	for i := range c.Runs {
+		r := &c.Runs[i]
+		v, ok := r.Value(reporter)
+		if !ok {
+			continue
+		}
+		params := make(map[string]interface{}, len(groupBy))
+		var key []string
+		for _, p := range groupBy {
+			params[p] = r.Params[p]
+			key = append(key, fmt.Sprint(r.Params[p]))
+		}
+		k := strings.Join(key, "\x00")
+		if _, ok := groups[k]; !ok {
+			groups[k] = &Aggregate{Params: params}
+			keys = append(keys, k)
+		}
+		values[k] = append(values[k], v)
+	}
+
+	// numbers are sorted by value, 2 before 10
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := groups[keys[i]].Params, groups[keys[j]].Params
+		for _, p := range groupBy {
+			if sameValue(a[p], b[p]) {
+				continue
+			}
+			fa, oka := toFloat64(a[p])
+			fb, okb := toFloat64(b[p])
+			if oka && okb {
+				return fa < fb
+			}
+			return fmt.Sprint(a[p]) < fmt.Sprint(b[p])
+		}
+		return false
+	})
+	res := make([]Aggregate, 0, len(keys))
+	for _, k := range keys {
+		a := groups[k]
+		vs := values[k]
+		a.N = len(vs)
+		a.Min, a.Max = math.Inf(1), math.Inf(-1)
+		for _, v := range vs {
+			a.Mean += v
+			a.Min = math.Min(a.Min, v)
+			a.Max = math.Max(a.Max, v)
+		}
+		a.Mean /= float64(a.N)
+		if a.N > 1 {
+			for _, v := range vs {
+				a.Std += (v - a.Mean) * (v - a.Mean)
+			}
+			a.Std = math.Sqrt(a.Std / float64(a.N-1))
+		}
+		res = append(res, *a)
+	}
+	return res
+}
+
+// record returns the catalogue entry of a finished simulation
+func (s *Simulation) record() RunRecord {
+	a := &s.AbstInterface
+	return RunRecord{
+		RunID:     a.RunID,
+		Seed:      s.Seed,
+		Params:    ModelParams(s.Model),
+		Stats:     s.Stats,
+		StoppedBy: s.StoppedBy,
+		Final:     modelValues(s.Model),
+		Dir:       a.RunDir,
+		Log:       a.LogPath,
+		Journal:   a.JournalPath,
+		Snapshots: a.SnapshotPath,
+		Started:   s.started,
+		Finished:  time.Now(),
+	}
+}
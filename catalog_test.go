@@ -0,0 +1,162 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModelParams(t *testing.T) {
+	m := &paramModel{Traits: 10, Rule: "random", Noise: 0.5, Media: true, Name: "x", Ignored: 3}
+	m.P = 0.25
+	want := map[string]interface{}{"P": 0.25, "Traits": 10, "Rule": "random", "Noise": 0.5, "Media": true, "Name": "x"}
+	if got := ModelParams(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCatalogRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	started := time.Date(2013, 5, 1, 12, 0, 0, 0, time.UTC)
+	runs := []RunRecord{
+		{RunID: "a", Seed: 1, Params: map[string]interface{}{"Traits": 10, "Rule": "random"}, Stats: Statistics{Steps: 5, Events: 45},
+			StoppedBy: "steps=5", Final: map[string]interface{}{"Cultures": 3}, Dir: "goabm.a", Started: started, Finished: started.Add(time.Second)},
+		{RunID: "b", Seed: 2, Params: map[string]interface{}{"Traits": 2, "Rule": "random"}, Final: map[string]interface{}{"Cultures": 1.5}},
+	}
+	for _, r := range runs {
+		if err := AppendRun(dir, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := OpenCatalog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Runs) != 2 {
+		t.Fatalf("%d runs, want 2", len(c.Runs))
+	}
+	// JSON numbers are float64
+	a := c.Run("a")
+	if a == nil || a.Seed != 1 || a.Stats != runs[0].Stats || a.StoppedBy != "steps=5" || a.Params["Traits"] != 10.0 ||
+		a.Final["Cultures"] != 3.0 || !a.Started.Equal(started) || !a.Finished.Equal(started.Add(time.Second)) {
+		t.Errorf("got %+v, want %+v", a, runs[0])
+	}
+	if c.Run("c") != nil {
+		t.Error("an unknown run is found")
+	}
+	for name, want := range map[string]float64{"Steps": 5, "Events": 45, "Cultures": 3} {
+		if v, ok := a.Value(name); !ok || v != want {
+			t.Errorf("%s is %v, want %v", name, v, want)
+		}
+	}
+	if _, ok := a.Value("Missing"); ok {
+		t.Error("a missing value is found")
+	}
+}
+
+func TestCatalogErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := OpenCatalog(dir); err == nil {
+		t.Error("a missing catalogue is opened")
+	}
+	text := `{"run_id": "a"}` + "\n\n" + `{"run_id": "b", "seed": "x"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, CatalogFile), []byte(text), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenCatalog(dir); err == nil || !strings.Contains(err.Error(), CatalogFile+":3") {
+		t.Errorf("got the error %v, want one in line 3", err)
+	}
+}
+
+// catalog returns runs of every combination of Traits and Rule, with
+// Cultures = Traits + replicate
+func catalog() *Catalog {
+	c := &Catalog{}
+	for _, traits := range []float64{10, 2, 3} {
+		for _, rule := range []string{"random", "impose"} {
+			for rep := 0; rep < 3; rep++ {
+				c.Runs = append(c.Runs, RunRecord{
+					Params: map[string]interface{}{"Traits": traits, "Rule": rule},
+					Final:  map[string]interface{}{"Cultures": traits + float64(rep)},
+				})
+			}
+		}
+	}
+	// a run without the reporter
+	c.Runs = append(c.Runs, RunRecord{Params: map[string]interface{}{"Traits": 2.0, "Rule": "random"}})
+	return c
+}
+
+func TestCatalogWhere(t *testing.T) {
+	c := catalog()
+	tests := []struct {
+		param string
+		value interface{}
+		n     int
+	}{
+		{"Traits", 2, 7},
+		{"Traits", 2.0, 7},
+		{"Traits", "3", 6},
+		{"Rule", "impose", 9},
+		{"Rule", "copy", 0},
+		{"Missing", 1, 0},
+	}
+	for _, tt := range tests {
+		if n := len(c.Where(tt.param, tt.value).Runs); n != tt.n {
+			t.Errorf("%s=%v: %d runs, want %d", tt.param, tt.value, n, tt.n)
+		}
+	}
+	if n := len(c.Where("Traits", 10).Where("Rule", "random").Runs); n != 3 {
+		t.Errorf("%d runs with Traits=10 and Rule=random, want 3", n)
+	}
+}
+
+func TestCatalogAggregate(t *testing.T) {
+	c := catalog()
+	aggs := c.Aggregate("Cultures", "Traits")
+	var traits []interface{}
+	for _, a := range aggs {
+		traits = append(traits, a.Params["Traits"])
+	}
+	// numbers are sorted by value
+	if want := []interface{}{2.0, 3.0, 10.0}; !reflect.DeepEqual(traits, want) {
+		t.Fatalf("groups %v, want %v", traits, want)
+	}
+	// Cultures is Traits, Traits+1 and Traits+2 in both rules
+	for _, a := range aggs {
+		x := a.Params["Traits"].(float64)
+		std := math.Sqrt(4.0 / 5)
+		if a.N != 6 || a.Mean != x+1 || a.Min != x || a.Max != x+2 || math.Abs(a.Std-std) > 1e-12 {
+			t.Errorf("Traits=%v: %+v", x, a)
+		}
+	}
+
+	aggs = c.Aggregate("Cultures", "Traits", "Rule")
+	var groups []string
+	for _, a := range aggs {
+		groups = append(groups, formatCell(a.Params["Traits"])+" "+a.Params["Rule"].(string))
+	}
+	want := []string{"2 impose", "2 random", "3 impose", "3 random", "10 impose", "10 random"}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("groups %v, want %v", groups, want)
+	}
+
+	// without groups all runs with the reporter are one group
+	if aggs := c.Aggregate("Cultures"); len(aggs) != 1 || aggs[0].N != 18 {
+		t.Errorf("got %+v", aggs)
+	}
+	if aggs := c.Aggregate("Missing", "Traits"); len(aggs) != 0 {
+		t.Errorf("got %+v for a missing reporter", aggs)
+	}
+	if aggs := c.Where("Traits", 10).Where("Rule", "random").Aggregate("Steps"); len(aggs) != 1 || aggs[0].Mean != 0 || aggs[0].Std != 0 {
+		t.Errorf("got %+v for the steps", aggs)
+	}
+}
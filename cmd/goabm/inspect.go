@@ -0,0 +1,371 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"goabm"
+)
+
+// errDiffer is returned by diff if the runs differ, like diff(1) it only
+// sets the exit status
+var errDiffer = errors.New("the runs differ")
+
+// params formats parameters as sorted name=value pairs
+func params(p map[string]interface{}) string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = fmt.Sprintf("%s=%v", name, p[name])
+	}
+	return strings.Join(names, " ")
+}
+
+// findRun returns a run of the catalogue in dir
+func findRun(dir, id string) (*goabm.RunRecord, error) {
+	c, err := goabm.OpenCatalog(dir)
+	if err != nil {
+		return nil, err
+	}
+	r := c.Run(id)
+	if r == nil {
+		return nil, fmt.Errorf("no run %s in %s", id, dir)
+	}
+	return r, nil
+}
+
+// where collects the -where flags of ls
+type where [][2]string
+
+func (w *where) String() string { return "" }
+
+func (w *where) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("%q is not name=value", s)
+	}
+	*w = append(*w, [2]string{s[:i], s[i+1:]})
+	return nil
+}
+
+func lsCmd(args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	dir := fs.String("dir", goabm.OutputDir, "output dir")
+	var filters where
+	fs.Var(&filters, "where", "only runs with the parameter value, name=value, repeatable")
+	fs.Parse(args)
+	c, err := goabm.OpenCatalog(*dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range filters {
+		c = c.Where(f[0], f[1])
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN\tSTARTED\tSTEPS\tSTOPPED BY\tPARAMS")
+	for _, r := range c.Runs {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", r.RunID, r.Started.Format("2006-01-02 15:04:05"), r.Stats.Steps, r.StoppedBy, params(r.Params))
+	}
+	return w.Flush()
+}
+
+func showCmd(args []string) error {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	dir := fs.String("dir", goabm.OutputDir, "output dir")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: goabm show [flags] <run>")
+	}
+	r, err := findRun(*dir, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	if r.Log == "" {
+		return nil
+	}
+	t, err := goabm.ReadTable(r.Log)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("log: %d rows, columns %s\n", t.Len(), strings.Join(t.Columns, ", "))
+	return nil
+}
+
+func journalCmd(args []string) error {
+	fs := flag.NewFlagSet("journal", flag.ExitOnError)
+	dir := fs.String("dir", goabm.OutputDir, "output dir, to find the journal of a run")
+	from := fs.Int("from", 1, "first step")
+	to := fs.Int("to", 0, "last step, the end if 0")
+	every := fs.Int("every", 1, "only every nth step")
+	output := fs.String("o", "", "write to the file instead of stdout: .jsonl keeps the steps, .csv, .tsv and .arrow are tables of the agents")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: goabm journal [flags] <journal|run>")
+	}
+	path := fs.Arg(0)
+	if _, err := os.Stat(path); err != nil {
+		r, err := findRun(*dir, path)
+		if err != nil {
+			return err
+		}
+		if r.Journal == "" {
+			return fmt.Errorf("run %s has no journal", r.RunID)
+		}
+		path = r.Journal
+	}
+	j, err := goabm.OpenJournal(path)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+
+	write, closeOut, err := journalOutput(*output)
+	if err != nil {
+		return err
+	}
+	for {
+		e, err := j.Next()
+		if err == io.EOF || (*to > 0 && e != nil && e.Step > *to) {
+			break
+		}
+		if err != nil {
+			closeOut()
+			return err
+		}
+		if e.Step < *from || (e.Step-*from)%*every != 0 {
+			continue
+		}
+		if err := write(e); err != nil {
+			closeOut()
+			return err
+		}
+	}
+	return closeOut()
+}
+
+// journalOutput returns the writer of the journal entries for the output
+// file, stdout if it is empty
+func journalOutput(path string) (func(e *goabm.JournalEntry) error, func() error, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if path == "" || ext == ".jsonl" || ext == ".json" {
+		out := os.Stdout
+		if path != "" {
+			f, err := os.Create(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			out = f
+		}
+		enc := json.NewEncoder(out)
+		closeOut := func() error {
+			if out != os.Stdout {
+				return out.Close()
+			}
+			return nil
+		}
+		return func(e *goabm.JournalEntry) error { return enc.Encode(e) }, closeOut, nil
+	}
+
+	// a table with a row per agent and step, the columns are the fields
+	// of the agents of the first step
+	sink, err := goabm.CreateSink(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var columns []string
+	write := func(e *goabm.JournalEntry) error {
+		if columns == nil {
+			seen := make(map[string]bool)
+			for _, n := range e.Nodes {
+				for k := range n {
+					if !seen[k] {
+						seen[k] = true
+						columns = append(columns, k)
+					}
+				}
+			}
+			sort.Strings(columns)
+			if err := sink.WriteHeader(append([]string{"Step", "Node"}, columns...)); err != nil {
+				return err
+			}
+		}
+		for i, n := range e.Nodes {
+			row := []interface{}{e.Step, i}
+			for _, c := range columns {
+				row = append(row, n[c])
+			}
+			if err := sink.WriteRow(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return write, sink.Close, nil
+}
+
+func diffCmd(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	dir := fs.String("dir", goabm.OutputDir, "output dir")
+	tolerance := fs.Float64("tolerance", 0, "numbers which differ by at most this are equal")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: goabm diff [flags] <run> <run>")
+	}
+	a, err := findRun(*dir, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := findRun(*dir, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	d := &differ{tolerance: *tolerance}
+	d.values("param", a.Params, b.Params)
+	d.value("seed", a.Seed, b.Seed)
+	d.value("steps", a.Stats.Steps, b.Stats.Steps)
+	d.value("events", a.Stats.Events, b.Stats.Events)
+	d.value("stopped by", a.StoppedBy, b.StoppedBy)
+	d.values("final", a.Final, b.Final)
+	if a.Log != "" && b.Log != "" {
+		ta, err := goabm.ReadTable(a.Log)
+		if err != nil {
+			return err
+		}
+		tb, err := goabm.ReadTable(b.Log)
+		if err != nil {
+			return err
+		}
+		d.tables(ta, tb)
+	} else if a.Log != "" || b.Log != "" {
+		fmt.Println("log: only one of the runs has a log")
+		d.n++
+	}
+	if d.n > 0 {
+		return errDiffer
+	}
+	return nil
+}
+
+// differ prints the differences of two runs, n counts them
+type differ struct {
+	tolerance float64
+	n         int
+}
+
+func (d *differ) equal(x, y interface{}) bool {
+	fx, okx := toFloat(x)
+	fy, oky := toFloat(y)
+	if okx && oky {
+		return math.Abs(fx-fy) <= d.tolerance
+	}
+	return fmt.Sprint(x) == fmt.Sprint(y)
+}
+
+func (d *differ) value(name string, x, y interface{}) {
+	if !d.equal(x, y) {
+		fmt.Printf("%s: %v != %v\n", name, x, y)
+		d.n++
+	}
+}
+
+func (d *differ) values(kind string, x, y map[string]interface{}) {
+	names := make(map[string]bool)
+	for k := range x {
+		names[k] = true
+	}
+	for k := range y {
+		names[k] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for k := range names {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		d.value(kind+" "+k, x[k], y[k])
+	}
+}
+
+// tables compares the logs column by column: the first row which differs
+// and the largest difference of numeric columns
+func (d *differ) tables(a, b *goabm.Table) {
+	if a.Len() != b.Len() {
+		fmt.Printf("log: %d != %d rows\n", a.Len(), b.Len())
+		d.n++
+	}
+	rows := a.Len()
+	if b.Len() < rows {
+		rows = b.Len()
+	}
+	for _, c := range a.Columns {
+		j := b.Index(c)
+		if j < 0 {
+			fmt.Printf("log: column %s only in the first run\n", c)
+			d.n++
+			continue
+		}
+		i := a.Index(c)
+		first, max := -1, 0.0
+		for r := 0; r < rows; r++ {
+			x, y := a.Rows[r][i], b.Rows[r][j]
+			if d.equal(x, y) {
+				continue
+			}
+			if first < 0 {
+				first = r
+			}
+			fx, okx := toFloat(x)
+			fy, oky := toFloat(y)
+			if okx && oky && math.Abs(fx-fy) > max {
+				max = math.Abs(fx - fy)
+			}
+		}
+		if first >= 0 {
+			fmt.Printf("log: column %s differs from row %d on", c, first+1)
+			if max > 0 {
+				fmt.Printf(", by at most %v", max)
+			}
+			fmt.Println()
+			d.n++
+		}
+	}
+	for _, c := range b.Columns {
+		if a.Index(c) < 0 {
+			fmt.Printf("log: column %s only in the second run\n", c)
+			d.n++
+		}
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case int64:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	}
+	return 0, false
+}
@@ -0,0 +1,154 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+
+// goabm runs registered models and inspects the results of their runs:
+//
+//	goabm run <model|config> [flags]       run a model once
+//	goabm sweep <model|config> [flags]     run a model over parameter ranges
+//	goabm journal [flags] <journal|run>    print, filter or convert a journal
+//	goabm ls [flags]                       list the runs in the output dir
+//	goabm show [flags] <run>               show a run
+//	goabm diff [flags] <run> <run>         compare two runs and their logs
+//	goabm models [flags] [model]           list the models or show one
+//
+// A config is a JSON, YAML or TOML file, see goabm.Config. Models are
+// registered by importing their package, the built in ones are the models
+// of goabm/models.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"goabm"
+	// the built in models
+	_ "goabm/models/axelrod"
+)
+
+type command struct {
+	run   func(args []string) error
+	usage string
+}
+
+var commands = map[string]command{
+	"run":     {runCmd, "run <model|config> [flags]: run a model once"},
+	"sweep":   {sweepCmd, "sweep <model|config> [flags]: run a model over parameter ranges"},
+	"journal": {journalCmd, "journal [flags] <journal|run>: print, filter or convert a journal"},
+	"ls":      {lsCmd, "ls [flags]: list the runs in the output dir"},
+	"show":    {showCmd, "show [flags] <run>: show a run"},
+	"diff":    {diffCmd, "diff [flags] <run> <run>: compare two runs and their logs"},
+	"models":  {modelsCmd, "models [flags] [model]: list the registered models or show the parameters of one"},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: goabm <command> [arguments], the commands are:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  "+commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "see goabm <command> -h for the flags")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		if os.Args[1] != "-h" && os.Args[1] != "help" {
+			fmt.Fprintf(os.Stderr, "goabm: unknown command %q\n", os.Args[1])
+		}
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		if err != errDiffer {
+			fmt.Fprintln(os.Stderr, "goabm:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func modelsCmd(args []string) error {
+	fs := flag.NewFlagSet("models", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the parameter schema as JSON")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for _, name := range goabm.Models() {
+			info, _ := goabm.LookupModel(name)
+			fmt.Fprintf(w, "%s\t%s\n", name, info.Description)
+		}
+		return w.Flush()
+	}
+
+	info, err := goabm.LookupModel(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	params, err := info.Schema()
+	if err != nil {
+		return err
+	}
+	if params == nil {
+		params = &goabm.Params{}
+	}
+	if *asJSON {
+		b, err := json.MarshalIndent(struct {
+			*goabm.ModelInfo
+			*goabm.Params
+		}{info, params}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	fmt.Println(info.Name)
+	if info.Description != "" {
+		fmt.Println(info.Description)
+	}
+	l := info.Landscape
+	switch l.Type {
+	case "flnm":
+		fmt.Printf("landscape: %s, size %d", l.Type, l.Size)
+	case "raster":
+		fmt.Printf("landscape: %s, %s", l.Type, l.Path)
+	default:
+		fmt.Printf("landscape: %s, size %d, %d agents, sight %v", l.Type, l.Size, l.Agents, l.Sight)
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PARAM\tFLAG\tTYPE\tDEFAULT\tRANGE\tDESCRIPTION")
+	for _, s := range params.Specs {
+		var r string
+		switch {
+		case len(s.Choices) > 0:
+			r = strings.Join(s.Choices, "|")
+		case s.HasMin || s.HasMax:
+			lo, hi := "", ""
+			if s.HasMin {
+				lo = fmt.Sprint(s.Min)
+			}
+			if s.HasMax {
+				hi = fmt.Sprint(s.Max)
+			}
+			r = "[" + lo + ", " + hi + "]"
+		}
+		fmt.Fprintf(w, "%s\t-%s\t%v\t%v\t%s\t%s\n", s.Name, s.Flag, s.Type, s.Default, r, s.Description)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,214 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"goabm"
+)
+
+// capture returns what f prints to stdout
+func capture(t *testing.T, f func() error) (string, error) {
+	tmp, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmp.Close()
+	stdout := os.Stdout
+	os.Stdout = tmp
+	err = f()
+	os.Stdout = stdout
+	b, rerr := os.ReadFile(tmp.Name())
+	if rerr != nil {
+		t.Fatal(rerr)
+	}
+	return string(b), err
+}
+
+// keepOutputs restores the output settings the commands change
+func keepOutputs(t *testing.T) {
+	dir, format, logToFile, journal, zip, snapshot, id, catalog := goabm.OutputDir, goabm.LogFormat, goabm.LogToFile,
+		goabm.JournaledSimulation, goabm.JournaledSimulationZip, goabm.SnapshotInterval, goabm.RunID, goabm.Catalogue
+	t.Cleanup(func() {
+		goabm.OutputDir, goabm.LogFormat, goabm.LogToFile, goabm.JournaledSimulation = dir, format, logToFile, journal
+		goabm.JournaledSimulationZip, goabm.SnapshotInterval, goabm.RunID, goabm.Catalogue = zip, snapshot, id, catalog
+	})
+}
+
+func TestRanges(t *testing.T) {
+	info, err := goabm.LookupModel("axelrod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := info.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		params *goabm.Params
+		flag   string
+		want   goabm.Range
+		err    string // part of the error, "" if there is none
+	}{
+		{schema, "Traits=2,5", goabm.Values("Traits", 2, 5), ""},
+		{schema, "traits=2:4", goabm.IntRange("Traits", 2, 4, 1), ""},
+		{schema, "traits=2:8:3", goabm.IntRange("Traits", 2, 8, 3), ""},
+		{schema, "noise=0:0.5:0.25", goabm.FloatRange("Noise", 0, 0.5, 0.25), ""},
+		{schema, "noise=0:1", goabm.FloatRange("Noise", 0, 1, 0.1), ""},
+		{schema, "rule=adopt,impose", goabm.Values("Rule", "adopt", "impose"), ""},
+		{schema, "metric=true,false", goabm.Values("Metric", true, false), ""},
+		{nil, "x=a,b", goabm.Values("x", "a", "b"), ""},
+		{nil, "x=1:2:0.5", goabm.FloatRange("x", 1, 2, 0.5), ""},
+		{schema, "traits", goabm.Range{}, "not name=values"},
+		{schema, "=1,2", goabm.Range{}, "not name=values"},
+		{schema, "colors=1,2", goabm.Range{}, "unknown parameter colors"},
+		{schema, "traits=a:5", goabm.Range{}, "not a number"},
+		{schema, "traits=5:1", goabm.Range{}, "invalid range"},
+		{schema, "noise=0:1:0", goabm.Range{}, "invalid range"},
+		{schema, "traits=1.5,2", goabm.Range{}, "not an integer"},
+		{schema, "noise=0.5,2", goabm.Range{}, "greater than the maximum"},
+		{schema, "rule=adopt,copy", goabm.Range{}, "not one of"},
+	}
+	for _, tt := range tests {
+		r := &ranges{params: tt.params}
+		err := r.Set(tt.flag)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got the error %v, want %q", tt.flag, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.flag, err)
+			continue
+		}
+		if len(r.list) != 1 || !reflect.DeepEqual(r.list[0], tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.flag, r.list, tt.want)
+		}
+	}
+}
+
+func TestRunAndInspect(t *testing.T) {
+	keepOutputs(t)
+	dir := t.TempDir()
+	run := func(id string, flags ...string) string {
+		args := append([]string{"axelrod", "-size", "3", "-steps", "5", "-seed", "1",
+			"-abst.out", dir, "-abst.runid", id, "-stdout", "-abst.logtofile", "-abst.journal"}, flags...)
+		out, err := capture(t, func() error { return runCmd(args) })
+		if err != nil {
+			t.Fatalf("run %s: %v", id, err)
+		}
+		return out
+	}
+	if out := run("a"); !strings.Contains(out, "run a: 5 steps, 45 events, stopped by steps=5, seed 1") {
+		t.Errorf("run: %s", out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "goabm.a", "config.json")); err != nil {
+		t.Error(err)
+	}
+	run("b", "-traits", "3")
+	run("c")
+
+	tests := []struct {
+		cmd  func(args []string) error
+		args []string
+		want []string // parts of the output, nil if there is none
+		err  error
+	}{
+		{lsCmd, []string{"-dir", dir}, []string{"a", "b", "c"}, nil},
+		{lsCmd, []string{"-dir", dir, "-where", "Traits=3"}, []string{"b"}, nil},
+		{showCmd, []string{"-dir", dir, "c"}, []string{`"run_id": "c"`, "log: 5 rows"}, nil},
+		{diffCmd, []string{"-dir", dir, "a", "c"}, nil, nil},
+		{diffCmd, []string{"-dir", dir, "a", "b"}, []string{"param Traits: 15 != 3"}, errDiffer},
+		{journalCmd, []string{"-dir", dir, "-from", "2", "-every", "2", "a"}, []string{`"step":2`, `"step":4`}, nil},
+		{modelsCmd, nil, []string{"axelrod", "axelrod-moving"}, nil},
+		{modelsCmd, []string{"axelrod"}, []string{"-traits"}, nil},
+	}
+	for _, tt := range tests {
+		out, err := capture(t, func() error { return tt.cmd(tt.args) })
+		if err != tt.err {
+			t.Errorf("%v: got the error %v, want %v", tt.args, err, tt.err)
+		}
+		for _, w := range tt.want {
+			if !strings.Contains(out, w) {
+				t.Errorf("%v: %q is not in the output\n%s", tt.args, w, out)
+			}
+		}
+		if tt.want == nil && out != "" {
+			t.Errorf("%v: unexpected output %s", tt.args, out)
+		}
+	}
+
+	// ls lists the filtered runs only
+	out, _ := capture(t, func() error { return lsCmd([]string{"-dir", dir, "-where", "Traits=3"}) })
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 {
+		t.Errorf("ls: %d lines, want the header and one run\n%s", len(lines), out)
+	}
+
+	// the journal as a table of the agents
+	table := filepath.Join(dir, "agents.csv")
+	if _, err := capture(t, func() error { return journalCmd([]string{"-dir", dir, "-o", table, "a"}) }); err != nil {
+		t.Fatal(err)
+	}
+	if tab, err := goabm.ReadTable(table); err != nil || tab.Len() != 5*9 {
+		t.Errorf("journal table: %v, %v", tab, err)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	keepOutputs(t)
+	for _, output := range []string{"", "sweep.tsv"} {
+		dir := t.TempDir()
+		args := []string{"axelrod", "-size", "3", "-steps", "2", "-seed", "1", "-abst.out", dir,
+			"-vary", "traits=2,3", "-vary", "noise=0:0.1:0.1", "-replicates", "2"}
+		want := filepath.Join(dir, "batch.csv")
+		if output != "" {
+			want = filepath.Join(dir, output)
+			args = append(args, "-o", want)
+		}
+		out, err := capture(t, func() error { return sweepCmd(args) })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, "8 runs of 4 combinations, 0 failed") || !strings.Contains(out, "results: "+want+"\n") {
+			t.Errorf("sweep: %s", out)
+		}
+		if tab, err := goabm.ReadTable(want); err != nil || tab.Len() != 8 {
+			t.Errorf("results: %v, %v", tab, err)
+		}
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	keepOutputs(t)
+	tests := []struct {
+		cmd  func(args []string) error
+		args []string
+		err  string
+	}{
+		{runCmd, nil, "usage"},
+		{runCmd, []string{"-steps", "1"}, "usage"},
+		{runCmd, []string{"nomodel"}, "unknown model"},
+		{runCmd, []string{"axelrod"}, "no stop condition"},
+		{runCmd, []string{"missing.yaml"}, "missing.yaml"},
+		{sweepCmd, []string{"axelrod", "-steps", "1", "extra"}, "unexpected arguments"},
+		{showCmd, []string{"-dir", t.TempDir()}, "usage"},
+		{showCmd, []string{"-dir", t.TempDir(), "x"}, "catalog"},
+		{diffCmd, []string{"-dir", t.TempDir(), "x"}, "usage"},
+		{journalCmd, nil, "usage"},
+		{modelsCmd, []string{"nomodel"}, "unknown model"},
+	}
+	for _, tt := range tests {
+		_, err := capture(t, func() error { return tt.cmd(tt.args) })
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%v: got the error %v, want %q", tt.args, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"goabm"
+)
+
+// model reads the first argument, a model name or a config file, and
+// returns the config, a constructor of the model with the parameters at
+// their defaults and the parameter schema (nil if the model has none)
+func model(arg string) (*goabm.Config, func() goabm.Modeler, *goabm.Params, error) {
+	var c *goabm.Config
+	switch strings.ToLower(filepath.Ext(arg)) {
+	case ".json", ".yaml", ".yml", ".toml":
+		var err error
+		if c, err = goabm.LoadConfig(arg); err != nil {
+			return nil, nil, nil, err
+		}
+		if c.Model == "" {
+			return nil, nil, nil, fmt.Errorf("%s does not name a model", arg)
+		}
+	}
+	name := arg
+	if c != nil {
+		name = c.Model
+	}
+	info, err := goabm.LookupModel(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if c == nil {
+		c = info.Config()
+	}
+	params, err := info.Schema()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// the model was checked when it was registered
+	newModel := func() goabm.Modeler {
+		m, _ := info.NewModel()
+		return m
+	}
+	return c, newModel, params, nil
+}
+
+// parse parses the flags after the first argument, which is returned
+func parse(fs *flag.FlagSet, args []string) (string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		// the flags depend on the model
+		return "", fmt.Errorf("usage: goabm %s <model|config> [flags], see goabm %s <model> -h for the flags", fs.Name(), fs.Name())
+	}
+	return args[0], nil
+}
+
+// stopFlags are the stop conditions besides -steps
+type stopFlags struct {
+	absorbed  bool
+	unchanged int
+	wallclock time.Duration
+}
+
+func (s *stopFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&s.absorbed, "absorbed", false, "stop when no agents can interact any more, the model has to support it")
+	fs.IntVar(&s.unchanged, "unchanged", 0, "stop when the model fields did not change for n steps")
+	fs.DurationVar(&s.wallclock, "wallclock", 0, "stop after this time")
+}
+
+func (s *stopFlags) conditions(c *goabm.Config) []goabm.StopCondition {
+	conds := c.StopConditions()
+	if s.absorbed {
+		conds = append(conds, goabm.Absorbed())
+	}
+	if s.unchanged > 0 {
+		conds = append(conds, goabm.Unchanged(s.unchanged))
+	}
+	if s.wallclock > 0 {
+		conds = append(conds, goabm.WallClock(s.wallclock))
+	}
+	return conds
+}
+
+// interrupted is canceled by ctrl-c, so runs end with complete outputs
+func interrupted() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt)
+	go func() {
+		select {
+		case <-ch:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(ch)
+		cancel()
+	}
+}
+
+func runCmd(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	arg, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	c, newModel, params, err := model(arg)
+	if err != nil {
+		return err
+	}
+	c.RegisterFlags(fs, params)
+	var stop stopFlags
+	stop.register(fs)
+	progress := fs.Bool("progress", false, "report the progress on stderr")
+	fs.Parse(args[1:])
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v, flags come after the model", fs.Args())
+	}
+	conds := stop.conditions(c)
+	if len(conds) == 0 {
+		return fmt.Errorf("no stop condition, use -steps, -absorbed, -unchanged or -wallclock")
+	}
+
+	sim, err := c.Simulation(newModel())
+	if err != nil {
+		return err
+	}
+	if *progress {
+		sim.ProgressInterval = time.Second
+		sim.OnProgress = func(p goabm.Progress) {
+			fmt.Fprintf(os.Stderr, "step %d, %v", p.Steps, p.Elapsed.Round(time.Millisecond))
+			if p.ETA > 0 {
+				fmt.Fprintf(os.Stderr, ", %.0f%%, %v left", 100*p.Fraction, p.ETA.Round(time.Second))
+			}
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+	sim.Init()
+	// the effective configuration reproduces the run
+	c.Seed = sim.Seed
+	c.Output.RunID = sim.AbstInterface.RunID
+	if err := c.Save(filepath.Join(sim.AbstInterface.RunDir, "config.json")); err != nil {
+		return err
+	}
+
+	ctx, cancel := interrupted()
+	defer cancel()
+	_, err = sim.RunContext(ctx, conds...)
+	fmt.Printf("run %s: %d steps, %d events, stopped by %s, seed %d\n",
+		sim.AbstInterface.RunID, sim.Stats.Steps, sim.Stats.Events, sim.StoppedBy, sim.Seed)
+	fmt.Println("output:", sim.AbstInterface.RunDir)
+	return err
+}
+
+// ranges collects the -vary flags of sweep
+type ranges struct {
+	params *goabm.Params
+	list   []goabm.Range
+}
+
+func (r *ranges) String() string { return "" }
+
+// Set parses name=a,b,c or name=min:max[:step]
+func (r *ranges) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("%q is not name=values", s)
+	}
+	name, values := s[:i], s[i+1:]
+	var spec *goabm.ParamSpec
+	if r.params != nil {
+		if spec = r.params.Spec(name); spec == nil {
+			return fmt.Errorf("unknown parameter %s", name)
+		}
+		name = spec.Name
+	}
+
+	if parts := strings.Split(values, ":"); len(parts) == 2 || len(parts) == 3 {
+		var bounds [3]float64
+		for j, p := range parts {
+			x, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a number", name, p)
+			}
+			bounds[j] = x
+		}
+		if len(parts) == 2 {
+			bounds[2] = (bounds[1] - bounds[0]) / 10
+			if spec != nil && spec.Type == goabm.IntParam {
+				bounds[2] = 1
+			}
+		}
+		if bounds[2] <= 0 || bounds[1] < bounds[0] {
+			return fmt.Errorf("%s: invalid range %s", name, values)
+		}
+		if spec != nil && spec.Type == goabm.IntParam {
+			r.list = append(r.list, goabm.IntRange(name, int(bounds[0]), int(bounds[1]), int(bounds[2])))
+		} else {
+			r.list = append(r.list, goabm.FloatRange(name, bounds[0], bounds[1], bounds[2]))
+		}
+		return nil
+	}
+
+	var list []interface{}
+	for _, v := range strings.Split(values, ",") {
+		var x interface{} = v
+		if spec != nil {
+			var err error
+			if x, err = spec.Convert(v); err != nil {
+				return err
+			}
+		}
+		list = append(list, x)
+	}
+	r.list = append(r.list, goabm.Values(name, list...))
+	return nil
+}
+
+func sweepCmd(args []string) error {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	arg, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	c, newModel, params, err := model(arg)
+	if err != nil {
+		return err
+	}
+	c.RegisterFlags(fs, params)
+	var stop stopFlags
+	stop.register(fs)
+	vary := &ranges{params: params}
+	fs.Var(vary, "vary", "vary a parameter, name=a,b,c or name=min:max[:step], repeatable")
+	replicates := fs.Int("replicates", 1, "runs per combination")
+	workers := fs.Int("workers", 0, "parallel runs, number of CPUs if 0")
+	output := fs.String("o", "", "results table (.csv, .tsv, .jsonl, .arrow), batch.csv in the output dir if empty")
+	fs.Parse(args[1:])
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v, flags come after the model", fs.Args())
+	}
+	conds := stop.conditions(c)
+	if len(conds) == 0 {
+		return fmt.Errorf("no stop condition, use -steps, -absorbed, -unchanged or -wallclock")
+	}
+
+	b := c.Batch(newModel, vary.list)
+	// the steps are part of the conditions
+	b.Steps = 0
+	b.Stop = conds
+	b.Replicates = *replicates
+	b.Workers = *workers
+	if *output != "" {
+		b.Output = *output
+	}
+	results, err := b.Run()
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			fmt.Fprintln(os.Stderr, r.Err)
+		}
+	}
+	fmt.Printf("%d runs of %d combinations, %d failed\n", len(results), len(b.Combinations()), failed)
+	fmt.Println("results:", b.ResultsPath())
+	return err
+}
@@ -0,0 +1,338 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ModelReporter computes a model level value, e.g. the number of cultures
+type ModelReporter func(model Modeler) interface{}
+
+// AgentReporter computes a value of a single agent
+type AgentReporter func(agent Agenter) interface{}
+
+// Sink receives the rows of a table while they are collected
+type Sink interface {
+	WriteHeader(columns []string) error
+	WriteRow(row []interface{}) error
+	Close() error
+}
+
+// Table is an in-memory table of collected values, one row per collection
+type Table struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// Len returns the number of rows
+func (t *Table) Len() int {
+	return len(t.Rows)
+}
+
+// Index returns the position of a column, -1 if it does not exist
+func (t *Table) Index(column string) int {
+	for i, c := range t.Columns {
+		if c == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// Column returns all values of a column
+func (t *Table) Column(column string) []interface{} {
+	i := t.Index(column)
+	if i < 0 {
+		return nil
+	}
+	values := make([]interface{}, len(t.Rows))
+	for r, row := range t.Rows {
+		values[r] = row[i]
+	}
+	return values
+}
+
+// Float64s returns a numeric column as floats, values which are not
+// numbers are skipped
+func (t *Table) Float64s(column string) []float64 {
+	var values []float64
+	for _, v := range t.Column(column) {
+		if f, ok := toFloat64(v); ok {
+			values = append(values, f)
+		}
+	}
+	return values
+}
+
+// Row returns a row as a map from column to value
+func (t *Table) Row(i int) map[string]interface{} {
+	row := make(map[string]interface{}, len(t.Columns))
+	for c, name := range t.Columns {
+		row[name] = t.Rows[i][c]
+	}
+	return row
+}
+
+// Last returns the most recent row, nil if the table is empty
+func (t *Table) Last() map[string]interface{} {
+	if len(t.Rows) == 0 {
+		return nil
+	}
+	return t.Row(len(t.Rows) - 1)
+}
+
+// Where returns a table with the rows for which match is true
+func (t *Table) Where(match func(row map[string]interface{}) bool) *Table {
+	res := &Table{Columns: t.Columns}
+	for i, row := range t.Rows {
+		if match(t.Row(i)) {
+			res.Rows = append(res.Rows, row)
+		}
+	}
+	return res
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.Bool:
+		if rv.Bool() {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// hasTagOption reports whether the goabm tag of a field contains option,
+// e.g. `goabm:"hide"`
+func hasTagOption(f reflect.StructField, option string) bool {
+	for _, o := range strings.Split(f.Tag.Get("goabm"), ",") {
+		if strings.TrimSpace(o) == option {
+			return true
+		}
+	}
+	return false
+}
+
+// DataCollector collects model and agent level values every Interval steps
+// into in-memory tables and streams them to the sinks.
+// The model table has the columns Steps, Events and one per model reporter,
+// the agent table is in long format with the columns Steps, ID and one per
+// agent reporter.
+type DataCollector struct {
+	Interval   int    // collect every Interval steps, every step if 0
+	ModelSinks []Sink // receive the rows of ModelTable
+	AgentSinks []Sink // receive the rows of AgentTable
+	ModelTable Table
+	AgentTable Table
+	Stream     bool // only write to the sinks, don't keep the tables in memory
+	modelNames []string
+	modelRep   []ModelReporter
+	agentNames []string
+	agentRep   []AgentReporter
+	started    bool
+}
+
+// AddModelReporter registers a model level reporter under name
+func (c *DataCollector) AddModelReporter(name string, r ModelReporter) {
+	if c.started {
+		panic("reporters have to be added before the first collection")
+	}
+	c.modelNames = append(c.modelNames, name)
+	c.modelRep = append(c.modelRep, r)
+}
+
+// AddAgentReporter registers an agent level reporter under name
+func (c *DataCollector) AddAgentReporter(name string, r AgentReporter) {
+	if c.started {
+		panic("reporters have to be added before the first collection")
+	}
+	c.agentNames = append(c.agentNames, name)
+	c.agentRep = append(c.agentRep, r)
+}
+
+// keepWhole reports whether values of t are reported in a single column
+// even though they could be flattened, e.g. time.Time
+func keepWhole(t reflect.Type) bool {
+	stringer := reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	marshaler := reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	return t.Implements(stringer) || t.Implements(marshaler) ||
+		reflect.PtrTo(t).Implements(stringer) || reflect.PtrTo(t).Implements(marshaler)
+}
+
+// flattenFields calls add for every column of the struct type t.
+// Fields which are unexported, interfaces, functions, channels or tagged
+// with `goabm:"hide"` are left out, include filters the top level fields.
+// Nested structs become one column per field named Outer.Inner, embedded
+// structs are flattened without a prefix, arrays become one column per
+// element named Name.0, Name.1, ... Slices, maps and pointers stay in a
+// single column, the sinks decide how to write them.
+func flattenFields(t reflect.Type, prefix string, get func(reflect.Value) reflect.Value, include func(reflect.StructField) bool, add func(string, func(reflect.Value) reflect.Value)) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || hasTagOption(f, "hide") || (include != nil && !include(f)) {
+			continue
+		}
+		switch f.Type.Kind() {
+		case reflect.Interface, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+			continue
+		}
+		i := i
+		field := func(v reflect.Value) reflect.Value { return get(v).Field(i) }
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && !keepWhole(f.Type) {
+			flattenFields(f.Type, prefix, field, nil, add)
+			continue
+		}
+		flattenValue(f.Type, prefix+f.Name, field, add)
+	}
+}
+
+func flattenValue(t reflect.Type, name string, get func(reflect.Value) reflect.Value, add func(string, func(reflect.Value) reflect.Value)) {
+	if keepWhole(t) {
+		add(name, get)
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		flattenFields(t, name+".", get, nil, add)
+	case reflect.Array:
+		for k := 0; k < t.Len(); k++ {
+			k := k
+			flattenValue(t.Elem(), name+"."+strconv.Itoa(k), func(v reflect.Value) reflect.Value { return get(v).Index(k) }, add)
+		}
+	default:
+		add(name, get)
+	}
+}
+
+// structReporters returns a reporter for every flattened field of the
+// struct behind the pointer v
+func structReporters(v interface{}, include func(reflect.StructField) bool) (names []string, reporters []func(interface{}) interface{}) {
+	root := func(v reflect.Value) reflect.Value { return v }
+	flattenFields(reflect.TypeOf(v).Elem(), "", root, include, func(name string, get func(reflect.Value) reflect.Value) {
+		names = append(names, name)
+		reporters = append(reporters, func(v interface{}) interface{} {
+			return get(reflect.ValueOf(v).Elem()).Interface()
+		})
+	})
+	return names, reporters
+}
+
+// AddModelFields registers every exported field of the model which is not
+// an interface and not tagged with `goabm:"hide"`, like the Logger does.
+// Nested fields are flattened, see flattenFields.
+func (c *DataCollector) AddModelFields(model Modeler) {
+	names, reporters := structReporters(model, nil)
+	for i := range names {
+		r := reporters[i]
+		c.AddModelReporter(names[i], func(m Modeler) interface{} { return r(m) })
+	}
+}
+
+// AddAgentFields registers the exported fields of the agent type which are
+// tagged with `goabm:"report"`
+func (c *DataCollector) AddAgentFields(agent Agenter) {
+	report := func(f reflect.StructField) bool { return hasTagOption(f, "report") }
+	names, reporters := structReporters(agent, report)
+	for i := range names {
+		r := reporters[i]
+		c.AddAgentReporter(names[i], func(a Agenter) interface{} { return r(a) })
+	}
+}
+
+func (c *DataCollector) start() error {
+	c.started = true
+	c.ModelTable.Columns = append([]string{"Steps", "Events"}, c.modelNames...)
+	c.AgentTable.Columns = append([]string{"Steps", "ID"}, c.agentNames...)
+	for _, s := range c.ModelSinks {
+		if err := s.WriteHeader(c.ModelTable.Columns); err != nil {
+			return err
+		}
+	}
+	for _, s := range c.AgentSinks {
+		if err := s.WriteHeader(c.AgentTable.Columns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Collect evaluates all reporters if the step is due
+func (c *DataCollector) Collect(stats Statistics, model Modeler, agents []Agenter) error {
+	if !c.started {
+		if err := c.start(); err != nil {
+			return err
+		}
+	}
+	if c.Interval > 1 && stats.Steps%c.Interval != 0 {
+		return nil
+	}
+
+	row := make([]interface{}, 0, len(c.ModelTable.Columns))
+	row = append(row, stats.Steps, stats.Events)
+	for _, r := range c.modelRep {
+		row = append(row, r(model))
+	}
+	if !c.Stream {
+		c.ModelTable.Rows = append(c.ModelTable.Rows, row)
+	}
+	for _, s := range c.ModelSinks {
+		if err := s.WriteRow(row); err != nil {
+			return err
+		}
+	}
+
+	if len(c.agentRep) == 0 {
+		return nil
+	}
+	for _, a := range agents {
+		row := make([]interface{}, 0, len(c.AgentTable.Columns))
+		row = append(row, stats.Steps, a.ID())
+		for _, r := range c.agentRep {
+			row = append(row, r(a))
+		}
+		if !c.Stream {
+			c.AgentTable.Rows = append(c.AgentTable.Rows, row)
+		}
+		for _, s := range c.AgentSinks {
+			if err := s.WriteRow(row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ModelValues evaluates the model reporters, e.g. at the end of a run
+func (c *DataCollector) ModelValues(model Modeler) map[string]interface{} {
+	values := make(map[string]interface{}, len(c.modelRep))
+	for i, r := range c.modelRep {
+		values[c.modelNames[i]] = r(model)
+	}
+	return values
+}
+
+// Close closes all sinks
+func (c *DataCollector) Close() error {
+	var first error
+	for _, s := range append(c.ModelSinks, c.AgentSinks...) {
+		if err := s.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,174 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// collectModel has a field of every kind the collector flattens or skips
+type collectModel struct {
+	*testModel // an unexported embedded type is left out
+	Tally      // an embedded struct, its Count is a column without a prefix
+	Pos        struct{ X, Y float64 }
+	Hist       [2]int
+	Counts     []int
+	Names      map[string]int
+	When       time.Time // a Stringer, kept whole
+	Rule       fmt.Stringer
+	Hidden     int `goabm:"hide"`
+	hidden     int
+}
+
+type Tally struct {
+	Count int
+}
+
+type collectAgent struct {
+	id  AgentID
+	V   int                    `goabm:"report"`
+	Pos struct{ X, Y float64 } `goabm:"report"`
+	Tag string
+}
+
+func (a *collectAgent) Act()        {}
+func (a *collectAgent) ID() AgentID { return a.id }
+
+// recordSink keeps everything written to it
+type recordSink struct {
+	header []string
+	rows   [][]interface{}
+	closed bool
+}
+
+func (s *recordSink) WriteHeader(columns []string) error {
+	s.header = columns
+	return nil
+}
+
+func (s *recordSink) WriteRow(row []interface{}) error {
+	s.rows = append(s.rows, row)
+	return nil
+}
+
+func (s *recordSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestCollectorFlatten(t *testing.T) {
+	when := time.Date(2013, 5, 1, 0, 0, 0, 0, time.UTC)
+	m := &collectModel{testModel: &testModel{}, Counts: []int{1, 2}, Names: map[string]int{"a": 1}, When: when, Hidden: 1, hidden: 2}
+	m.Count, m.Pos.X, m.Pos.Y, m.Hist = 7, 0.5, 1.5, [2]int{3, 4}
+	a := &collectAgent{id: 4, V: 2, Tag: "x"}
+	a.Pos.X, a.Pos.Y = 1, 2
+
+	c := &DataCollector{}
+	c.AddModelFields(m)
+	c.AddAgentFields(a)
+	if err := c.Collect(Statistics{Steps: 1, Events: 9}, m, []Agenter{a}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"Steps", "Events", "Count", "Pos.X", "Pos.Y", "Hist.0", "Hist.1", "Counts", "Names", "When"}
+	if !reflect.DeepEqual(c.ModelTable.Columns, want) {
+		t.Errorf("model columns %v, want %v", c.ModelTable.Columns, want)
+	}
+	// slices and maps stay in a single column
+	row := []interface{}{1, 9, 7, 0.5, 1.5, 3, 4, []int{1, 2}, map[string]int{"a": 1}, when}
+	if !reflect.DeepEqual(c.ModelTable.Rows, [][]interface{}{row}) {
+		t.Errorf("model rows %v, want [%v]", c.ModelTable.Rows, row)
+	}
+
+	want = []string{"Steps", "ID", "V", "Pos.X", "Pos.Y"}
+	if !reflect.DeepEqual(c.AgentTable.Columns, want) {
+		t.Errorf("agent columns %v, want %v", c.AgentTable.Columns, want)
+	}
+	row = []interface{}{1, AgentID(4), 2, 1.0, 2.0}
+	if !reflect.DeepEqual(c.AgentTable.Rows, [][]interface{}{row}) {
+		t.Errorf("agent rows %v, want [%v]", c.AgentTable.Rows, row)
+	}
+
+	values := c.ModelValues(m)
+	if len(values) != 8 || values["Pos.Y"] != 1.5 || values["Hist.1"] != 4 {
+		t.Errorf("the model values are %v", values)
+	}
+}
+
+func TestCollectorInterval(t *testing.T) {
+	for _, tt := range []struct {
+		interval int
+		steps    []int
+	}{
+		{0, []int{1, 2, 3, 4, 5, 6, 7}},
+		{1, []int{1, 2, 3, 4, 5, 6, 7}},
+		{3, []int{3, 6}},
+	} {
+		model, agents := &recordSink{}, &recordSink{}
+		c := &DataCollector{Interval: tt.interval, ModelSinks: []Sink{model}, AgentSinks: []Sink{agents}}
+		c.AddModelReporter("Twice", func(m Modeler) interface{} { return 2 * m.(*testModel).Total })
+		c.AddAgentReporter("Even", func(a Agenter) interface{} { return a.ID()%2 == 0 })
+
+		m := &testModel{}
+		population := []Agenter{&collectAgent{id: 1}, &collectAgent{id: 2}}
+		for step := 1; step <= 7; step++ {
+			m.Total = step
+			if err := c.Collect(Statistics{Steps: step, Events: 2 * step}, m, population); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := []string{"Steps", "Events", "Twice"}; !reflect.DeepEqual(model.header, want) {
+			t.Errorf("interval %d: model header %v, want %v", tt.interval, model.header, want)
+		}
+		if want := []string{"Steps", "ID", "Even"}; !reflect.DeepEqual(agents.header, want) {
+			t.Errorf("interval %d: agent header %v, want %v", tt.interval, agents.header, want)
+		}
+		var rows, agentRows [][]interface{}
+		for _, step := range tt.steps {
+			rows = append(rows, []interface{}{step, 2 * step, 2 * step})
+			agentRows = append(agentRows, []interface{}{step, AgentID(1), false}, []interface{}{step, AgentID(2), true})
+		}
+		if !reflect.DeepEqual(model.rows, rows) || !reflect.DeepEqual(c.ModelTable.Rows, rows) {
+			t.Errorf("interval %d: model rows %v and %v, want %v", tt.interval, model.rows, c.ModelTable.Rows, rows)
+		}
+		if !reflect.DeepEqual(agents.rows, agentRows) || !reflect.DeepEqual(c.AgentTable.Rows, agentRows) {
+			t.Errorf("interval %d: agent rows %v and %v, want %v", tt.interval, agents.rows, c.AgentTable.Rows, agentRows)
+		}
+		if !model.closed || !agents.closed {
+			t.Errorf("interval %d: the sinks are not closed", tt.interval)
+		}
+	}
+}
+
+func TestCollectorStream(t *testing.T) {
+	sink := &recordSink{}
+	c := &DataCollector{ModelSinks: []Sink{sink}, Stream: true}
+	c.AddModelFields(&testModel{})
+	for step := 1; step <= 3; step++ {
+		if err := c.Collect(Statistics{Steps: step}, &testModel{Total: step}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.ModelTable.Len() != 0 || len(sink.rows) != 3 {
+		t.Errorf("%d rows in the table and %d in the sink, want 0 and 3", c.ModelTable.Len(), len(sink.rows))
+	}
+	if last := c.ModelTable.Last(); last != nil {
+		t.Errorf("the last row of an empty table is %v", last)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("a reporter is added after the first collection")
+		}
+	}()
+	c.AddModelReporter("Late", func(Modeler) interface{} { return 0 })
+}
@@ -0,0 +1,812 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+)
+
+// Columnar files are Apache Arrow IPC files (Feather version 2), so they
+// can be read by pyarrow, R, polars and the other Arrow libraries, and
+// memory-mapped: every buffer starts 8 byte aligned.
+//
+// Layout:
+//
+//	"ARROW1" and 2 bytes of padding
+//	schema message
+//	record batch messages
+//	end of stream marker
+//	footer with the schema and the offsets of the record batches
+//	length of the footer as int32
+//	"ARROW1"
+//
+// Every message is a flatbuffer followed by its body, the buffers of the
+// columns. Integer columns are int64, floating point columns float64,
+// bools are bitmaps and everything else utf8 strings, nil values are
+// nulls. Only these types are written and read, without compression or
+// dictionaries.
+const columnarMagic = "ARROW1"
+
+// column types of a columnar file
+const (
+	ColumnInt64   = "int64"
+	ColumnFloat64 = "float64"
+	ColumnBool    = "bool"
+	ColumnString  = "string"
+)
+
+// Arrow metadata version V5 and the ids of the flatbuffer unions
+const (
+	arrowVersion     = 4
+	arrowSchema      = 1
+	arrowRecordBatch = 3
+	arrowInt         = 2
+	arrowFloat       = 3
+	arrowBinary      = 4
+	arrowUtf8        = 5
+	arrowBool        = 6
+	arrowLargeBinary = 19
+	arrowLargeUtf8   = 20
+	arrowDouble      = 2 // precision of a FloatingPoint
+	arrowSingle      = 1
+)
+
+// arrowBlock locates a record batch in the file
+type arrowBlock struct {
+	offset     int64
+	metaLength int32
+	bodyLength int64
+}
+
+// ColumnarSink writes a table as an Arrow IPC file, rows are buffered and
+// written in record batches of BatchRows. The column types are taken from
+// the first batch: integer columns which hold floats too are float64,
+// columns with values of different types are strings. Later values have
+// to fit the types, floats without a fraction fit into integer columns.
+// Close writes the footer, it has to be called even if no row was written.
+type ColumnarSink struct {
+	BatchRows int // rows per batch, 65536 if 0
+	w         io.Writer
+	closer    io.Closer
+	offset    int64
+	columns   []string
+	types     []string        // fixed by the first batch
+	values    [][]interface{} // buffered values by column
+	rows      int
+	schema    fbTable
+	blocks    []arrowBlock
+}
+
+// NewColumnarSink writes a columnar file to w
+func NewColumnarSink(w io.Writer) *ColumnarSink {
+	return &ColumnarSink{w: w}
+}
+
+func (s *ColumnarSink) write(b []byte) error {
+	if s.offset == 0 {
+		// every file starts with the magic, also without a header
+		n, err := s.w.Write([]byte(columnarMagic + "\x00\x00"))
+		s.offset += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	n, err := s.w.Write(b)
+	s.offset += int64(n)
+	return err
+}
+
+func (s *ColumnarSink) WriteHeader(columns []string) error {
+	s.columns = columns
+	s.values = make([][]interface{}, len(columns))
+	return s.write(nil)
+}
+
+func columnType(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ColumnInt64
+	case reflect.Float32, reflect.Float64:
+		return ColumnFloat64
+	case reflect.Bool:
+		return ColumnBool
+	}
+	return ColumnString
+}
+
+// cell converts v to the value stored in a column of type typ: nil, int64,
+// float64, bool or string
+func (s *ColumnarSink) cell(i int, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	rv := reflect.ValueOf(v)
+	switch s.types[i] {
+	case ColumnInt64:
+		switch columnType(v) {
+		case ColumnInt64:
+			if rv.Kind() >= reflect.Uint && rv.Kind() <= reflect.Uint64 {
+				return int64(rv.Uint()), nil
+			}
+			return rv.Int(), nil
+		case ColumnFloat64:
+			if f := rv.Float(); f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+				return int64(f), nil
+			}
+		}
+		return nil, fmt.Errorf("columnar: %v is not an integer in column %s", v, s.columns[i])
+	case ColumnFloat64:
+		if t := columnType(v); t == ColumnInt64 || t == ColumnFloat64 {
+			f, _ := toFloat64(v)
+			return f, nil
+		}
+		return nil, fmt.Errorf("columnar: %v is not a number in column %s", v, s.columns[i])
+	case ColumnBool:
+		if rv.Kind() == reflect.Bool {
+			return rv.Bool(), nil
+		}
+		return nil, fmt.Errorf("columnar: %v is not a bool in column %s", v, s.columns[i])
+	}
+	return formatCell(v), nil
+}
+
+func (s *ColumnarSink) WriteRow(row []interface{}) error {
+	if len(row) != len(s.columns) {
+		return fmt.Errorf("columnar: row has %d values, expected %d", len(row), len(s.columns))
+	}
+	for i, v := range row {
+		if s.types != nil {
+			var err error
+			if v, err = s.cell(i, v); err != nil {
+				return err
+			}
+		}
+		s.values[i] = append(s.values[i], v)
+	}
+	s.rows++
+	batch := s.BatchRows
+	if batch <= 0 {
+		batch = 65536
+	}
+	if s.rows >= batch {
+		return s.flush()
+	}
+	return nil
+}
+
+// start fixes the column types from the buffered rows and writes the
+// schema
+func (s *ColumnarSink) start() error {
+	s.types = make([]string, len(s.columns))
+	fields := make([]fbTable, len(s.columns))
+	for i, values := range s.values {
+		typ := ""
+		for _, v := range values {
+			if v == nil {
+				continue
+			}
+			switch t := columnType(v); {
+			case typ == "" || typ == t:
+				typ = t
+			case typ == ColumnInt64 && t == ColumnFloat64, typ == ColumnFloat64 && t == ColumnInt64:
+				typ = ColumnFloat64
+			default:
+				typ = ColumnString
+			}
+		}
+		if typ == "" {
+			// only nulls
+			typ = ColumnString
+		}
+		s.types[i] = typ
+		for r, v := range values {
+			var err error
+			if values[r], err = s.cell(i, v); err != nil {
+				return err
+			}
+		}
+		fields[i] = arrowField(s.columns[i], typ)
+	}
+	s.schema = fbTable{{id: 1, ref: fields}}
+	_, err := s.message(arrowSchema, s.schema, nil)
+	return err
+}
+
+// arrowField describes a nullable column of type typ
+func arrowField(name, typ string) fbTable {
+	var id uint64
+	var t fbTable
+	switch typ {
+	case ColumnInt64:
+		id, t = arrowInt, fbTable{{id: 0, size: 4, value: 64}, {id: 1, size: 1, value: 1}}
+	case ColumnFloat64:
+		id, t = arrowFloat, fbTable{{id: 0, size: 2, value: arrowDouble}}
+	case ColumnBool:
+		id, t = arrowBool, fbTable{}
+	default:
+		id, t = arrowUtf8, fbTable{}
+	}
+	return fbTable{
+		{id: 0, ref: name},
+		{id: 1, size: 1, value: 1},
+		{id: 2, size: 1, value: id},
+		{id: 3, ref: t},
+		{id: 5, ref: []fbTable{}},
+	}
+}
+
+// message writes an encapsulated message: a continuation marker, the
+// length of the metadata, the metadata padded to 8 bytes and the body
+func (s *ColumnarSink) message(typ uint64, header fbTable, body []byte) (arrowBlock, error) {
+	meta := fbBuild(fbTable{
+		{id: 0, size: 2, value: arrowVersion},
+		{id: 1, size: 1, value: typ},
+		{id: 2, ref: header},
+		{id: 3, size: 8, value: uint64(len(body))},
+	})
+	for (len(meta)+8)%8 != 0 {
+		meta = append(meta, 0)
+	}
+	b := arrowBlock{offset: s.offset, metaLength: int32(len(meta) + 8), bodyLength: int64(len(body))}
+	var prefix [8]byte
+	binary.LittleEndian.PutUint32(prefix[:], 0xffffffff)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(meta)))
+	for _, data := range [][]byte{prefix[:], meta, body} {
+		if err := s.write(data); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+// flush writes the buffered rows as a record batch
+func (s *ColumnarSink) flush() error {
+	if s.types == nil {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	if s.rows == 0 {
+		return nil
+	}
+	var body, nodes, buffers []byte
+	buffer := func(b []byte) {
+		buffers = appendInt64s(buffers, int64(len(body)), int64(len(b)))
+		body = append(body, b...)
+		for len(body)%8 != 0 {
+			body = append(body, 0)
+		}
+	}
+	for i, values := range s.values {
+		validity := make([]byte, (s.rows+7)/8)
+		nulls := 0
+		for r, v := range values {
+			if v == nil {
+				nulls++
+			} else {
+				validity[r/8] |= 1 << uint(r%8)
+			}
+		}
+		nodes = appendInt64s(nodes, int64(s.rows), int64(nulls))
+		if nulls == 0 {
+			validity = nil
+		}
+		buffer(validity)
+
+		switch s.types[i] {
+		case ColumnInt64, ColumnFloat64:
+			data := make([]byte, 8*s.rows)
+			for r, v := range values {
+				switch x := v.(type) {
+				case int64:
+					binary.LittleEndian.PutUint64(data[8*r:], uint64(x))
+				case float64:
+					binary.LittleEndian.PutUint64(data[8*r:], math.Float64bits(x))
+				}
+			}
+			buffer(data)
+		case ColumnBool:
+			data := make([]byte, (s.rows+7)/8)
+			for r, v := range values {
+				if v == true {
+					data[r/8] |= 1 << uint(r%8)
+				}
+			}
+			buffer(data)
+		default:
+			offsets := make([]byte, 4, 4*(s.rows+1))
+			var data []byte
+			for _, v := range values {
+				if str, ok := v.(string); ok {
+					data = append(data, str...)
+				}
+				if len(data) > math.MaxInt32 {
+					return fmt.Errorf("columnar: more than 2GB of strings in a batch of column %s", s.columns[i])
+				}
+				offsets = binary.LittleEndian.AppendUint32(offsets, uint32(len(data)))
+			}
+			buffer(offsets)
+			buffer(data)
+		}
+		s.values[i] = values[:0]
+	}
+	b, err := s.message(arrowRecordBatch, fbTable{
+		{id: 0, size: 8, value: uint64(s.rows)},
+		{id: 1, ref: fbStructs{16, nodes}},
+		{id: 2, ref: fbStructs{16, buffers}},
+	}, body)
+	if err != nil {
+		return err
+	}
+	s.blocks = append(s.blocks, b)
+	s.rows = 0
+	return nil
+}
+
+func appendInt64s(b []byte, values ...int64) []byte {
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint64(b, uint64(v))
+	}
+	return b
+}
+
+func (s *ColumnarSink) Close() error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+	var blocks []byte
+	for _, b := range s.blocks {
+		blocks = appendInt64s(blocks, b.offset)
+		blocks = binary.LittleEndian.AppendUint32(blocks, uint32(b.metaLength))
+		blocks = appendInt64s(append(blocks, 0, 0, 0, 0), b.bodyLength)
+	}
+	footer := fbBuild(fbTable{
+		{id: 0, size: 2, value: arrowVersion},
+		{id: 1, ref: s.schema},
+		{id: 2, ref: fbStructs{24, nil}},
+		{id: 3, ref: fbStructs{24, blocks}},
+	})
+	var eos, length [8]byte
+	binary.LittleEndian.PutUint32(eos[:], 0xffffffff)
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+	for _, b := range [][]byte{eos[:], footer, length[:4], []byte(columnarMagic)} {
+		if err := s.write(b); err != nil {
+			return err
+		}
+	}
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+// ColumnarFile is a columnar file read into memory
+type ColumnarFile struct {
+	data    []byte
+	columns []string
+	fields  []arrowColumnType
+	batches []arrowBatch
+}
+
+// arrowColumnType is the physical type of a column in the file
+type arrowColumnType struct {
+	typ    string // the column type
+	width  int    // bytes per value of numbers
+	signed bool
+	large  bool // 64 bit string offsets
+}
+
+// arrowColumn holds the buffers of a column in a record batch
+type arrowColumn struct {
+	nulls    int
+	validity []byte // empty if there are no nulls
+	data     []byte // values or string offsets
+	strings  []byte
+}
+
+type arrowBatch struct {
+	rows    int
+	columns []arrowColumn
+}
+
+// ReadColumnar reads the columnar file at path
+func ReadColumnar(path string) (*ColumnarFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseColumnar(data)
+}
+
+// ParseColumnar reads an Arrow IPC file from data, e.g. a memory-mapped
+// file. The layout is checked, the columns are decoded on access.
+func ParseColumnar(data []byte) (f *ColumnarFile, err error) {
+	m := len(columnarMagic)
+	if len(data) < 2*m+6 || string(data[:m]) != columnarMagic || string(data[len(data)-m:]) != columnarMagic {
+		return nil, errors.New("columnar: not an Arrow file")
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			fe, ok := e.(fbError)
+			if !ok {
+				panic(e)
+			}
+			f, err = nil, fe.error
+		}
+	}()
+	end := len(data) - m - 4
+	n := int(int32(binary.LittleEndian.Uint32(data[end:])))
+	if n <= 0 || n > end-8 {
+		return nil, errors.New("columnar: invalid footer")
+	}
+	end -= n
+	footer := fbRoot(data[end : end+n])
+	f = &ColumnarFile{data: data}
+	schema, ok := footer.table(1)
+	if !ok {
+		return nil, errors.New("columnar: no schema")
+	}
+	if err := f.readSchema(schema); err != nil {
+		return nil, err
+	}
+	if _, n := footer.vector(2, 24); n > 0 {
+		return nil, errors.New("columnar: dictionaries are not supported")
+	}
+	pos, blocks := footer.vector(3, 24)
+	for i := 0; i < blocks; i++ {
+		b := footer.bytes(pos+24*i, 24)
+		block := arrowBlock{
+			offset:     int64(binary.LittleEndian.Uint64(b)),
+			metaLength: int32(binary.LittleEndian.Uint32(b[8:])),
+			bodyLength: int64(binary.LittleEndian.Uint64(b[16:])),
+		}
+		batch, err := f.readBatch(block, int64(end))
+		if err != nil {
+			return nil, err
+		}
+		f.batches = append(f.batches, batch)
+	}
+	return f, nil
+}
+
+// readSchema reads the names and types of the columns
+func (f *ColumnarFile) readSchema(schema fbTableReader) error {
+	pos, n := schema.vector(1, 4)
+	for i := 0; i < n; i++ {
+		field := schema.vectorTable(pos, i)
+		name := field.string(0)
+		t, _ := field.table(3)
+		var c arrowColumnType
+		switch field.scalar(2, 1) {
+		case arrowInt:
+			c = arrowColumnType{typ: ColumnInt64, width: int(int32(t.scalar(0, 4))) / 8, signed: t.scalar(1, 1) != 0}
+			if c.width != 1 && c.width != 2 && c.width != 4 && c.width != 8 {
+				return fmt.Errorf("columnar: invalid integer width in column %s", name)
+			}
+		case arrowFloat:
+			switch t.scalar(0, 2) {
+			case arrowDouble:
+				c = arrowColumnType{typ: ColumnFloat64, width: 8}
+			case arrowSingle:
+				c = arrowColumnType{typ: ColumnFloat64, width: 4}
+			default:
+				return fmt.Errorf("columnar: half precision column %s is not supported", name)
+			}
+		case arrowBool:
+			c = arrowColumnType{typ: ColumnBool}
+		case arrowUtf8, arrowBinary:
+			c = arrowColumnType{typ: ColumnString}
+		case arrowLargeUtf8, arrowLargeBinary:
+			c = arrowColumnType{typ: ColumnString, large: true}
+		default:
+			return fmt.Errorf("columnar: the type of column %s is not supported", name)
+		}
+		if _, children := field.vector(5, 4); children > 0 {
+			return fmt.Errorf("columnar: nested column %s is not supported", name)
+		}
+		f.columns = append(f.columns, name)
+		f.fields = append(f.fields, c)
+	}
+	return nil
+}
+
+// readBatch reads the record batch message of a block and checks that
+// its buffers are in the body and large enough for the rows, end is the
+// start of the footer
+func (f *ColumnarFile) readBatch(b arrowBlock, end int64) (arrowBatch, error) {
+	invalid := errors.New("columnar: invalid record batch")
+	if b.offset < 8 || b.metaLength < 8 || b.bodyLength < 0 || b.offset > end ||
+		int64(b.metaLength) > end-b.offset || b.bodyLength > end-b.offset-int64(b.metaLength) {
+		return arrowBatch{}, invalid
+	}
+	meta := f.data[b.offset : b.offset+int64(b.metaLength)]
+	if binary.LittleEndian.Uint32(meta) == 0xffffffff {
+		meta = meta[8:]
+	} else {
+		// the format before the continuation marker
+		meta = meta[4:]
+	}
+	msg := fbRoot(meta)
+	header, ok := msg.table(2)
+	if msg.scalar(1, 1) != arrowRecordBatch || !ok {
+		return arrowBatch{}, invalid
+	}
+	if _, ok := header.table(3); ok {
+		return arrowBatch{}, errors.New("columnar: compressed record batches are not supported")
+	}
+	start := b.offset + int64(b.metaLength)
+	body := f.data[start : start+b.bodyLength]
+	rows := int64(header.scalar(0, 8))
+	nodes, nn := header.vector(1, 16)
+	buffers, nb := header.vector(2, 16)
+	if rows < 0 || rows > int64(len(f.data))*8 || nn != len(f.fields) {
+		return arrowBatch{}, invalid
+	}
+	batch := arrowBatch{rows: int(rows)}
+	next := 0 // next buffer
+	buffer := func(size int64) []byte {
+		if next >= nb {
+			panic(fbError{invalid})
+		}
+		b := header.bytes(buffers+16*next, 16)
+		next++
+		off, length := int64(binary.LittleEndian.Uint64(b)), int64(binary.LittleEndian.Uint64(b[8:]))
+		if off < 0 || length < size || off > int64(len(body)) || length > int64(len(body))-off {
+			panic(fbError{invalid})
+		}
+		return body[off : off+length]
+	}
+	for i, c := range f.fields {
+		node := header.bytes(nodes+16*i, 16)
+		length, nulls := int64(binary.LittleEndian.Uint64(node)), int64(binary.LittleEndian.Uint64(node[8:]))
+		if length != rows || nulls < 0 || nulls > rows {
+			return arrowBatch{}, invalid
+		}
+		col := arrowColumn{nulls: int(nulls)}
+		bitmap := (rows + 7) / 8
+		if nulls > 0 {
+			col.validity = buffer(bitmap)
+		} else {
+			buffer(0)
+		}
+		switch c.typ {
+		case ColumnInt64, ColumnFloat64:
+			col.data = buffer(rows * int64(c.width))
+		case ColumnBool:
+			col.data = buffer(bitmap)
+		default:
+			width := int64(4)
+			if c.large {
+				width = 8
+			}
+			col.data = buffer((rows + 1) * width)
+			col.strings = buffer(0)
+		}
+		batch.columns = append(batch.columns, col)
+	}
+	return batch, nil
+}
+
+// Columns returns the column names
+func (f *ColumnarFile) Columns() []string {
+	return f.columns
+}
+
+// Type returns the type of a column, "" if it does not exist
+func (f *ColumnarFile) Type(column string) string {
+	if i := f.index(column); i >= 0 {
+		return f.fields[i].typ
+	}
+	return ""
+}
+
+// Rows returns the number of rows
+func (f *ColumnarFile) Rows() int {
+	n := 0
+	for _, b := range f.batches {
+		n += b.rows
+	}
+	return n
+}
+
+func (f *ColumnarFile) index(column string) int {
+	for i, c := range f.columns {
+		if c == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// column returns the index of a column checking its type
+func (f *ColumnarFile) column(column, typ string) (int, error) {
+	i := f.index(column)
+	if i < 0 {
+		return 0, fmt.Errorf("columnar: no column %s", column)
+	}
+	if f.fields[i].typ != typ {
+		return 0, fmt.Errorf("columnar: column %s is %s, not %s", column, f.fields[i].typ, typ)
+	}
+	return i, nil
+}
+
+// bit returns bit r of a bitmap
+func bit(bitmap []byte, r int) bool {
+	return bitmap[r/8]&(1<<uint(r%8)) != 0
+}
+
+// Valid returns false for the rows in which a column is null
+func (f *ColumnarFile) Valid(column string) ([]bool, error) {
+	i := f.index(column)
+	if i < 0 {
+		return nil, fmt.Errorf("columnar: no column %s", column)
+	}
+	values := make([]bool, 0, f.Rows())
+	for _, b := range f.batches {
+		c := b.columns[i]
+		for r := 0; r < b.rows; r++ {
+			values = append(values, c.nulls == 0 || bit(c.validity, r))
+		}
+	}
+	return values, nil
+}
+
+// Int64s returns the values of an integer column, 0 for nulls
+func (f *ColumnarFile) Int64s(column string) ([]int64, error) {
+	i, err := f.column(column, ColumnInt64)
+	if err != nil {
+		return nil, err
+	}
+	t := f.fields[i]
+	values := make([]int64, 0, f.Rows())
+	for _, b := range f.batches {
+		data := b.columns[i].data
+		for r := 0; r < b.rows; r++ {
+			var v int64
+			switch p := data[r*t.width:]; {
+			case t.width == 8:
+				v = int64(binary.LittleEndian.Uint64(p))
+			case t.width == 4 && t.signed:
+				v = int64(int32(binary.LittleEndian.Uint32(p)))
+			case t.width == 4:
+				v = int64(binary.LittleEndian.Uint32(p))
+			case t.width == 2 && t.signed:
+				v = int64(int16(binary.LittleEndian.Uint16(p)))
+			case t.width == 2:
+				v = int64(binary.LittleEndian.Uint16(p))
+			case t.signed:
+				v = int64(int8(p[0]))
+			default:
+				v = int64(p[0])
+			}
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+// Float64s returns the values of a floating point column, 0 for nulls
+func (f *ColumnarFile) Float64s(column string) ([]float64, error) {
+	i, err := f.column(column, ColumnFloat64)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]float64, 0, f.Rows())
+	for _, b := range f.batches {
+		data := b.columns[i].data
+		for r := 0; r < b.rows; r++ {
+			if f.fields[i].width == 4 {
+				values = append(values, float64(math.Float32frombits(binary.LittleEndian.Uint32(data[4*r:]))))
+			} else {
+				values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(data[8*r:])))
+			}
+		}
+	}
+	return values, nil
+}
+
+// Bools returns the values of a bool column, false for nulls
+func (f *ColumnarFile) Bools(column string) ([]bool, error) {
+	i, err := f.column(column, ColumnBool)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]bool, 0, f.Rows())
+	for _, b := range f.batches {
+		for r := 0; r < b.rows; r++ {
+			values = append(values, bit(b.columns[i].data, r))
+		}
+	}
+	return values, nil
+}
+
+// Strings returns the values of a string column, "" for nulls
+func (f *ColumnarFile) Strings(column string) ([]string, error) {
+	i, err := f.column(column, ColumnString)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, f.Rows())
+	for _, b := range f.batches {
+		c := b.columns[i]
+		offset := func(r int) uint64 {
+			if f.fields[i].large {
+				return binary.LittleEndian.Uint64(c.data[8*r:])
+			}
+			return uint64(binary.LittleEndian.Uint32(c.data[4*r:]))
+		}
+		for r := 0; r < b.rows; r++ {
+			start, end := offset(r), offset(r+1)
+			if start > end || end > uint64(len(c.strings)) {
+				return nil, fmt.Errorf("columnar: invalid string offsets in column %s", column)
+			}
+			values = append(values, string(c.strings[start:end]))
+		}
+	}
+	return values, nil
+}
+
+// Table decodes the whole file into an in-memory table, nulls are nil
+func (f *ColumnarFile) Table() (*Table, error) {
+	t := &Table{Columns: f.columns, Rows: make([][]interface{}, f.Rows())}
+	for r := range t.Rows {
+		t.Rows[r] = make([]interface{}, len(t.Columns))
+	}
+	for c, name := range t.Columns {
+		var values []interface{}
+		switch f.fields[c].typ {
+		case ColumnInt64:
+			v, err := f.Int64s(name)
+			if err != nil {
+				return nil, err
+			}
+			for _, x := range v {
+				values = append(values, x)
+			}
+		case ColumnFloat64:
+			v, err := f.Float64s(name)
+			if err != nil {
+				return nil, err
+			}
+			for _, x := range v {
+				values = append(values, x)
+			}
+		case ColumnBool:
+			v, err := f.Bools(name)
+			if err != nil {
+				return nil, err
+			}
+			for _, x := range v {
+				values = append(values, x)
+			}
+		default:
+			v, err := f.Strings(name)
+			if err != nil {
+				return nil, err
+			}
+			for _, x := range v {
+				values = append(values, x)
+			}
+		}
+		valid, err := f.Valid(name)
+		if err != nil {
+			return nil, err
+		}
+		for r, v := range values {
+			if valid[r] {
+				t.Rows[r][c] = v
+			}
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,353 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// writeColumnar writes the rows in batches of batchRows
+func writeColumnar(t *testing.T, batchRows int, columns []string, rows [][]interface{}) []byte {
+	var buf bytes.Buffer
+	s := NewColumnarSink(&buf)
+	s.BatchRows = batchRows
+	if err := s.WriteHeader(columns); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := s.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestColumnarRoundTrip(t *testing.T) {
+	columns := []string{"step", "mean", "frozen", "name", "features"}
+	var rows [][]interface{}
+	for i := 0; i < 10; i++ {
+		rows = append(rows, []interface{}{i, float64(i) / 4, i%3 == 0, "agent" + string(rune('a'+i)), []int{i, i}})
+	}
+	want := [][]interface{}{}
+	for _, r := range rows {
+		want = append(want, []interface{}{int64(r[0].(int)), r[1], r[2], r[3], formatCell(r[4])})
+	}
+
+	for _, batch := range []int{0, 1, 3, 10} {
+		f, err := ParseColumnar(writeColumnar(t, batch, columns, rows))
+		if err != nil {
+			t.Fatalf("batch %d: %v", batch, err)
+		}
+		if f.Rows() != len(rows) {
+			t.Errorf("batch %d: %d rows, want %d", batch, f.Rows(), len(rows))
+		}
+		types := []string{ColumnInt64, ColumnFloat64, ColumnBool, ColumnString, ColumnString}
+		for i, c := range columns {
+			if f.Type(c) != types[i] {
+				t.Errorf("batch %d: column %s is %s, want %s", batch, c, f.Type(c), types[i])
+			}
+		}
+		table, err := f.Table()
+		if err != nil {
+			t.Fatalf("batch %d: %v", batch, err)
+		}
+		if !reflect.DeepEqual(table.Columns, columns) || !reflect.DeepEqual(table.Rows, want) {
+			t.Errorf("batch %d: got %v %v, want %v %v", batch, table.Columns, table.Rows, columns, want)
+		}
+	}
+}
+
+func TestColumnarLayout(t *testing.T) {
+	data := writeColumnar(t, 2, []string{"i", "s"}, [][]interface{}{{1, "a"}, {nil, "bc"}, {3, nil}})
+	if !bytes.HasPrefix(data, []byte("ARROW1\x00\x00")) || !bytes.HasSuffix(data, []byte("ARROW1")) {
+		t.Fatal("no Arrow magic")
+	}
+	end := len(data) - 10
+	n := int(binary.LittleEndian.Uint32(data[end:]))
+	footer := fbRoot(data[end-n : end])
+	if v := footer.scalar(0, 2); v != arrowVersion {
+		t.Errorf("version %d", v)
+	}
+	// the end of stream marker is in front of the footer
+	if eos := data[end-n-8 : end-n]; !bytes.Equal(eos, []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}) {
+		t.Errorf("end of stream %v", eos)
+	}
+	// the schema message follows the magic
+	if m := binary.LittleEndian.Uint32(data[8:]); m != 0xffffffff {
+		t.Errorf("no continuation marker in front of the schema: %x", m)
+	}
+	schema := fbRoot(data[16:])
+	if schema.scalar(1, 1) != arrowSchema {
+		t.Errorf("the first message is a %d", schema.scalar(1, 1))
+	}
+
+	pos, blocks := footer.vector(3, 24)
+	if blocks != 2 {
+		t.Fatalf("%d record batches, want 2", blocks)
+	}
+	for i := 0; i < blocks; i++ {
+		b := footer.bytes(pos+24*i, 24)
+		offset := int(binary.LittleEndian.Uint64(b))
+		meta := int(binary.LittleEndian.Uint32(b[8:]))
+		body := int(binary.LittleEndian.Uint64(b[16:]))
+		if offset%8 != 0 || meta%8 != 0 || body%8 != 0 {
+			t.Errorf("batch %d is not aligned: %d %d %d", i, offset, meta, body)
+		}
+		if m := binary.LittleEndian.Uint32(data[offset:]); m != 0xffffffff {
+			t.Errorf("batch %d: no continuation marker", i)
+		}
+		msg := fbRoot(data[offset+8 : offset+meta])
+		if msg.scalar(1, 1) != arrowRecordBatch || int(msg.scalar(3, 8)) != body {
+			t.Errorf("batch %d: message type %d, body %d", i, msg.scalar(1, 1), msg.scalar(3, 8))
+		}
+	}
+}
+
+func TestColumnarNulls(t *testing.T) {
+	// a failed run has no values, the columns take their types from the
+	// other rows
+	rows := [][]interface{}{{0, nil, nil}, {1, 2.5, nil}, {2, nil, nil}, {3, 1, nil}}
+	for _, batch := range []int{0, 1, 3} {
+		f, err := ParseColumnar(writeColumnar(t, batch, []string{"run", "value", "none"}, rows))
+		if err != nil {
+			t.Fatalf("batch %d: %v", batch, err)
+		}
+		if f.Type("value") != ColumnFloat64 && batch != 1 {
+			t.Errorf("batch %d: the value column is %s", batch, f.Type("value"))
+		}
+		table, err := f.Table()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for r, row := range table.Rows {
+			if (row[1] == nil) != (rows[r][1] == nil) || row[2] != nil {
+				t.Errorf("batch %d: row %d is %v, want %v", batch, r, row, rows[r])
+			}
+		}
+		if valid, _ := f.Valid("value"); !reflect.DeepEqual(valid, []bool{false, true, false, true}) {
+			t.Errorf("batch %d: valid %v", batch, valid)
+		}
+	}
+}
+
+func TestColumnarWidening(t *testing.T) {
+	// integers and floats in the first batch make a float64 column
+	rows := [][]interface{}{{1, 1}, {2, 2}, {3.5, 3}}
+	f, err := ParseColumnar(writeColumnar(t, 0, []string{"x", "n"}, rows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, err := f.Float64s("x"); err != nil || !reflect.DeepEqual(x, []float64{1, 2, 3.5}) {
+		t.Errorf("got %v %v", x, err)
+	}
+	if _, err := f.Int64s("x"); err == nil {
+		t.Error("the float column can be read as int64")
+	}
+	if n, err := f.Int64s("n"); err != nil || !reflect.DeepEqual(n, []int64{1, 2, 3}) {
+		t.Errorf("got %v %v for the int column", n, err)
+	}
+
+	// after the first batch the types are fixed, floats without a
+	// fraction still fit into an integer column
+	var buf bytes.Buffer
+	s := NewColumnarSink(&buf)
+	s.BatchRows = 1
+	s.WriteHeader([]string{"x"})
+	for _, v := range []interface{}{1, 2.0, uint8(3)} {
+		if err := s.WriteRow([]interface{}{v}); err != nil {
+			t.Errorf("%v: %v", v, err)
+		}
+	}
+	for _, v := range []interface{}{2.5, "a", true, math.Inf(1)} {
+		if err := s.WriteRow([]interface{}{v}); err == nil {
+			t.Errorf("%v is written into an integer column", v)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err = ParseColumnar(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, err := f.Int64s("x"); err != nil || !reflect.DeepEqual(x, []int64{1, 2, 3}) {
+		t.Errorf("got %v %v", x, err)
+	}
+
+	// values of different types make a string column
+	f, err = ParseColumnar(writeColumnar(t, 0, []string{"x"}, [][]interface{}{{1}, {"a"}, {true}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, err := f.Strings("x"); err != nil || !reflect.DeepEqual(x, []string{"1", "a", "true"}) {
+		t.Errorf("got %v %v", x, err)
+	}
+}
+
+func TestColumnarEmpty(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+		header  bool
+	}{
+		{"no header", nil, false},
+		{"no rows", []string{"a", "b"}, true},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		s := NewColumnarSink(&buf)
+		if tt.header {
+			if err := s.WriteHeader(tt.columns); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(buf.Bytes(), []byte(columnarMagic)) {
+			t.Errorf("%s: the file does not start with the magic", tt.name)
+		}
+		f, err := ParseColumnar(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if f.Rows() != 0 || len(f.Columns()) != len(tt.columns) {
+			t.Errorf("%s: got %d rows and columns %v", tt.name, f.Rows(), f.Columns())
+		}
+	}
+}
+
+// arrowFile writes a file with one record batch of the fields and buffers
+// as other Arrow libraries do
+func arrowFile(fields []fbTable, rows int, nodes []int64, buffers [][]byte) []byte {
+	var buf bytes.Buffer
+	s := NewColumnarSink(&buf)
+	s.write(nil)
+	s.schema = fbTable{{id: 1, ref: fields}}
+	s.message(arrowSchema, s.schema, nil)
+	var body, buffer []byte
+	for _, b := range buffers {
+		buffer = appendInt64s(buffer, int64(len(body)), int64(len(b)))
+		body = append(body, b...)
+		for len(body)%8 != 0 {
+			body = append(body, 0)
+		}
+	}
+	block, _ := s.message(arrowRecordBatch, fbTable{
+		{id: 0, size: 8, value: uint64(rows)},
+		{id: 1, ref: fbStructs{16, appendInt64s(nil, nodes...)}},
+		{id: 2, ref: fbStructs{16, buffer}},
+	}, body)
+	s.blocks = append(s.blocks, block)
+	s.types = []string{}
+	s.Close()
+	return buf.Bytes()
+}
+
+func TestColumnarForeignTypes(t *testing.T) {
+	field := func(name string, typ uint64, t fbTable) fbTable {
+		return fbTable{{id: 0, ref: name}, {id: 1, size: 1, value: 1}, {id: 2, size: 1, value: typ}, {id: 3, ref: t}, {id: 5, ref: []fbTable{}}}
+	}
+	le := func(values ...interface{}) []byte {
+		var b bytes.Buffer
+		for _, v := range values {
+			binary.Write(&b, binary.LittleEndian, v)
+		}
+		return b.Bytes()
+	}
+	fields := []fbTable{
+		field("i32", arrowInt, fbTable{{id: 0, size: 4, value: 32}, {id: 1, size: 1, value: 1}}),
+		field("u8", arrowInt, fbTable{{id: 0, size: 4, value: 8}}),
+		field("f32", arrowFloat, fbTable{{id: 0, size: 2, value: arrowSingle}}),
+		field("large", arrowLargeUtf8, fbTable{}),
+	}
+	data := arrowFile(fields, 2, []int64{2, 1, 2, 0, 2, 0, 2, 0}, [][]byte{
+		{0x02}, le(int32(0), int32(-7)),
+		nil, {200, 1},
+		nil, le(float32(0.5), float32(-2)),
+		nil, le(int64(0), int64(2), int64(5)), []byte("abcde"),
+	})
+	f, err := ParseColumnar(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := f.Table()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]interface{}{{nil, int64(200), 0.5, "ab"}, {int64(-7), int64(1), -2.0, "cde"}}
+	if !reflect.DeepEqual(table.Rows, want) {
+		t.Errorf("got %v, want %v", table.Rows, want)
+	}
+
+	unsupported := []fbTable{
+		field("half", arrowFloat, fbTable{{id: 0, size: 2, value: 0}}),
+		field("list", 12, fbTable{}),
+		field("i7", arrowInt, fbTable{{id: 0, size: 4, value: 7}}),
+	}
+	for _, u := range unsupported {
+		if _, err := ParseColumnar(arrowFile([]fbTable{u}, 0, nil, nil)); err == nil {
+			t.Errorf("%v is read", u)
+		}
+	}
+}
+
+// readAll decodes every column, it must not panic on corrupt input
+func readAll(data []byte) error {
+	f, err := ParseColumnar(data)
+	if err != nil {
+		return err
+	}
+	_, err = f.Table()
+	return err
+}
+
+func TestColumnarCorrupt(t *testing.T) {
+	columns := []string{"i", "f", "b", "s"}
+	rows := [][]interface{}{{1, 0.5, true, "x"}, {2, 1.5, nil, "yz"}, {3, 2.5, true, ""}}
+	valid := writeColumnar(t, 2, columns, rows)
+
+	// the string offsets of the first batch: 0, 1, 3 padded to 16 bytes
+	// and "xyz"
+	strings := bytes.Index(valid, []byte("xyz")) - 16
+	badOffsets := append([]byte(nil), valid...)
+	binary.LittleEndian.PutUint32(badOffsets[strings+8:], 1000)
+	hugeFooter := append([]byte(nil), valid...)
+	binary.LittleEndian.PutUint32(hugeFooter[len(valid)-10:], 1<<31-1)
+	noFooter := append([]byte(nil), valid...)
+	binary.LittleEndian.PutUint32(noFooter[len(valid)-10:], 0)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"magic only", []byte(columnarMagic + columnarMagic)},
+		{"no trailing magic", valid[:len(valid)-1]},
+		{"huge footer length", hugeFooter},
+		{"no footer", noFooter},
+		{"string offsets", badOffsets},
+	}
+	for _, tt := range tests {
+		if err := readAll(tt.data); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+
+	// no truncation or flipped byte may panic
+	for i := range valid {
+		readAll(valid[:i])
+		data := append([]byte(nil), valid...)
+		data[i] ^= 0xff
+		readAll(data)
+	}
+}
@@ -0,0 +1,469 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Config describes a simulation: the registered model, its parameters,
+// the landscape, the scheduler, the outputs and the seed. It is read from a
+// JSON, YAML or TOML file, e.g.
+//
+//	model: axelrod
+//	seed: 42
+//	steps: 1000
+//	scheduler: sequential
+//	params: {traits: 5, features: 10}
+//	landscape: {type: flnm, size: 20}
+//	output: {dir: out, format: jsonl}
+//
+// and the values can be overridden by flags, see RegisterFlags.
+type Config struct {
+	Model     string          `json:"model,omitempty" yaml:"model,omitempty" toml:"model,omitempty"` // name of a registered model
+	Params    ParamSet        `json:"params,omitempty" yaml:"params,omitempty" toml:"params,omitempty"`
+	Landscape LandscapeConfig `json:"landscape" yaml:"landscape" toml:"landscape"`
+	Scheduler string          `json:"scheduler,omitempty" yaml:"scheduler,omitempty" toml:"scheduler,omitempty"` // random (default) or sequential
+	Steps     int             `json:"steps,omitempty" yaml:"steps,omitempty" toml:"steps,omitempty"`             // stop after this many steps, no limit if 0
+	Seed      int64           `json:"seed,omitempty" yaml:"seed,omitempty" toml:"seed,omitempty"`                // from the clock if 0
+	Output    OutputConfig    `json:"output" yaml:"output" toml:"output"`
+}
+
+// LandscapeConfig selects and sizes the landscape
+type LandscapeConfig struct {
+	Type   string  `json:"type" yaml:"type" toml:"type"`                                     // flnm (2d grid), flwm (2d space), flwm3d (3d space) or raster
+	Size   int     `json:"size" yaml:"size" toml:"size"`                                     // not used by raster
+	Agents int     `json:"agents,omitempty" yaml:"agents,omitempty" toml:"agents,omitempty"` // flwm and flwm3d
+	Sight  float64 `json:"sight,omitempty" yaml:"sight,omitempty" toml:"sight,omitempty"`    // flwm and flwm3d
+	Path   string  `json:"path,omitempty" yaml:"path,omitempty" toml:"path,omitempty"`       // raster file (.asc or .tif) of raster
+}
+
+// OutputConfig are the outputs of the simulation, they correspond to the
+// abst flags of InitFlags
+type OutputConfig struct {
+	Dir        string `json:"dir" yaml:"dir" toml:"dir"`
+	Format     string `json:"format" yaml:"format" toml:"format"`
+	StdOut     bool   `json:"stdout" yaml:"stdout" toml:"stdout"` // log the model fields, to stdout or the log file
+	LogToFile  bool   `json:"logtofile" yaml:"logtofile" toml:"logtofile"`
+	Journal    bool   `json:"journal" yaml:"journal" toml:"journal"`
+	JournalZip bool   `json:"journalzip" yaml:"journalzip" toml:"journalzip"`
+	Snapshot   int    `json:"snapshot" yaml:"snapshot" toml:"snapshot"`
+	RunID      string `json:"runid,omitempty" yaml:"runid,omitempty" toml:"runid,omitempty"`
+	Catalog    bool   `json:"catalog" yaml:"catalog" toml:"catalog"`
+}
+
+// DefaultConfig returns the configuration which is used for the values a
+// file does not set, they are the defaults of the flags
+func DefaultConfig() *Config {
+	return &Config{
+		Landscape: LandscapeConfig{Type: "flnm", Size: 10, Agents: 100, Sight: 1},
+		Scheduler: RandomScheduler.String(),
+		Output: OutputConfig{
+			Dir:        "out",
+			Format:     "csv",
+			JournalZip: true,
+			Catalog:    true,
+		},
+	}
+}
+
+// configFormat returns the format of a config file from its extension
+func configFormat(path string) (string, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		return "json", nil
+	case ".yaml", ".yml":
+		return "yaml", nil
+	case ".toml":
+		return "toml", nil
+	default:
+		return "", fmt.Errorf("config: unknown format %q of %s", ext, path)
+	}
+}
+
+// LoadConfig reads a JSON, YAML or TOML file depending on its extension,
+// the values which are not in the file are taken from the defaults of the
+// model if it is registered and from DefaultConfig otherwise
+func LoadConfig(path string) (*Config, error) {
+	format, err := configFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := ParseConfig(b, format)
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// ParseConfig decodes a configuration in the format json, yaml or toml,
+// the model has to be registered if it is set
+func ParseConfig(b []byte, format string) (*Config, error) {
+	c := DefaultConfig()
+	if err := decodeConfig(b, format, c); err != nil {
+		return nil, err
+	}
+	if c.Model != "" {
+		info, err := LookupModel(c.Model)
+		if err != nil {
+			return nil, fmt.Errorf("config: %v", err)
+		}
+		// decode again on top of the defaults of the model
+		c = info.Config()
+		if err := decodeConfig(b, format, c); err != nil {
+			return nil, err
+		}
+		if err := c.convertParams(info); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// decodeConfig decodes strictly, keys which are not fields of the
+// configuration are errors, e.g. misspelled ones
+func decodeConfig(b []byte, format string, c *Config) error {
+	switch format {
+	case "json":
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.DisallowUnknownFields()
+		return d.Decode(c)
+	case "yaml":
+		return yaml.UnmarshalStrict(b, c)
+	case "toml":
+		md, err := toml.Decode(string(b), c)
+		if err != nil {
+			return err
+		}
+		if keys := md.Undecoded(); len(keys) > 0 {
+			return fmt.Errorf("unknown keys %v", keys)
+		}
+		return nil
+	}
+	return fmt.Errorf("config: unknown format %q", format)
+}
+
+// convertParams checks the parameters against the schema of the model and
+// converts them to the types of the parameters, so all formats give the
+// same values. The names may be the names of the parameters or their
+// flags, they are kept by the name of the parameter.
+func (c *Config) convertParams(info *ModelInfo) error {
+	p, err := info.Schema()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(c.Params))
+	for name := range c.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var s *ParamSpec
+		if p != nil {
+			s = p.Spec(name)
+		}
+		if s == nil {
+			return fmt.Errorf("unknown parameter %s", name)
+		}
+		x, err := s.Convert(c.Params[name])
+		if err != nil {
+			return err
+		}
+		delete(c.Params, name)
+		c.Params[s.Name] = x
+	}
+	return nil
+}
+
+// Save writes the configuration, the format depends on the extension
+func (c *Config) Save(path string) error {
+	format, err := configFormat(path)
+	if err != nil {
+		return err
+	}
+	var b []byte
+	switch format {
+	case "json":
+		b, err = json.MarshalIndent(c, "", "  ")
+	case "yaml":
+		b, err = yaml.Marshal(c)
+	case "toml":
+		var buf bytes.Buffer
+		err = toml.NewEncoder(&buf).Encode(c)
+		b = buf.Bytes()
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+// check validates the values which are not checked by the model
+func (c *Config) check() error {
+	if _, err := ParseScheduler(c.Scheduler); err != nil {
+		return err
+	}
+	if _, err := c.Landscape.New(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// New creates the landscape, a raster is loaded here so a missing or
+// invalid file is an error of the configuration
+func (l LandscapeConfig) New() (Landscaper, error) {
+	if l.Type == "raster" {
+		if l.Path == "" {
+			return nil, fmt.Errorf("config: the raster landscape needs a path")
+		}
+		r, err := LoadRaster(l.Path)
+		if err != nil {
+			return nil, fmt.Errorf("config: %v", err)
+		}
+		return &RasterLandscape{File: l.Path, Raster: r}, nil
+	}
+	if l.Size <= 0 {
+		return nil, fmt.Errorf("config: the size of the landscape has to be positive")
+	}
+	switch l.Type {
+	case "", "flnm":
+		return &FixedLandscapeNoMovement{Size: l.Size}, nil
+	case "flwm":
+		return &FixedLandscapeWithMovement{Size: l.Size, NAgents: l.Agents, Sight: l.Sight}, nil
+	case "flwm3d":
+		return &FixedLandscapeWithMovement3D{Size: l.Size, NAgents: l.Agents, Sight: l.Sight}, nil
+	}
+	return nil, fmt.Errorf("config: unknown landscape %q, use flnm, flwm, flwm3d or raster", l.Type)
+}
+
+// globalOutput returns the global output settings of the library, set by
+// the abst flags
+func globalOutput() OutputConfig {
+	return OutputConfig{
+		Dir:        OutputDir,
+		Format:     LogFormat,
+		LogToFile:  LogToFile,
+		Journal:    JournaledSimulation,
+		JournalZip: JournaledSimulationZip,
+		Snapshot:   SnapshotInterval,
+		RunID:      RunID,
+		Catalog:    Catalogue,
+	}
+}
+
+// Simulation applies the parameters to the model and creates a simulation
+// of it with the outputs of the configuration, the global output settings
+// are left alone.
+func (c *Config) Simulation(model Modeler) (*Simulation, error) {
+	if len(c.Params) > 0 {
+		if err := ApplyParams(model, c.Params); err != nil {
+			return nil, err
+		}
+	}
+	ls, err := c.Landscape.New()
+	if err != nil {
+		return nil, err
+	}
+	sched, err := ParseScheduler(c.Scheduler)
+	if err != nil {
+		return nil, err
+	}
+	out := c.Output
+	return &Simulation{
+		Landscape:     ls,
+		Model:         model,
+		Log:           Logger{StdOut: c.Output.StdOut},
+		AbstInterface: Abst{RunID: c.Output.RunID},
+		Output:        &out,
+		Seed:          c.Seed,
+		Scheduler:     sched,
+	}, nil
+}
+
+// Batch returns a batch runner of the model over the ranges. Every run
+// creates a model with newModel, applies the parameters of the
+// configuration and then the ones of the run. The runs and the results
+// are written to the output dir of the configuration.
+func (c *Config) Batch(newModel func() Modeler, ranges []Range) *Batch {
+	return &Batch{
+		Params: ranges,
+		Seed:   c.Seed,
+		Steps:  c.Steps,
+		Output: filepath.Join(c.Output.Dir, "batch.csv"),
+		Build: func(p ParamSet, seed int64) (*Simulation, error) {
+			model := newModel()
+			sim, err := c.Simulation(model)
+			if err != nil {
+				return nil, err
+			}
+			if err := ApplyParams(model, p); err != nil {
+				return nil, err
+			}
+			return sim, nil
+		},
+	}
+}
+
+// StopConditions returns the stop conditions of the configuration
+func (c *Config) StopConditions() []StopCondition {
+	if c.Steps > 0 {
+		return []StopCondition{MaxSteps(c.Steps)}
+	}
+	return nil
+}
+
+// paramValue sets a model parameter of the configuration from a flag
+type paramValue struct {
+	c    *Config
+	spec *ParamSpec
+}
+
+func (v paramValue) String() string {
+	if v.c == nil {
+		return ""
+	}
+	if x, ok := v.c.Params[v.spec.Name]; ok {
+		return fmt.Sprint(x)
+	}
+	return fmt.Sprint(v.spec.Default)
+}
+
+func (v paramValue) Set(s string) error {
+	x, err := v.spec.Convert(s)
+	if err != nil {
+		return err
+	}
+	if v.c.Params == nil {
+		v.c.Params = make(ParamSet)
+	}
+	v.c.Params[v.spec.Name] = x
+	return nil
+}
+
+func (v paramValue) IsBoolFlag() bool {
+	return v.spec != nil && v.spec.Type == BoolParam
+}
+
+// paramsValue sets any parameter of the configuration with name=value
+type paramsValue struct {
+	c      *Config
+	params *Params
+}
+
+func (v paramsValue) String() string { return "" }
+
+func (v paramsValue) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("%q is not name=value", s)
+	}
+	if v.c.Params == nil {
+		v.c.Params = make(ParamSet)
+	}
+	name, value := s[:i], interface{}(s[i+1:])
+	if v.params != nil {
+		spec := v.params.Spec(name)
+		if spec == nil {
+			return fmt.Errorf("unknown parameter %s", name)
+		}
+		x, err := spec.Convert(value)
+		if err != nil {
+			return err
+		}
+		name, value = spec.Name, x
+	}
+	v.c.Params[name] = value
+	return nil
+}
+
+// RegisterFlags adds flags to fs which override the configuration, so a
+// program loads the file first and parses the flags afterwards. The
+// parameters of params get a flag each, any parameter can be set with
+// -param name=value. Parameters are kept by their name, not the flag name.
+// The output flags have the names of the flags of
+// InitFlags, so both can not be registered on the same set.
+func (c *Config) RegisterFlags(fs *flag.FlagSet, params *Params) {
+	fs.Var(paramsValue{c, params}, "param", "set a model parameter, name=value")
+	if params != nil {
+		// the file may use the flag names, flags use the parameter names
+		for name, x := range c.Params {
+			if spec := params.Spec(name); spec != nil && spec.Name != name {
+				delete(c.Params, name)
+				c.Params[spec.Name] = x
+			}
+		}
+		for i := range params.Specs {
+			s := &params.Specs[i]
+			if fs.Lookup(s.Flag) == nil {
+				fs.Var(paramValue{c, s}, s.Flag, s.usage())
+			}
+		}
+	}
+	fs.Int64Var(&c.Seed, "seed", c.Seed, "seed of the random number generator, from the clock if 0")
+	fs.IntVar(&c.Steps, "steps", c.Steps, "number of steps, no limit if 0")
+	fs.StringVar(&c.Scheduler, "scheduler", c.Scheduler, "order of the agents: random or sequential")
+	fs.StringVar(&c.Landscape.Type, "landscape", c.Landscape.Type, "landscape: flnm, flwm, flwm3d or raster")
+	fs.IntVar(&c.Landscape.Size, "size", c.Landscape.Size, "size (width/height) of the landscape")
+	fs.IntVar(&c.Landscape.Agents, "agents", c.Landscape.Agents, "number of agents of flwm and flwm3d")
+	fs.Float64Var(&c.Landscape.Sight, "sight", c.Landscape.Sight, "radius in which agents interact in flwm and flwm3d")
+	fs.StringVar(&c.Landscape.Path, "raster", c.Landscape.Path, "raster file (.asc or .tif) of the raster landscape")
+	o := &c.Output
+	fs.BoolVar(&o.StdOut, "stdout", o.StdOut, "log the model fields, to stdout or the log file")
+	fs.BoolVar(&o.Journal, "abst.journal", o.Journal, "log all simulation states (agent moves)")
+	fs.BoolVar(&o.JournalZip, "abst.journal.zip", o.JournalZip, "zip the log")
+	fs.BoolVar(&o.LogToFile, "abst.logtofile", o.LogToFile, "log aggregated states to file in abst.out")
+	fs.StringVar(&o.Format, "abst.logformat", o.Format, "format of the log and snapshots: csv, tsv, jsonl or arrow (Arrow IPC)")
+	fs.IntVar(&o.Snapshot, "abst.snapshot", o.Snapshot, "write a snapshot of all agents to abst.out every n steps, never if 0")
+	fs.StringVar(&o.Dir, "abst.out", o.Dir, "output dir")
+	fs.StringVar(&o.RunID, "abst.runid", o.RunID, "id of the run, unique if not provided")
+	fs.BoolVar(&o.Catalog, "abst.catalog", o.Catalog, "add every run to the results catalogue in abst.out")
+}
+
+// Scheduler is the order in which the agents act during a step
+type Scheduler int
+
+const (
+	RandomScheduler     Scheduler = iota // a new random order every step
+	SequentialScheduler                  // the order of the landscape
+)
+
+func (s Scheduler) String() string {
+	switch s {
+	case RandomScheduler:
+		return "random"
+	case SequentialScheduler:
+		return "sequential"
+	}
+	return "scheduler(" + strconv.Itoa(int(s)) + ")"
+}
+
+// ParseScheduler returns the scheduler with the name, random if empty
+func ParseScheduler(name string) (Scheduler, error) {
+	switch name {
+	case "", "random":
+		return RandomScheduler, nil
+	case "sequential":
+		return SequentialScheduler, nil
+	}
+	return 0, fmt.Errorf("unknown scheduler %q, use random or sequential", name)
+}
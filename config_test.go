@@ -0,0 +1,205 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var registerConfigModel sync.Once
+
+// configModel registers the paramModel as "config-test"
+func configModel() {
+	registerConfigModel.Do(func() {
+		RegisterModel(ModelInfo{Name: "config-test", New: func() Modeler { return &paramModel{} }})
+	})
+}
+
+// the same configuration in every format, with parameters by their name
+// and by their flag
+var configs = map[string]string{
+	"json": `{
+	"model": "config-test",
+	"seed": 42,
+	"steps": 100,
+	"scheduler": "sequential",
+	"params": {"traits": 5, "Noise": 0.25, "rule": "sequential", "media": true},
+	"landscape": {"type": "flwm", "size": 20, "agents": 50, "sight": 2},
+	"output": {"dir": "results", "format": "jsonl", "snapshot": 10}
+}`,
+	"yaml": `model: config-test
+seed: 42
+steps: 100
+scheduler: sequential
+params: {traits: 5, Noise: 0.25, rule: sequential, media: true}
+landscape: {type: flwm, size: 20, agents: 50, sight: 2}
+output: {dir: results, format: jsonl, snapshot: 10}
+`,
+	"toml": `model = "config-test"
+seed = 42
+steps = 100
+scheduler = "sequential"
+
+[params]
+traits = 5
+Noise = 0.25
+rule = "sequential"
+media = true
+
+[landscape]
+type = "flwm"
+size = 20
+agents = 50
+sight = 2.0
+
+[output]
+dir = "results"
+format = "jsonl"
+snapshot = 10
+`,
+}
+
+func TestConfigFormats(t *testing.T) {
+	configModel()
+	want := DefaultConfig()
+	want.Model, want.Seed, want.Steps, want.Scheduler = "config-test", 42, 100, "sequential"
+	want.Params = ParamSet{"Traits": 5, "Noise": 0.25, "Rule": "sequential", "Media": true}
+	want.Landscape = LandscapeConfig{Type: "flwm", Size: 20, Agents: 50, Sight: 2}
+	want.Output.Dir, want.Output.Format, want.Output.Snapshot = "results", "jsonl", 10
+
+	dir := t.TempDir()
+	for format, text := range configs {
+		path := filepath.Join(dir, "config."+format)
+		if err := os.WriteFile(path, []byte(text), 0600); err != nil {
+			t.Fatal(err)
+		}
+		c, err := LoadConfig(path)
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		if !reflect.DeepEqual(c, want) {
+			t.Errorf("%s: got %+v, want %+v", format, c, want)
+		}
+
+		// a saved configuration loads again
+		saved := filepath.Join(dir, "saved."+format)
+		if err := c.Save(saved); err != nil {
+			t.Fatal(err)
+		}
+		if again, err := LoadConfig(saved); err != nil || !reflect.DeepEqual(again, want) {
+			t.Errorf("%s: saved and loaded %+v, %v", format, again, err)
+		}
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	configModel()
+	tests := []struct {
+		format, text string
+		err          string // part of the error
+	}{
+		{"json", `{"model": "config-test", "stepz": 10}`, "stepz"},
+		{"yaml", "model: config-test\nstepz: 10\n", "stepz"},
+		{"toml", "model = \"config-test\"\nstepz = 10\n", "stepz"},
+		{"json", `{"landscape": {"type": "flnm", "sizes": 10}}`, "sizes"},
+		{"yaml", "landscape: {type: flnm, sizes: 10}\n", "sizes"},
+		{"toml", "[landscape]\ntype = \"flnm\"\nsizes = 10\n", "sizes"},
+		{"json", `{"steps": "ten"}`, "steps"},
+		{"yaml", "steps: ten\n", "ten"},
+		{"toml", "steps = \"ten\"\n", "steps"},
+		{"json", `{"model": "config-test", "params": {"colors": 3}}`, "unknown parameter colors"},
+		{"yaml", "model: config-test\nparams: {traits: many}\n", "not an integer"},
+		{"toml", "model = \"config-test\"\n[params]\ntraits = 1\n", "less than the minimum"},
+		{"json", `{"scheduler": "parallel"}`, "unknown scheduler"},
+		{"yaml", "landscape: {type: hex}\n", "unknown landscape"},
+		{"yaml", "landscape: {type: raster}\n", "needs a path"},
+		{"json", `{"landscape": {"type": "raster", "path": "testdata/missing.asc"}}`, "missing.asc"},
+		{"json", `{"model": "no-such-model"}`, "unknown model"},
+		{"toml", "model = \"no-such-model\"\n", "unknown model"},
+	}
+	for _, tt := range tests {
+		_, err := ParseConfig([]byte(tt.text), tt.format)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s %q: got the error %v, want %q", tt.format, tt.text, err, tt.err)
+		}
+	}
+}
+
+func TestConfigRaster(t *testing.T) {
+	c, err := ParseConfig([]byte("landscape: {type: raster, path: testdata/small.asc}\n"), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls, err := c.Landscape.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, ok := ls.(*RasterLandscape)
+	if !ok || l.File != "testdata/small.asc" || l.Raster == nil {
+		t.Fatalf("got the landscape %+v", ls)
+	}
+	// the size does not matter, the raster has five cells with data
+	l.Init(&testModel{})
+	if n := len(*l.GetAgents()); n != 5 {
+		t.Errorf("%d agents, want 5", n)
+	}
+}
+
+func TestConfigOutputs(t *testing.T) {
+	configModel()
+	withOutputDir(t, func(global string) {
+		c := DefaultConfig()
+		c.Model, c.Steps = "config-test", 2
+		c.Output.Dir, c.Output.RunID, c.Output.Snapshot = t.TempDir(), "cfg", 1
+		c.Output.LogToFile, c.Output.StdOut, c.Output.Format = true, true, "tsv"
+		before := globalOutput()
+		sim, err := c.Simulation(&paramModel{Traits: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sim.Run(c.StopConditions()...)
+		if after := globalOutput(); after != before {
+			t.Errorf("the global outputs changed from %+v to %+v", before, after)
+		}
+		// the run is in the output dir of the configuration
+		run := filepath.Join(c.Output.Dir, "goabm.cfg")
+		for _, name := range []string{"log", "agents.tsv", CatalogFile} {
+			dir := run
+			if name == CatalogFile {
+				dir = c.Output.Dir
+			}
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Error(err)
+			}
+		}
+		if tab, err := ReadTable(filepath.Join(run, "log")); err != nil || tab.Len() != 2 {
+			t.Errorf("log: %v, %v", tab, err)
+		}
+		if entries, _ := os.ReadDir(global); len(entries) != 0 {
+			t.Errorf("the global output dir holds %d files", len(entries))
+		}
+
+		// the runs and the results of a batch too
+		b := c.Batch(func() Modeler { return &paramModel{Traits: 5} }, []Range{Values("Noise", 0.0, 0.5)})
+		if _, err := b.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if b.ResultsPath() != filepath.Join(c.Output.Dir, "batch.csv") {
+			t.Errorf("the results are in %s", b.ResultsPath())
+		}
+		if runs, _ := filepath.Glob(filepath.Join(c.Output.Dir, "goabm.cfg.*")); len(runs) != 2 {
+			t.Errorf("the runs of the batch are %v", runs)
+		}
+		if after := globalOutput(); after != before {
+			t.Errorf("the global outputs changed from %+v to %+v", before, after)
+		}
+	})
+}
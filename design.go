@@ -0,0 +1,234 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+)
+
+// Dimension is a parameter explored by a design, values are drawn from
+// [Min,Max], integer parameters take every value in [Min,Max] with the
+// same probability
+type Dimension struct {
+	Name    string  `json:"name"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Integer bool    `json:"integer,omitempty"`
+}
+
+// Value maps u from [0,1) to a value of the parameter, an int for integer
+// parameters and a float64 otherwise
+func (d Dimension) Value(u float64) interface{} {
+	if d.Integer {
+		v := int(math.Floor(d.Min + u*(d.Max-d.Min+1)))
+		if v > int(d.Max) {
+			v = int(d.Max)
+		}
+		return v
+	}
+	return d.Min + u*(d.Max-d.Min)
+}
+
+// Sampler generates n points in the unit hypercube [0,1)^dim
+type Sampler interface {
+	Name() string
+	Sample(n, dim int, r *rand.Rand) ([][]float64, error)
+}
+
+// RandomUniform samples every coordinate independently
+type RandomUniform struct{}
+
+func (RandomUniform) Name() string { return "uniform" }
+
+func (RandomUniform) Sample(n, dim int, r *rand.Rand) ([][]float64, error) {
+	points := make([][]float64, n)
+	for i := range points {
+		points[i] = make([]float64, dim)
+		for j := range points[i] {
+			points[i][j] = r.Float64()
+		}
+	}
+	return points, nil
+}
+
+// LatinHypercube divides every dimension into n strata and puts exactly
+// one point into each stratum of each dimension
+type LatinHypercube struct{}
+
+func (LatinHypercube) Name() string { return "lhs" }
+
+func (LatinHypercube) Sample(n, dim int, r *rand.Rand) ([][]float64, error) {
+	points := make([][]float64, n)
+	for i := range points {
+		points[i] = make([]float64, dim)
+	}
+	for j := 0; j < dim; j++ {
+		for i, stratum := range r.Perm(n) {
+			points[i][j] = (float64(stratum) + r.Float64()) / float64(n)
+		}
+	}
+	return points, nil
+}
+
+// Sobol is the Sobol quasi-random sequence with the direction numbers of
+// Joe and Kuo, for up to 16 dimensions. The first point (the origin) is
+// left out, the sequence is deterministic and does not use the seed.
+type Sobol struct{}
+
+func (Sobol) Name() string { return "sobol" }
+
+// primitive polynomials (degree s, coefficients a) and initial direction
+// numbers m of the dimensions 2 to 16 (S. Joe and F. Y. Kuo, 2008)
+var sobolDirections = []struct {
+	s, a uint32
+	m    []uint32
+}{
+	{1, 0, []uint32{1}},
+	{2, 1, []uint32{1, 3}},
+	{3, 1, []uint32{1, 3, 1}},
+	{3, 2, []uint32{1, 1, 1}},
+	{4, 1, []uint32{1, 1, 3, 3}},
+	{4, 4, []uint32{1, 3, 5, 13}},
+	{5, 2, []uint32{1, 1, 5, 5, 17}},
+	{5, 4, []uint32{1, 1, 5, 5, 5}},
+	{5, 7, []uint32{1, 1, 7, 11, 19}},
+	{5, 11, []uint32{1, 1, 5, 1, 1}},
+	{5, 13, []uint32{1, 1, 1, 3, 11}},
+	{5, 14, []uint32{1, 3, 5, 5, 31}},
+	{6, 1, []uint32{1, 3, 3, 9, 7, 49}},
+	{6, 13, []uint32{1, 1, 1, 15, 21, 21}},
+	{6, 16, []uint32{1, 3, 1, 13, 27, 49}},
+}
+
+const sobolBits = 32
+
+func (Sobol) Sample(n, dim int, r *rand.Rand) ([][]float64, error) {
+	if dim > len(sobolDirections)+1 {
+		return nil, fmt.Errorf("sobol: at most %d dimensions are supported", len(sobolDirections)+1)
+	}
+	if n >= 1<<sobolBits-1 {
+		return nil, fmt.Errorf("sobol: too many points")
+	}
+
+	// direction numbers v[j][k], scaled to 32 bits
+	v := make([][sobolBits + 1]uint32, dim)
+	for j := 0; j < dim; j++ {
+		if j == 0 {
+			for k := 1; k <= sobolBits; k++ {
+				v[0][k] = 1 << uint(sobolBits-k)
+			}
+			continue
+		}
+		d := sobolDirections[j-1]
+		s := int(d.s)
+		for k := 1; k <= sobolBits && k <= s; k++ {
+			v[j][k] = d.m[k-1] << uint(sobolBits-k)
+		}
+		for k := s + 1; k <= sobolBits; k++ {
+			v[j][k] = v[j][k-s] ^ (v[j][k-s] >> uint(s))
+			for i := 1; i < s; i++ {
+				if (d.a>>uint(s-1-i))&1 == 1 {
+					v[j][k] ^= v[j][k-i]
+				}
+			}
+		}
+	}
+
+	points := make([][]float64, n)
+	x := make([]uint32, dim)
+	for i := 1; i <= n; i++ {
+		// Gray code: flip the direction number of the lowest zero bit of i-1
+		c := 1
+		for b := i - 1; b&1 == 1; b >>= 1 {
+			c++
+		}
+		p := make([]float64, dim)
+		for j := range x {
+			x[j] ^= v[j][c]
+			p[j] = float64(x[j]) / math.Exp2(sobolBits)
+		}
+		points[i-1] = p
+	}
+	return points, nil
+}
+
+// Design is a reproducible set of parameter samples for the batch runner,
+// every sample has its own seed
+type Design struct {
+	Sampler    string      `json:"sampler"`
+	Seed       int64       `json:"seed"`
+	Dimensions []Dimension `json:"dimensions"`
+	Unit       [][]float64 `json:"unit"`  // the samples in the unit hypercube
+	Seeds      []int64     `json:"seeds"` // seed of every sample
+	Samples    []ParamSet  `json:"-"`
+}
+
+// NewDesign draws n samples of the dimensions with the sampler
+func NewDesign(s Sampler, dims []Dimension, n int, seed int64) (*Design, error) {
+	unit, err := s.Sample(n, len(dims), rand.New(rand.NewSource(seed)))
+	if err != nil {
+		return nil, err
+	}
+	return newDesign(s.Name(), dims, unit, seed, 1), nil
+}
+
+// newDesign creates a design from unit samples, consecutive blocks of
+// samples share a seed so their differences are not caused by noise
+func newDesign(name string, dims []Dimension, unit [][]float64, seed int64, block int) *Design {
+	d := &Design{Sampler: name, Seed: seed, Dimensions: dims, Unit: unit}
+	d.Seeds = make([]int64, len(unit))
+	for i := range d.Seeds {
+		d.Seeds[i] = DeriveSeed(seed, i/block)
+	}
+	d.scale()
+	return d
+}
+
+// scale maps the unit samples to parameter values
+func (d *Design) scale() {
+	d.Samples = make([]ParamSet, len(d.Unit))
+	for i, u := range d.Unit {
+		p := make(ParamSet, len(d.Dimensions))
+		for j, dim := range d.Dimensions {
+			p[dim.Name] = dim.Value(u[j])
+		}
+		d.Samples[i] = p
+	}
+}
+
+// Save writes the design as JSON
+func (d *Design) Save(path string) error {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+// LoadDesign reads a design written by Save
+func LoadDesign(path string) (*Design, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d := &Design{}
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, err
+	}
+	if len(d.Seeds) != len(d.Unit) {
+		return nil, fmt.Errorf("design: %d samples but %d seeds", len(d.Unit), len(d.Seeds))
+	}
+	for _, u := range d.Unit {
+		if len(u) != len(d.Dimensions) {
+			return nil, fmt.Errorf("design: sample with %d values for %d dimensions", len(u), len(d.Dimensions))
+		}
+	}
+	d.scale()
+	return d, nil
+}
@@ -0,0 +1,132 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSobolJoeKuo(t *testing.T) {
+	// the first points of the sequence with the Joe-Kuo direction
+	// numbers, without the origin
+	want := [][]float64{
+		{0.5, 0.5, 0.5},
+		{0.75, 0.25, 0.25},
+		{0.25, 0.75, 0.75},
+		{0.375, 0.375, 0.625},
+		{0.875, 0.875, 0.125},
+		{0.625, 0.125, 0.875},
+		{0.125, 0.625, 0.375},
+	}
+	got, err := Sobol{}.Sample(len(want), 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := (Sobol{}).Sample(1, len(sobolDirections)+2, nil); err == nil {
+		t.Error("too many dimensions are accepted")
+	}
+}
+
+func TestSobolStratification(t *testing.T) {
+	const dim = 16
+	points, err := Sobol{}.Sample(1023, dim, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// with the origin, the first 2^k points have one point in each of the
+	// 2^k strata of every dimension
+	points = append([][]float64{make([]float64, dim)}, points...)
+	for k := uint(1); k <= 10; k++ {
+		n := 1 << k
+		for j := 0; j < dim; j++ {
+			seen := make(map[int]bool)
+			for _, p := range points[:n] {
+				seen[int(p[j]*float64(n))] = true
+			}
+			if len(seen) != n {
+				t.Fatalf("dimension %d: the first %d points cover %d strata", j, n, len(seen))
+			}
+		}
+	}
+}
+
+func TestLatinHypercube(t *testing.T) {
+	for _, n := range []int{1, 7, 100} {
+		points, err := LatinHypercube{}.Sample(n, 4, rand.New(rand.NewSource(int64(n))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(points) != n {
+			t.Fatalf("%d points, want %d", len(points), n)
+		}
+		for j := 0; j < 4; j++ {
+			strata := make([]int, n)
+			for _, p := range points {
+				if p[j] < 0 || p[j] >= 1 {
+					t.Fatalf("%v is not in [0,1)", p[j])
+				}
+				strata[int(p[j]*float64(n))]++
+			}
+			for s, c := range strata {
+				if c != 1 {
+					t.Errorf("n=%d, dimension %d: stratum %d has %d points", n, j, s, c)
+				}
+			}
+		}
+	}
+}
+
+func TestDimensionValue(t *testing.T) {
+	tests := []struct {
+		d    Dimension
+		u    float64
+		want interface{}
+	}{
+		{Dimension{Min: 1, Max: 3}, 0, 1.0},
+		{Dimension{Min: 1, Max: 3}, 0.5, 2.0},
+		{Dimension{Min: 1, Max: 3, Integer: true}, 0, 1},
+		{Dimension{Min: 1, Max: 3, Integer: true}, 0.34, 2},
+		{Dimension{Min: 1, Max: 3, Integer: true}, 0.999, 3},
+		{Dimension{Min: 1, Max: 3, Integer: true}, 1, 3},
+	}
+	for _, tt := range tests {
+		if got := tt.d.Value(tt.u); got != tt.want {
+			t.Errorf("%+v at %v: got %v, want %v", tt.d, tt.u, got, tt.want)
+		}
+	}
+}
+
+func TestDesignSaveLoad(t *testing.T) {
+	dims := []Dimension{{Name: "a", Min: 1, Max: 5, Integer: true}, {Name: "b", Min: -1, Max: 1}}
+	for _, s := range []Sampler{RandomUniform{}, LatinHypercube{}, Sobol{}} {
+		d, err := NewDesign(s, dims, 10, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "design.json")
+		if err := d.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		l, err := LoadDesign(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(l, d) {
+			t.Errorf("%s: loaded %+v, saved %+v", s.Name(), l, d)
+		}
+		// the same seed gives the same design
+		again, _ := NewDesign(s, dims, 10, 7)
+		if !reflect.DeepEqual(again, d) {
+			t.Errorf("%s: the design is not reproducible", s.Name())
+		}
+	}
+}
@@ -0,0 +1,226 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// A minimal flatbuffers encoder and decoder for the metadata of Arrow
+// files, see https://flatbuffers.dev/internals/
+
+// fbTable is a table to encode, its fields are scalars or references to
+// a string, a table, a vector of tables or a vector of structs
+type fbTable []fbField
+
+type fbField struct {
+	id    int
+	size  int    // bytes of a scalar
+	value uint64 // value of a scalar
+	ref   interface{}
+}
+
+// fbStructs is a vector of structs of size bytes, aligned to 8 bytes
+type fbStructs struct {
+	size int
+	data []byte
+}
+
+// fbBuild encodes a flatbuffer with the root table. The objects are
+// written front to back, each before the objects it refers to, so all
+// offsets point forward.
+func fbBuild(root fbTable) []byte {
+	b := &fbBuilder{buf: make([]byte, 4)}
+	binary.LittleEndian.PutUint32(b.buf, uint32(b.write(root)))
+	return b.buf
+}
+
+type fbBuilder struct {
+	buf []byte
+}
+
+func (b *fbBuilder) pad(align int) {
+	for len(b.buf)%align != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// ref points the offset at pos to the object at target
+func (b *fbBuilder) ref(pos, target int) {
+	binary.LittleEndian.PutUint32(b.buf[pos:], uint32(target-pos))
+}
+
+// write appends an object and returns its position
+func (b *fbBuilder) write(obj interface{}) int {
+	switch o := obj.(type) {
+	case string:
+		b.pad(4)
+		p := len(b.buf)
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(o)))
+		b.buf = append(append(b.buf, o...), 0)
+		return p
+	case fbStructs:
+		// the elements start 8 byte aligned after the length
+		for len(b.buf)%8 != 4 {
+			b.buf = append(b.buf, 0)
+		}
+		p := len(b.buf)
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(o.data)/o.size))
+		b.buf = append(b.buf, o.data...)
+		return p
+	case []fbTable:
+		b.pad(4)
+		p := len(b.buf)
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(o)))
+		b.buf = append(b.buf, make([]byte, 4*len(o))...)
+		for i, t := range o {
+			b.ref(p+4+4*i, b.write(t))
+		}
+		return p
+	case fbTable:
+		n := 0
+		for _, f := range o {
+			if f.id >= n {
+				n = f.id + 1
+			}
+		}
+		b.pad(2)
+		vt := len(b.buf)
+		b.buf = append(b.buf, make([]byte, 4+2*n)...)
+		b.pad(4)
+		t := len(b.buf)
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(t-vt))
+		pos := make([]int, len(o))
+		for i, f := range o {
+			size := f.size
+			if f.ref != nil {
+				size = 4
+			}
+			b.pad(size)
+			pos[i] = len(b.buf)
+			for k := 0; k < size; k++ {
+				b.buf = append(b.buf, byte(f.value>>uint(8*k)))
+			}
+		}
+		binary.LittleEndian.PutUint16(b.buf[vt:], uint16(4+2*n))
+		binary.LittleEndian.PutUint16(b.buf[vt+2:], uint16(len(b.buf)-t))
+		for i, f := range o {
+			binary.LittleEndian.PutUint16(b.buf[vt+4+2*f.id:], uint16(pos[i]-t))
+		}
+		for i, f := range o {
+			if f.ref != nil {
+				b.ref(pos[i], b.write(f.ref))
+			}
+		}
+		return t
+	}
+	panic(fmt.Sprintf("flatbuffers: cannot encode a %T", obj))
+}
+
+// fbError is panicked by the decoder on invalid data
+type fbError struct {
+	error
+}
+
+var errFlatbuffer = fbError{errors.New("columnar: invalid flatbuffer")}
+
+// fbTableReader decodes a table, every access is checked and panics with
+// an fbError if it is out of bounds
+type fbTableReader struct {
+	b   []byte
+	pos int
+	vt  int // position of the vtable
+}
+
+// fbRoot returns the root table of a flatbuffer
+func fbRoot(b []byte) fbTableReader {
+	r := fbTableReader{b: b}
+	return r.tableAt(int(r.u32(0)))
+}
+
+func (r fbTableReader) bytes(pos, n int) []byte {
+	if pos < 0 || n < 0 || pos > len(r.b) || n > len(r.b)-pos {
+		panic(errFlatbuffer)
+	}
+	return r.b[pos : pos+n]
+}
+
+func (r fbTableReader) u32(pos int) uint32 {
+	return binary.LittleEndian.Uint32(r.bytes(pos, 4))
+}
+
+func (r fbTableReader) tableAt(pos int) fbTableReader {
+	t := fbTableReader{b: r.b, pos: pos, vt: pos - int(int32(r.u32(pos)))}
+	n := int(binary.LittleEndian.Uint16(t.bytes(t.vt, 4)))
+	if n < 4 || n%2 != 0 {
+		panic(errFlatbuffer)
+	}
+	t.bytes(t.vt, n)
+	return t
+}
+
+// field returns the position of a field, 0 if it or the table is not set
+func (r fbTableReader) field(id int) int {
+	if r.b == nil {
+		return 0
+	}
+	n := int(binary.LittleEndian.Uint16(r.b[r.vt:]))
+	if 4+2*id+2 > n {
+		return 0
+	}
+	if off := int(binary.LittleEndian.Uint16(r.b[r.vt+4+2*id:])); off != 0 {
+		return r.pos + off
+	}
+	return 0
+}
+
+// scalar returns a scalar field of size bytes, 0 if it is not set
+func (r fbTableReader) scalar(id, size int) uint64 {
+	p := r.field(id)
+	if p == 0 {
+		return 0
+	}
+	var v uint64
+	for k, c := range r.bytes(p, size) {
+		v |= uint64(c) << uint(8*k)
+	}
+	return v
+}
+
+// table returns a table field
+func (r fbTableReader) table(id int) (fbTableReader, bool) {
+	p := r.field(id)
+	if p == 0 {
+		return fbTableReader{}, false
+	}
+	return r.tableAt(p + int(r.u32(p))), true
+}
+
+// vector returns the position of the first element and the length of a
+// vector field with elements of size bytes
+func (r fbTableReader) vector(id, size int) (int, int) {
+	p := r.field(id)
+	if p == 0 {
+		return 0, 0
+	}
+	p += int(r.u32(p))
+	n := int(r.u32(p))
+	r.bytes(p+4, n*size)
+	return p + 4, n
+}
+
+// vectorTable returns element i of a vector of tables at pos
+func (r fbTableReader) vectorTable(pos, i int) fbTableReader {
+	p := pos + 4*i
+	return r.tableAt(p + int(r.u32(p)))
+}
+
+// string returns a string field, "" if it is not set
+func (r fbTableReader) string(id int) string {
+	pos, n := r.vector(id, 1)
+	return string(r.bytes(pos, n))
+}
@@ -5,7 +5,8 @@ Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
 package goabm
 
 import ("fmt"
- //"math/rand"
+ "math/rand"
+ "time"
 )
 
 // 2d landscape with no movement
@@ -15,6 +16,7 @@ type FixedLandscapeNoMovement struct {
 	Size       int
 	width      int
 	height     int
+	rand       *rand.Rand
 }
 
 type FLNMAgenter interface {
@@ -30,50 +32,52 @@ type FLNMAgent struct {
 }
 
 
+// Position returns the cell of the agent
+func (a *FLNMAgent) Position() []float64 {
+	return []float64{float64(a.X), float64(a.Y)}
+}
+
 func (l *FixedLandscapeNoMovement) Dump() NetworkDump {
 // dump as a network
 nodes := l.UserAgents
 var links []Link  
 
-	for _,a := range l.Agents {
-	     for i:=0;i< 4; i++ {
-	        
-var t FLNMAgent
-	      switch i {
-	case 0: // top
-		t= l._GetAgent(a.X, a.Y+1)
-	case 1: // right
-		t= l._GetAgent(a.X+1, a.Y)
-	case 2: // down
-		t= l._GetAgent(a.X, a.Y-1)
-	case 3: // left
-		t= l._GetAgent(a.X-1, a.Y)
-	default:
-		panic(">3")
-	}
-	if a.ID() != t.ID() {
-	//panic("self link")
-	        link := Link{Source: a.ID(), Target: t.ID()}
-		     links = append(links,link)
-
+	for _, a := range l.Agents {
+		for _, n := range l.Neighbors(a.ID()) {
+			links = append(links, Link{Source: a.ID(), Target: n})
+		}
 	}
-		
-	     }   
 
-	}
-	
 return NetworkDump{Nodes:nodes,Links:links}
 
 }
 
+// GetAgentById returns the agent in constant time, the population of the
+// grid is fixed so an id is the position of the agent in UserAgents
 func (l *FixedLandscapeNoMovement) GetAgentById(id AgentID) Agenter {
-        //fmt.Printf("ga: %v",id)
- 	for i,a := range l.Agents {
- 	 if a.ID() == id {
- 	 return l.UserAgents[i]
- 	 }
- 	}
- 	return nil
+	if id < 0 || int(id) >= len(l.UserAgents) {
+		return nil
+	}
+	return l.UserAgents[id]
+}
+
+// SetRand sets the random number generator used for agent selection
+func (l *FixedLandscapeNoMovement) SetRand(r *rand.Rand) {
+	l.rand = r
+}
+
+func (l *FixedLandscapeNoMovement) RandomAgent() Agenter {
+	return randomAgent(l.rand, l.UserAgents)
+}
+
+// RandomAgents returns k distinct random agents
+func (l *FixedLandscapeNoMovement) RandomAgents(k int) []Agenter {
+	return randomAgents(l.rand, l.UserAgents, k)
+}
+
+// RandomAgentWhere returns a random agent for which match is true, nil if there is none
+func (l *FixedLandscapeNoMovement) RandomAgentWhere(match func(Agenter) bool) Agenter {
+	return randomAgentWhere(l.rand, l.UserAgents, match)
 }
 
 func (l *FixedLandscapeNoMovement) GetAgents() *[]Agenter {
@@ -81,34 +85,49 @@ func (l *FixedLandscapeNoMovement) GetAgents() *[]Agenter {
 	return &l.UserAgents
 }
 
+// GetAgent returns the agent on the cell x/y, outerbounds enter on the
+// opposite side
 func (l *FixedLandscapeNoMovement) GetAgent(x, y int) Agenter {
-	//fmt.Printf("accessing %d/%d\n", x,y)
-	// outerbounds enter on the opposite side
-	if x >= l.width || x < 0 {
-		x = 0
-	}
-	if y >= l.height || y < 0 {
-		y = 0
-	}
-
-	return l.UserAgents[l.width*x+y]
+	return l.UserAgents[l.index(x, y)]
 }
 
 func (l *FixedLandscapeNoMovement) _GetAgent(x, y int) FLNMAgent {
-	if x >= l.width || x < 0 {
-		x = 0
+	return l.Agents[l.index(x, y)]
+}
+
+// index returns the position of the cell x/y in Agents, the agents are
+// stored row by row and the grid wraps around at the borders
+func (l *FixedLandscapeNoMovement) index(x, y int) int {
+	x = (x%l.width + l.width) % l.width
+	y = (y%l.height + l.height) % l.height
+	return y*l.width + x
+}
+
+// Neighbors returns the ids of the agents on the four adjacent cells, the
+// grid wraps around at the borders
+func (l *FixedLandscapeNoMovement) Neighbors(id AgentID) []AgentID {
+	if id < 0 || int(id) >= len(l.Agents) {
+		return nil
 	}
-	if y >= l.height || y < 0 {
-		y = 0
+	a := &l.Agents[id]
+	var neighbors []AgentID
+	for _, d := range [4][2]int{{0, 1}, {1, 0}, {0, -1}, {-1, 0}} {
+		n := l.Agents[l.index(a.X+d[0], a.Y+d[1])].ID()
+		dup := n == id
+		for _, m := range neighbors {
+			dup = dup || m == n
+		}
+		if !dup {
+			neighbors = append(neighbors, n)
+		}
 	}
-
-	return l.Agents[l.width*x+y]
+	return neighbors
 }
 
 func (a *FLNMAgent) GetRandomNeighbor() (AgentID,error) {
         return a.GetRandomLink()
 /*
-	switch choice := rand.Int31n(3); choice {
+	switch choice := a.ls.rand.Int31n(3); choice {
 	case 0: // top
 		return a.ls.GetAgent(a.X, a.Y+1)
 	case 1: // right
@@ -124,6 +143,9 @@ func (a *FLNMAgent) GetRandomNeighbor() (AgentID,error) {
 }
 
 func (l *FixedLandscapeNoMovement) Init(model Modeler) {
+	if l.rand == nil {
+		l.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
 	numAgents := l.Size * l.Size
 	fmt.Printf("Init landscape with %d agents\n", numAgents)
 
@@ -156,9 +178,14 @@ func (l *FixedLandscapeNoMovement) Init(model Modeler) {
 
 	}
 	
-	// connect network
-	for _,a := range l.Agents {
-	 n:= l._GetAgent(a.X,a.Y+1).GenericAgent
-	 a.ConnectTo( n)
+	// connect network, every agent to its right and top neighbor; on a
+	// grid of size 2 both sides are the same agent
+	for _, a := range l.Agents {
+		if l.width > 2 || a.X+1 < l.width {
+			a.ConnectTo(l._GetAgent(a.X+1, a.Y).GenericAgent)
+		}
+		if l.height > 2 || a.Y+1 < l.height {
+			a.ConnectTo(l._GetAgent(a.X, a.Y+1).GenericAgent)
+		}
 	}
 }
@@ -0,0 +1,60 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// the population sizes of the lookup benchmarks, the lookup time has to
+// stay constant
+var benchSizes = []int{1000, 10000, 100000, 1000000}
+
+// benchGetAgentById looks up random agents of the landscape
+func benchGetAgentById(b *testing.B, l Landscaper) {
+	agents := *l.GetAgents()
+	ids := make([]AgentID, 1024)
+	for i := range ids {
+		ids[i] = agents[rand.Intn(len(agents))].ID()
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if l.GetAgentById(ids[i%len(ids)]) == nil {
+			b.Fatal("agent not found")
+		}
+	}
+}
+
+func BenchmarkFLNMGetAgentById(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			// square grid with at least n agents
+			size := 1
+			for size*size < n {
+				size++
+			}
+			l := &FixedLandscapeNoMovement{Size: size}
+			l.Init(&testModel{})
+			benchGetAgentById(b, l)
+		})
+	}
+}
+
+func TestFLNMGetAgentById(t *testing.T) {
+	l := &FixedLandscapeNoMovement{Size: 4}
+	l.Init(&testModel{})
+	for i, a := range *l.GetAgents() {
+		if got := l.GetAgentById(AgentID(i)); got != a {
+			t.Errorf("agent %d: got %v, want %v", i, got, a)
+		}
+	}
+	for _, id := range []AgentID{-1, 16} {
+		if got := l.GetAgentById(id); got != nil {
+			t.Errorf("agent %d: got %v, want nil", id, got)
+		}
+	}
+}
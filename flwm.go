@@ -13,13 +13,15 @@ import vector "github.com/proxypoke/vector"
 
 // 2d landscape with movement
 type FixedLandscapeWithMovement struct {
-	Agents     []FLWMAgent // library agent object, implements neighbor selection etc.
-	UserAgents []Agenter   // agents from the user
+	Agents     []*FLWMAgent // library agent object, implements neighbor selection etc.
+	UserAgents []Agenter    // agents from the user
 	Size       int
 	Sight      float64
 	NAgents    int
 	tree       *qt.Quadtree
 	rand *rand.Rand
+	index      map[AgentID]int // agent id -> position in Agents/UserAgents
+	nextID     AgentID
 }
 
 type FLWMAgenter interface {
@@ -42,6 +44,11 @@ func (a *FLWMAgent) Id() AgentID {
 	return a.Seqnr
 }
 
+// Position returns the coordinates of the agent
+func (a *FLWMAgent) Position() []float64 {
+	return []float64{a.X, a.Y}
+}
+
 func (l *FixedLandscapeWithMovement) Dump() NetworkDump {
 	// dump as a network
 	nodes := l.UserAgents
@@ -72,14 +79,68 @@ func (l *FixedLandscapeWithMovement) GetAgents() *[]Agenter {
 }
 
 func (l *FixedLandscapeWithMovement) GetAgentById(id AgentID) Agenter {
-	for i, a := range l.Agents {
-		if a.Seqnr == id {
-			return l.UserAgents[i]
-		}
+	if i, ok := l.index[id]; ok {
+		return l.UserAgents[i]
 	}
 	return nil
 }
 
+// AddAgent places a new agent created by the model at a random position
+func (l *FixedLandscapeWithMovement) AddAgent(model Modeler) Agenter {
+	a := &FLWMAgent{GenericAgent: &GenericAgent{}, Seqnr: l.nextID, ls: l}
+	a.SetID(l.nextID)
+	l.nextID++
+	a.X = float64(l.rand.Intn(l.Size))
+	a.Y = float64(l.rand.Intn(l.Size))
+
+	l.index[a.Seqnr] = len(l.Agents)
+	l.Agents = append(l.Agents, a)
+	l.UserAgents = append(l.UserAgents, model.CreateAgent(a))
+	l.tree.Add(a, qt.Twof{a.X, a.Y})
+	return l.UserAgents[len(l.UserAgents)-1]
+}
+
+// RemoveAgent takes an agent out of the landscape, the last agent moves
+// into its position in Agents and UserAgents
+func (l *FixedLandscapeWithMovement) RemoveAgent(id AgentID) Agenter {
+	i, ok := l.index[id]
+	if !ok {
+		return nil
+	}
+	removed := l.UserAgents[i]
+	l.tree.Remove(l.Agents[i])
+
+	last := len(l.Agents) - 1
+	l.Agents[i] = l.Agents[last]
+	l.UserAgents[i] = l.UserAgents[last]
+	l.index[l.Agents[i].Seqnr] = i
+	l.Agents[last] = nil
+	l.UserAgents[last] = nil
+	l.Agents = l.Agents[:last]
+	l.UserAgents = l.UserAgents[:last]
+	delete(l.index, id)
+	return removed
+}
+
+// SetRand sets the random number generator used for movement and agent selection
+func (l *FixedLandscapeWithMovement) SetRand(r *rand.Rand) {
+	l.rand = r
+}
+
+func (l *FixedLandscapeWithMovement) RandomAgent() Agenter {
+	return randomAgent(l.rand, l.UserAgents)
+}
+
+// RandomAgents returns k distinct random agents
+func (l *FixedLandscapeWithMovement) RandomAgents(k int) []Agenter {
+	return randomAgents(l.rand, l.UserAgents, k)
+}
+
+// RandomAgentWhere returns a random agent for which match is true, nil if there is none
+func (l *FixedLandscapeWithMovement) RandomAgentWhere(match func(Agenter) bool) Agenter {
+	return randomAgentWhere(l.rand, l.UserAgents, match)
+}
+
 func (l *FixedLandscapeWithMovement) random(min, max float64) float64 {
   return l.rand.Float64() * (max - min) + min
 }
@@ -133,16 +194,34 @@ func (a *FLWMAgent) GetRandomNeighbor() Agenter {
 		return nil
 	}
 
-	choice := rand.Int31n(int32(len(possibleNeighbors)))
+	choice := a.ls.rand.Int31n(int32(len(possibleNeighbors)))
 	i := possibleNeighbors[choice].(*FLWMAgent).Seqnr
 	if i == a.Seqnr {
 		panic("same agent")
 	}
-	return a.ls.UserAgents[i]
+	return a.ls.GetAgentById(i)
+}
+
+// Neighbors returns the ids of the agents in sight
+func (l *FixedLandscapeWithMovement) Neighbors(id AgentID) []AgentID {
+	i, ok := l.index[id]
+	if !ok {
+		return nil
+	}
+	a := l.Agents[i]
+	var neighbors []AgentID
+	for _, v := range l.tree.FindNearObjects(qt.Twof{a.X, a.Y}, l.Sight) {
+		if v.(*FLWMAgent).Seqnr != a.Seqnr {
+			neighbors = append(neighbors, v.(*FLWMAgent).Seqnr)
+		}
+	}
+	return neighbors
 }
 
 func (l *FixedLandscapeWithMovement) Init(model Modeler) {
-	l.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	if l.rand == nil {
+		l.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
 	numAgents := l.NAgents
 	//fmt.Printf("Init landscape with %d agents\n", numAgents)
 
@@ -150,23 +229,27 @@ func (l *FixedLandscapeWithMovement) Init(model Modeler) {
 
 	l.tree = qt.MakeQuadtree(qt.Twof{0, 0}, qt.Twof{float64(l.Size), float64(l.Size)})
 
-	l.Agents = make([]FLWMAgent, numAgents)
+	l.Agents = make([]*FLWMAgent, numAgents)
 	l.UserAgents = make([]Agenter, numAgents)
+	l.index = make(map[AgentID]int, numAgents)
+	l.nextID = AgentID(numAgents)
 	y := 0
 	x := 0
 	for i := range l.Agents {
 		//for i:=0;i<numAgents;i++ {
-		l.UserAgents[i] = model.CreateAgent(&l.Agents[i])
+		l.Agents[i] = &FLWMAgent{}
+		l.index[AgentID(i)] = i
+		l.UserAgents[i] = model.CreateAgent(l.Agents[i])
 
                 l.Agents[i].GenericAgent = &GenericAgent{}
 		l.Agents[i].Seqnr = AgentID(i)
 		l.Agents[i].SetID( AgentID(i) )
-		x = rand.Intn(l.Size)
-		y = rand.Intn(l.Size)
+		x = l.rand.Intn(l.Size)
+		y = l.rand.Intn(l.Size)
 		l.Agents[i].X = float64(x)
 		l.Agents[i].Y = float64(y)
 
-		l.tree.Add(&l.Agents[i], qt.Twof{float64(x), float64(y)})
+		l.tree.Add(l.Agents[i], qt.Twof{float64(x), float64(y)})
 
 		x += 1
 		if x >= l.Size {
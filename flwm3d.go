@@ -0,0 +1,332 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	vector "github.com/proxypoke/vector"
+)
+
+// 3d landscape with movement, for aerial or aquatic agents.
+// The world is a cube of Size^3 which wraps around on every side.
+// Agents are indexed in a uniform 3d grid with cells at least Sight wide,
+// so a sight query only has to look at the neighboring cells.
+type FixedLandscapeWithMovement3D struct {
+	Agents     []*FLWM3DAgent // library agent object, implements neighbor selection etc.
+	UserAgents []Agenter      // agents from the user
+	Size       int
+	Sight      float64
+	NAgents    int
+	cells      [][]*FLWM3DAgent // 3d grid index
+	ncells     int              // number of cells per dimension
+	cellsize   float64
+	rand       *rand.Rand
+	index      map[AgentID]int // agent id -> position in Agents/UserAgents
+	nextID     AgentID
+}
+
+type FLWM3DAgenter interface {
+	GetRandomNeighbor() Agenter
+	MoveRandomly(float64)
+	Id() AgentID
+}
+
+type FLWM3DAgent struct {
+	*GenericAgent
+	Seqnr AgentID                       `json:"index"`
+	X     float64                       `json:"x"`
+	Y     float64                       `json:"y"`
+	Z     float64                       `json:"z"`
+	ls    *FixedLandscapeWithMovement3D `json:"-"`
+	cell  int
+}
+
+func (a *FLWM3DAgent) Id() AgentID {
+	return a.Seqnr
+}
+
+// Position returns the coordinates of the agent
+func (a *FLWM3DAgent) Position() []float64 {
+	return []float64{a.X, a.Y, a.Z}
+}
+
+func (l *FixedLandscapeWithMovement3D) Dump() NetworkDump {
+	// dump as a network, the coordinates are part of the nodes
+	nodes := l.UserAgents
+	var links []Link
+
+	for _, a := range l.Agents {
+		for _, v := range l.findNear(a.X, a.Y, a.Z, l.Sight) {
+			if v.Seqnr != a.Seqnr {
+				links = append(links, Link{Source: a.Seqnr, Target: v.Seqnr})
+			}
+		}
+	}
+
+	return NetworkDump{Nodes: nodes, Links: links}
+}
+
+func (l *FixedLandscapeWithMovement3D) GetAgents() *[]Agenter {
+
+	return &l.UserAgents
+}
+
+func (l *FixedLandscapeWithMovement3D) GetAgentById(id AgentID) Agenter {
+	if i, ok := l.index[id]; ok {
+		return l.UserAgents[i]
+	}
+	return nil
+}
+
+// AddAgent places a new agent created by the model at a random position
+func (l *FixedLandscapeWithMovement3D) AddAgent(model Modeler) Agenter {
+	a := &FLWM3DAgent{GenericAgent: &GenericAgent{}, Seqnr: l.nextID, ls: l}
+	a.SetID(l.nextID)
+	l.nextID++
+	a.X = float64(l.rand.Intn(l.Size))
+	a.Y = float64(l.rand.Intn(l.Size))
+	a.Z = float64(l.rand.Intn(l.Size))
+
+	l.index[a.Seqnr] = len(l.Agents)
+	l.Agents = append(l.Agents, a)
+	l.UserAgents = append(l.UserAgents, model.CreateAgent(a))
+	l.addToGrid(a)
+	return l.UserAgents[len(l.UserAgents)-1]
+}
+
+// RemoveAgent takes an agent out of the landscape, the last agent moves
+// into its position in Agents and UserAgents
+func (l *FixedLandscapeWithMovement3D) RemoveAgent(id AgentID) Agenter {
+	i, ok := l.index[id]
+	if !ok {
+		return nil
+	}
+	removed := l.UserAgents[i]
+	l.removeFromGrid(l.Agents[i])
+
+	last := len(l.Agents) - 1
+	l.Agents[i] = l.Agents[last]
+	l.UserAgents[i] = l.UserAgents[last]
+	l.index[l.Agents[i].Seqnr] = i
+	l.Agents[last] = nil
+	l.UserAgents[last] = nil
+	l.Agents = l.Agents[:last]
+	l.UserAgents = l.UserAgents[:last]
+	delete(l.index, id)
+	return removed
+}
+
+// SetRand sets the random number generator used for movement and agent selection
+func (l *FixedLandscapeWithMovement3D) SetRand(r *rand.Rand) {
+	l.rand = r
+}
+
+func (l *FixedLandscapeWithMovement3D) RandomAgent() Agenter {
+	return randomAgent(l.rand, l.UserAgents)
+}
+
+// RandomAgents returns k distinct random agents
+func (l *FixedLandscapeWithMovement3D) RandomAgents(k int) []Agenter {
+	return randomAgents(l.rand, l.UserAgents, k)
+}
+
+// RandomAgentWhere returns a random agent for which match is true, nil if there is none
+func (l *FixedLandscapeWithMovement3D) RandomAgentWhere(match func(Agenter) bool) Agenter {
+	return randomAgentWhere(l.rand, l.UserAgents, match)
+}
+
+func (l *FixedLandscapeWithMovement3D) random(min, max float64) float64 {
+	return l.rand.Float64()*(max-min) + min
+}
+
+// wrap a coordinate into [0,Size)
+func (l *FixedLandscapeWithMovement3D) wrap(v float64) float64 {
+	bsize := float64(l.Size)
+	v = math.Mod(v, bsize)
+	if v < 0 {
+		v += bsize
+	}
+	if v >= bsize { // rounding of tiny negative values
+		v = 0
+	}
+	return v
+}
+
+// shortest distance along one axis of the wrapped world
+func (l *FixedLandscapeWithMovement3D) axisDist(a, b float64) float64 {
+	d := math.Abs(a - b)
+	if d > float64(l.Size)/2 {
+		d = float64(l.Size) - d
+	}
+	return d
+}
+
+func (l *FixedLandscapeWithMovement3D) cellIndex(x, y, z float64) int {
+	cx := int(x/l.cellsize) % l.ncells
+	cy := int(y/l.cellsize) % l.ncells
+	cz := int(z/l.cellsize) % l.ncells
+	return (cx*l.ncells+cy)*l.ncells + cz
+}
+
+func (l *FixedLandscapeWithMovement3D) addToGrid(a *FLWM3DAgent) {
+	a.cell = l.cellIndex(a.X, a.Y, a.Z)
+	l.cells[a.cell] = append(l.cells[a.cell], a)
+}
+
+func (l *FixedLandscapeWithMovement3D) removeFromGrid(a *FLWM3DAgent) {
+	cell := l.cells[a.cell]
+	for i, v := range cell {
+		if v == a {
+			cell[i] = cell[len(cell)-1]
+			l.cells[a.cell] = cell[:len(cell)-1]
+			return
+		}
+	}
+}
+
+// findNear returns all agents within radius of x/y/z, taking the
+// wrap-around into account
+func (l *FixedLandscapeWithMovement3D) findNear(x, y, z, radius float64) []*FLWM3DAgent {
+	var found []*FLWM3DAgent
+	check := func(cell int) {
+		for _, v := range l.cells[cell] {
+			dx := l.axisDist(x, v.X)
+			dy := l.axisDist(y, v.Y)
+			dz := l.axisDist(z, v.Z)
+			if dx*dx+dy*dy+dz*dz <= radius*radius {
+				found = append(found, v)
+			}
+		}
+	}
+
+	r := int(math.Ceil(radius / l.cellsize))
+	if 2*r+1 >= l.ncells {
+		// the sphere covers the whole world, look at every cell once
+		for i := range l.cells {
+			check(i)
+		}
+		return found
+	}
+
+	n := l.ncells
+	cx := int(x/l.cellsize) % n
+	cy := int(y/l.cellsize) % n
+	cz := int(z/l.cellsize) % n
+	for i := -r; i <= r; i++ {
+		for j := -r; j <= r; j++ {
+			for k := -r; k <= r; k++ {
+				ix := (cx + i + n) % n
+				iy := (cy + j + n) % n
+				iz := (cz + k + n) % n
+				check((ix*n+iy)*n + iz)
+			}
+		}
+	}
+	return found
+}
+
+// FindNearAgents returns the user agents within radius of the given point
+func (l *FixedLandscapeWithMovement3D) FindNearAgents(x, y, z, radius float64) []Agenter {
+	var agents []Agenter
+	for _, v := range l.findNear(l.wrap(x), l.wrap(y), l.wrap(z), radius) {
+		agents = append(agents, l.GetAgentById(v.Seqnr))
+	}
+	return agents
+}
+
+func (a *FLWM3DAgent) MoveRandomly(steplength float64) {
+	//random direction
+	bsize := float64(a.ls.Size)
+	v := vector.NewFrom([]float64{a.ls.random(-bsize, bsize), a.ls.random(-bsize, bsize), a.ls.random(-bsize, bsize)})
+	v.Normalize()
+	v.Scale(steplength)
+	x, _ := v.Get(0)
+	y, _ := v.Get(1)
+	z, _ := v.Get(2)
+
+	a.MoveTo(a.X+x, a.Y+y, a.Z+z)
+}
+
+// MoveTo places the agent at x/y/z, leaving the world on one side
+// reenters it on the opposite side
+func (a *FLWM3DAgent) MoveTo(x, y, z float64) {
+	a.ls.removeFromGrid(a)
+	a.X = a.ls.wrap(x)
+	a.Y = a.ls.wrap(y)
+	a.Z = a.ls.wrap(z)
+	a.ls.addToGrid(a)
+}
+
+func (a *FLWM3DAgent) GetRandomNeighbor() Agenter {
+	var possibleNeighbors []*FLWM3DAgent
+	for _, v := range a.ls.findNear(a.X, a.Y, a.Z, a.ls.Sight) {
+		if v.Seqnr != a.Seqnr {
+			possibleNeighbors = append(possibleNeighbors, v)
+		}
+	}
+	if len(possibleNeighbors) < 1 {
+		return nil
+	}
+
+	choice := a.ls.rand.Intn(len(possibleNeighbors))
+	return a.ls.GetAgentById(possibleNeighbors[choice].Seqnr)
+}
+
+// Neighbors returns the ids of the agents in sight
+func (l *FixedLandscapeWithMovement3D) Neighbors(id AgentID) []AgentID {
+	i, ok := l.index[id]
+	if !ok {
+		return nil
+	}
+	a := l.Agents[i]
+	var neighbors []AgentID
+	for _, v := range l.findNear(a.X, a.Y, a.Z, l.Sight) {
+		if v.Seqnr != a.Seqnr {
+			neighbors = append(neighbors, v.Seqnr)
+		}
+	}
+	return neighbors
+}
+
+func (l *FixedLandscapeWithMovement3D) Init(model Modeler) {
+	if l.rand == nil {
+		l.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	numAgents := l.NAgents
+
+	// equally sized grid cells, at least as large as the sight radius
+	l.ncells = 1
+	if l.Sight > 0 {
+		l.ncells = int(float64(l.Size) / l.Sight)
+	}
+	if l.ncells < 1 {
+		l.ncells = 1
+	}
+	l.cellsize = float64(l.Size) / float64(l.ncells)
+	l.cells = make([][]*FLWM3DAgent, l.ncells*l.ncells*l.ncells)
+
+	l.Agents = make([]*FLWM3DAgent, numAgents)
+	l.UserAgents = make([]Agenter, numAgents)
+	l.index = make(map[AgentID]int, numAgents)
+	l.nextID = AgentID(numAgents)
+	for i := range l.Agents {
+		l.Agents[i] = &FLWM3DAgent{}
+		l.index[AgentID(i)] = i
+		l.UserAgents[i] = model.CreateAgent(l.Agents[i])
+
+		l.Agents[i].GenericAgent = &GenericAgent{}
+		l.Agents[i].Seqnr = AgentID(i)
+		l.Agents[i].SetID(AgentID(i))
+		l.Agents[i].X = float64(l.rand.Intn(l.Size))
+		l.Agents[i].Y = float64(l.rand.Intn(l.Size))
+		l.Agents[i].Z = float64(l.rand.Intn(l.Size))
+		l.Agents[i].ls = l
+
+		l.addToGrid(l.Agents[i])
+	}
+}
@@ -0,0 +1,194 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// newFLWM3D returns an initialized 3d landscape of testAgents
+func newFLWM3D(size, n int, sight float64) (*FixedLandscapeWithMovement3D, *testModel) {
+	m := &testModel{}
+	l := &FixedLandscapeWithMovement3D{Size: size, NAgents: n, Sight: sight}
+	l.SetRand(rand.New(rand.NewSource(1)))
+	l.Init(m)
+	return l, m
+}
+
+// checkGrid reports agents which are missing in the grid cell of their
+// position, are in the grid more than once or should not be in it
+func checkGrid(t *testing.T, l *FixedLandscapeWithMovement3D) {
+	t.Helper()
+	seen := make(map[*FLWM3DAgent]int)
+	for i, cell := range l.cells {
+		for _, a := range cell {
+			seen[a]++
+			if i != l.cellIndex(a.X, a.Y, a.Z) {
+				t.Errorf("agent %d at %v is in the cell %d", a.Seqnr, a.Position(), i)
+			}
+		}
+	}
+	for _, a := range l.Agents {
+		if seen[a] != 1 {
+			t.Errorf("agent %d is %d times in the grid", a.Seqnr, seen[a])
+		}
+		delete(seen, a)
+	}
+	for a := range seen {
+		t.Errorf("agent %d is in the grid but not in the landscape", a.Seqnr)
+	}
+}
+
+func TestFLWM3DWrap(t *testing.T) {
+	l, _ := newFLWM3D(10, 1, 2)
+	a := l.Agents[0]
+	tests := []struct {
+		x, y, z float64
+		want    []float64
+	}{
+		{1, 2, 3, []float64{1, 2, 3}},
+		{-0.5, 10.5, 20, []float64{9.5, 0.5, 0}},
+		{-10, -25, 31, []float64{0, 5, 1}},
+		{-1e-17, 9.999, 0, []float64{0, 9.999, 0}},
+	}
+	for _, tt := range tests {
+		a.MoveTo(tt.x, tt.y, tt.z)
+		for i, v := range a.Position() {
+			if math.Abs(v-tt.want[i]) > 1e-9 || v < 0 || v >= 10 {
+				t.Errorf("moved to %v/%v/%v: at %v, want %v", tt.x, tt.y, tt.z, a.Position(), tt.want)
+				break
+			}
+		}
+		checkGrid(t, l)
+	}
+
+	// the shortest distance is across the edges
+	for _, tt := range []struct{ a, b, want float64 }{{1, 9, 2}, {9, 1, 2}, {2, 6, 4}, {0, 5, 5}} {
+		if d := l.axisDist(tt.a, tt.b); d != tt.want {
+			t.Errorf("distance between %v and %v is %v, want %v", tt.a, tt.b, d, tt.want)
+		}
+	}
+}
+
+// nearIds returns the sorted ids of the agents within radius of x/y/z
+// found by findNear, or by looking at every agent if brute is true
+func nearIds(l *FixedLandscapeWithMovement3D, x, y, z, radius float64, brute bool) []int {
+	var found []*FLWM3DAgent
+	if brute {
+		for _, a := range l.Agents {
+			dx, dy, dz := l.axisDist(x, a.X), l.axisDist(y, a.Y), l.axisDist(z, a.Z)
+			if dx*dx+dy*dy+dz*dz <= radius*radius {
+				found = append(found, a)
+			}
+		}
+	} else {
+		found = l.findNear(x, y, z, radius)
+	}
+	var ids []int
+	for _, a := range found {
+		ids = append(ids, int(a.Seqnr))
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func TestFLWM3DFindNear(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	l, _ := newFLWM3D(20, 300, 2.5)
+	for _, a := range l.Agents {
+		a.MoveTo(r.Float64()*20, r.Float64()*20, r.Float64()*20)
+	}
+	// corners and edges test the wrap-around, the larger radii cover
+	// several or all cells
+	points := [][]float64{{0, 0, 0}, {19.9, 0.1, 10}, {10, 10, 10}, {0.5, 19.5, 19.5}}
+	for i := 0; i < 20; i++ {
+		points = append(points, []float64{r.Float64() * 20, r.Float64() * 20, r.Float64() * 20})
+	}
+	for _, radius := range []float64{0.5, 2.5, 4, 7.5, 15} {
+		for _, p := range points {
+			got := nearIds(l, p[0], p[1], p[2], radius, false)
+			want := nearIds(l, p[0], p[1], p[2], radius, true)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("radius %v at %v: found %v, want %v", radius, p, got, want)
+			}
+		}
+	}
+	if n := len(l.findNear(10, 10, 10, 20)); n != 300 {
+		t.Errorf("%d agents in a sphere around the world, want 300", n)
+	}
+}
+
+func TestFLWM3DMoveTo(t *testing.T) {
+	l, _ := newFLWM3D(10, 2, 1)
+	a, b := l.Agents[0], l.Agents[1]
+	a.MoveTo(0.2, 5, 5)
+	b.MoveTo(9.6, 5, 5)
+	checkGrid(t, l)
+	// the agents see each other across the edge
+	if n := l.Neighbors(a.Seqnr); !reflect.DeepEqual(n, []AgentID{b.Seqnr}) {
+		t.Errorf("the neighbors of a are %v, want [%d]", n, b.Seqnr)
+	}
+	if got := a.GetRandomNeighbor(); got != l.UserAgents[1] {
+		t.Errorf("the random neighbor of a is %v, want b", got)
+	}
+
+	b.MoveTo(5, 5, 5)
+	checkGrid(t, l)
+	if n := l.Neighbors(a.Seqnr); len(n) != 0 {
+		t.Errorf("the neighbors of a are %v after b moved away", n)
+	}
+	if got := a.GetRandomNeighbor(); got != nil {
+		t.Errorf("the random neighbor of a is %v, want nil", got)
+	}
+	if got := l.FindNearAgents(15, 15, 15, 0.5); len(got) != 1 || got[0] != l.UserAgents[1] {
+		t.Errorf("found %v at 15/15/15, want b", got)
+	}
+
+	for i := 0; i < 100; i++ {
+		a.MoveRandomly(3)
+	}
+	checkGrid(t, l)
+}
+
+func TestFLWM3DAddRemoveAgent(t *testing.T) {
+	l, m := newFLWM3D(10, 20, 2)
+	checkGrid(t, l)
+
+	for _, id := range []AgentID{3, 0, 19} {
+		a := l.Agents[l.index[id]]
+		if got := l.RemoveAgent(id); got == nil || got.ID() != id {
+			t.Fatalf("removing %d returned %v", id, got)
+		}
+		checkGrid(t, l)
+		for _, v := range l.findNear(a.X, a.Y, a.Z, 0) {
+			if v.Seqnr == id {
+				t.Errorf("the removed agent %d is found at its position", id)
+			}
+		}
+	}
+	if got := l.RemoveAgent(3); got != nil {
+		t.Errorf("removing 3 again returned %v", got)
+	}
+
+	for i := 0; i < 5; i++ {
+		added := l.AddAgent(m)
+		checkGrid(t, l)
+		a := l.Agents[l.index[added.ID()]]
+		found := false
+		for _, v := range l.findNear(a.X, a.Y, a.Z, 0) {
+			found = found || v == a
+		}
+		if !found {
+			t.Errorf("the added agent %d is not found at its position %v", a.Seqnr, a.Position())
+		}
+	}
+	if len(l.Agents) != 22 || len(l.UserAgents) != 22 {
+		t.Errorf("%d agents and %d user agents, want 22", len(l.Agents), len(l.UserAgents))
+	}
+}
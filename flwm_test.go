@@ -0,0 +1,87 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func BenchmarkFLWMGetAgentById(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			size := 1
+			for size*size < n {
+				size++
+			}
+			m := &testModel{}
+			l := &FixedLandscapeWithMovement{Size: size, NAgents: n, Sight: 1}
+			l.Init(m)
+			b.Run("lookup", func(b *testing.B) {
+				benchGetAgentById(b, l)
+			})
+			// replace a tenth of the population
+			for i := 0; i < n/10; i++ {
+				agents := *l.GetAgents()
+				l.RemoveAgent(agents[rand.Intn(len(agents))].ID())
+				l.AddAgent(m)
+			}
+			b.Run("replaced", func(b *testing.B) {
+				benchGetAgentById(b, l)
+			})
+		})
+	}
+}
+
+func TestGetAgentByIdAfterAddRemove(t *testing.T) {
+	tests := []struct {
+		name string
+		l    DynamicLandscaper
+	}{
+		{"flwm", &FixedLandscapeWithMovement{Size: 10, NAgents: 20, Sight: 1}},
+		{"flwm3d", &FixedLandscapeWithMovement3D{Size: 10, NAgents: 20, Sight: 1}},
+	}
+	for _, tt := range tests {
+		m := &testModel{}
+		tt.l.(RandSetter).SetRand(rand.New(rand.NewSource(1)))
+		tt.l.Init(m)
+
+		removed := make(map[AgentID]bool)
+		for _, id := range []AgentID{0, 7, 19} {
+			if a := tt.l.RemoveAgent(id); a == nil || a.ID() != id {
+				t.Fatalf("%s: removing %d returned %v", tt.name, id, a)
+			}
+			removed[id] = true
+		}
+		var added []Agenter
+		for i := 0; i < 5; i++ {
+			added = append(added, tt.l.AddAgent(m))
+		}
+
+		agents := *tt.l.GetAgents()
+		if len(agents) != 22 {
+			t.Errorf("%s: %d agents, want 22", tt.name, len(agents))
+		}
+		for _, a := range agents {
+			if got := tt.l.GetAgentById(a.ID()); got != a {
+				t.Errorf("%s: agent %d: got %v, want %v", tt.name, a.ID(), got, a)
+			}
+		}
+		for _, a := range added {
+			if removed[a.ID()] {
+				t.Errorf("%s: the id %d of a removed agent was reused", tt.name, a.ID())
+			}
+			if tt.l.GetAgentById(a.ID()) != a {
+				t.Errorf("%s: added agent %d not found", tt.name, a.ID())
+			}
+		}
+		for id := range removed {
+			if got := tt.l.GetAgentById(id); got != nil {
+				t.Errorf("%s: removed agent %d: got %v, want nil", tt.name, id, got)
+			}
+		}
+	}
+}
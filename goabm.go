@@ -22,11 +22,8 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package goabm
 
 import ("math/rand"
- "reflect"
  "fmt"
 "os"
-"runtime"
- "encoding/json"
  "time"
 
 )
@@ -52,6 +49,15 @@ type Landscaper interface {
 	Dump() NetworkDump //TODO: cleanup dump and use streams
 	GetAgentById(AgentID) Agenter
 	RandomAgent() Agenter
+	RandomAgents(k int) []Agenter
+	RandomAgentWhere(func(Agenter) bool) Agenter
+}
+
+// landscapes whose population can change during a simulation
+type DynamicLandscaper interface {
+	Landscaper
+	AddAgent(Modeler) Agenter
+	RemoveAgent(AgentID) Agenter
 }
 
 type Model struct {
@@ -63,6 +69,17 @@ func (m *Model) InitRand() {
 	m._rand = rand.New(rand.NewSource(time.Now().UnixNano()))
 }
 
+// SetRand replaces the random number generator with the one of the simulation
+func (m *Model) SetRand(r *rand.Rand) {
+	m._rand = r
+}
+
+// Rand returns the random number generator of the model, the one of the
+// simulation once it is initialised
+func (m *Model) Rand() *rand.Rand {
+	return m._rand
+}
+
 func (m *Model) Random(min, max float64) float64 {
   return m._rand.Float64() * (max - min) + min
 }
@@ -81,6 +98,8 @@ return false
 }
 
 
+// Ruleset is a set of named boolean rules.
+// Deprecated: use typed parameters, see Params.
 type Ruleset struct {
         Rules map[string]bool
 }
@@ -117,106 +136,214 @@ type Simulation struct {
 	Stats     Statistics
 	Model     Modeler
 	Log Logger
+	Collector *DataCollector // optional, collects reporters into tables
+	Snapshots *DataCollector // agent snapshots, see NewAgentSnapshots
 	AbstInterface Abst
+	Output *OutputConfig // settings of the outputs, the global ones of the abst flags if nil
+	Seed int64 // seed of the random number generator, from the clock if 0
+	StoppedBy string // the stop condition which ended Run
+	Active *ActiveLinks // links which are not frozen, if the model is a FrozenPairer and agents do not move
+	OnProgress func(p Progress) // called during RunContext
+	obs observers
+	order []int // activation order, reused every step
+	acting []Agenter // agents of the current step, reused every step
+	removed map[AgentID]bool // agents removed during the current step
+	ProgressInterval time.Duration // minimum time between progress calls, every step if 0
+	Scheduler Scheduler // order of the agents in a step, random by default
+	rand *rand.Rand
+	started time.Time
+	stopped bool
 }
 
 func (s *Simulation) Init() {
+	if s.Seed == 0 {
+		s.Seed = time.Now().UnixNano()
+	}
+	s.rand = rand.New(rand.NewSource(s.Seed))
+	s.started = time.Now()
+
         s.Model.InitRand() // rand
+	if r, ok := s.Model.(RandSetter); ok {
+		r.SetRand(s.rand)
+	}
+	if r, ok := s.Landscape.(RandSetter); ok {
+		r.SetRand(s.rand)
+	}
 	s.Model.Init(s.Landscape)
 	s.Landscape.Init(s.Model)
+	s.observeLinks()
 
 
 	s.Log.Model = s.Model
 
-
-	s.AbstInterface.Init()
+	out := s.output()
+	s.AbstInterface.out = &out
+	if s.Log.Format == "" {
+		s.Log.Format = out.Format
+	}
+	if err := s.AbstInterface.Init(); err != nil {
+		panic(err)
+	}
 		s.Log.Out = s.AbstInterface.Log
 	s.Log.Init()
+	if s.Snapshots == nil && out.Snapshot > 0 && !s.AbstInterface.NoOutput {
+		s.createSnapshots()
+	}
 
-
+	// the outputs are observers of the simulation
+	s.Observe(&s.Log)
+	for _, c := range []*DataCollector{s.Collector, s.Snapshots} {
+		if c != nil {
+			s.Observe(c)
+		}
+	}
+	if s.AbstInterface.ZipJournal != nil {
+		s.Observe(journal{&s.AbstInterface})
+	}
+	if fp, ok := s.Model.(FrozenPairer); ok {
+		if _, ok := s.Landscape.(Neighborer); ok && !moves(s.Landscape) {
+			s.Active = NewActiveLinks(fp, s.Landscape)
+			s.Observe(s.Active)
+		}
+	}
+	// models can observe their simulation, e.g. to Touch the agents an
+	// act changed
+	if isObserver(s.Model) {
+		s.Observe(s.Model)
+	}
 }
 
+// Stop notifies the observers and closes the outputs of the simulation,
+// only the first call has an effect
 func (s *Simulation) Stop() {
+ if s.stopped {
+	return
+ }
+ s.stopped = true
+ for _, o := range s.obs.runEnd {
+	o.RunEnd(s)
+ }
  s.AbstInterface.Close()
  s.Log.Out.Sync()
+ if out := s.output(); out.Catalog && !s.AbstInterface.NoOutput {
+	if err := AppendRun(out.Dir, s.record()); err != nil {
+		fmt.Println("error:", err)
+	}
+ }
+}
+
+// output returns the output settings of the simulation
+func (s *Simulation) output() OutputConfig {
+	if s.Output != nil {
+		return *s.Output
+	}
+	return globalOutput()
 }
 
 func (s *Simulation) Step() {
+	for _, o := range s.obs.beforeStep {
+		o.BeforeStep(s)
+	}
 	s.Model.LandscapeAction()
-	//r := rand.New(rand.NewSource(90))
-	order := rand.Perm(len(*s.Landscape.GetAgents()))
-	//fmt.Printf("order: %v\n", order)
-	for _, i := range order {
-		(*s.Landscape.GetAgents())[i].Act()
+	// agents added during the step act in the next one, agents removed
+	// during the step by RemoveAgent do not act any more
+	agents := append(s.acting[:0], *s.Landscape.GetAgents()...)
+	s.acting = agents
+	for id := range s.removed {
+		delete(s.removed, id)
+	}
+	for _, i := range s.schedule(len(agents)) {
+		a := agents[i]
+		if s.removed[a.ID()] {
+			continue
+		}
+		for _, o := range s.obs.beforeAct {
+			o.BeforeAct(s, a)
+		}
+		a.Act()
+		for _, o := range s.obs.afterAct {
+			o.AfterAct(s, a)
+		}
 		//fmt.Printf("running Agent #%d\n",i)
 		s.Stats.Events = s.Stats.Events + 1
 	}
+	for i := range agents {
+		agents[i] = nil
+	}
 	s.Stats.Steps = s.Stats.Steps + 1
-	s.Log.Step(s.Stats)
-	
-	if(JournaledSimulation) { // dump landscape
-	
-	fmt.Println(s.Landscape.Dump())
-
-        dump := s.Landscape.Dump()
-        //marshal
-        b, err := json.Marshal(dump)
-	if err != nil {
-		fmt.Println("error:", err)
+	// logger, collectors and journal
+	for _, o := range s.obs.afterStep {
+		o.AfterStep(s)
 	}
-	s.AbstInterface.ZipJournal.Write(b)
-	s.AbstInterface.ZipJournal.Write([]byte("\n\r\n"))
-	s.AbstInterface.Journal.Sync()
+}
+
+// schedule returns the order in which the agents act
+func (s *Simulation) schedule(n int) []int {
+	if s.Scheduler == SequentialScheduler {
+		if cap(s.order) < n {
+			s.order = make([]int, n)
+		}
+		p := s.order[:n]
+		for i := range p {
+			p[i] = i
+		}
+		return p
 	}
+	return s.shuffle(n)
+}
 
-//force gc
-runtime.GC()
+// shuffle returns a random permutation of 0..n-1 in the reused order
+// buffer, it draws the same numbers as rand.Perm so seeds reproduce the
+// same runs
+func (s *Simulation) shuffle(n int) []int {
+	if cap(s.order) < n {
+		s.order = make([]int, n)
+	}
+	p := s.order[:n]
+	for i := 0; i < n; i++ {
+		j := s.rand.Intn(i + 1)
+		p[i] = p[j]
+		p[j] = i
+	}
+	return p
 }
 
+// Logger writes the fields of the model after every step, fields which
+// are interfaces or tagged with `goabm:"hide"` are left out.
+// The first line is a header with Steps, Events and the field names,
+// Format is "csv", "tsv" or "jsonl" (LogFormat if empty).
+// It is a DataCollector with the model fields as reporters.
 type Logger struct {
 	StdOut bool
 	Model Modeler
 	FirstOut bool
 	Out *os.File
-
+	Format string
+	collector DataCollector
 }
 
 func (l *Logger) Init() {
 l.FirstOut = true
 	if(l.StdOut) {
-	fmt.Fprintf(l.Out,"Step,\tEvents,\t")
+	if l.Format == "" {
+		l.Format = LogFormat
+	}
+	sink, err := NewSink(l.Out, l.Format)
+	if err != nil {
+		panic(err)
+	}
+	l.collector = DataCollector{ModelSinks: []Sink{sink}, Stream: true}
+	l.collector.AddModelFields(l.Model)
 	}
 
 }
 
 func (l *Logger) Step(stats Statistics) {
 	if l.StdOut {
-		// get the fields of the model through reflection
-		s := reflect.ValueOf(l.Model).Elem()
-		//s := reflect.Indirect(in).Elem()
-		typeOfT := s.Type()
-		if !l.FirstOut {
-			fmt.Fprintf(l.Out,"%d,\t%d,\t", stats.Steps, stats.Events)
-		}
-		for i := 0; i < s.NumField(); i++ {
-			f := s.Field(i)
-			if f.Type().Kind() != reflect.Interface {
-				if typeOfT.Field(i).Tag.Get("goabm") != "hide" {
-					if l.FirstOut {
-						fmt.Fprintf(l.Out,"%s,\t", typeOfT.Field(i).Name)
-					} else {
-						fmt.Fprintf(l.Out,"%v,\t",f.Interface())
-					}
-				}
-
-			}
-		}
-		fmt.Fprintf(l.Out,"\n")
-		if l.FirstOut {
-			l.FirstOut = false
+		if err := l.collector.Collect(stats, l.Model, nil); err != nil {
+			fmt.Println("error:", err)
 		}
+		l.FirstOut = false
 	}
 
 }
-
-
@@ -0,0 +1,130 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// testModel is a minimal model for the tests: every agent counts up with
+// probability P, Total is the sum of all counts
+type testModel struct {
+	Model `goabm:"hide"`
+	Total int
+	P     float64 `goabm:"hide,param" min:"0" max:"1"`
+	ls    Landscaper
+}
+
+// testAgent wraps the agent of any landscape
+type testAgent struct {
+	landscapeAgent `json:"agent"`
+	V              int `goabm:"report"`
+	m              *testModel
+}
+
+type landscapeAgent interface {
+	ID() AgentID
+}
+
+func (m *testModel) Init(l interface{}) {
+	m.ls = l.(Landscaper)
+}
+
+func (m *testModel) LandscapeAction() {
+	m.Total = 0
+	for _, a := range *m.ls.GetAgents() {
+		m.Total += a.(*testAgent).V
+	}
+}
+
+func (m *testModel) CreateAgent(a interface{}) Agenter {
+	return &testAgent{landscapeAgent: a.(landscapeAgent), m: m}
+}
+
+func (a *testAgent) Act() {
+	if a.m.P > 0 && a.m.RollDice(a.m.P) {
+		a.V++
+	}
+}
+
+// ids returns the ids of the agents
+func ids(agents []Agenter) []AgentID {
+	ids := make([]AgentID, len(agents))
+	for i, a := range agents {
+		ids[i] = a.ID()
+	}
+	return ids
+}
+
+func TestShuffle(t *testing.T) {
+	// the reused order buffer grows and shrinks, the permutations are the
+	// ones of rand.Perm
+	s := &Simulation{rand: rand.New(rand.NewSource(1))}
+	r := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 5, 100, 3, 100} {
+		if got, want := s.shuffle(n), r.Perm(n); !reflect.DeepEqual(got, want) {
+			t.Errorf("n=%d: got %v, want %v", n, got, want)
+		}
+	}
+}
+
+// legacyStep is the step loop before it was made allocation free, it
+// forced a garbage collection every step and allocated a new order
+func legacyStep(s *Simulation) {
+	s.Model.LandscapeAction()
+	order := s.rand.Perm(len(*s.Landscape.GetAgents()))
+	for _, i := range order {
+		(*s.Landscape.GetAgents())[i].Act()
+		s.Stats.Events = s.Stats.Events + 1
+	}
+	s.Stats.Steps = s.Stats.Steps + 1
+	runtime.GC()
+}
+
+func BenchmarkStep(b *testing.B) {
+	out := OutputDir
+	OutputDir = b.TempDir()
+	defer func() { OutputDir = out }()
+	for n := 1000; n <= 100000; n *= 10 {
+		size := 1
+		for size*size < n {
+			size++
+		}
+		landscapes := []struct {
+			name string
+			new  func() Landscaper
+		}{
+			{"flnm", func() Landscaper { return &FixedLandscapeNoMovement{Size: size} }},
+			{"flwm", func() Landscaper { return &FixedLandscapeWithMovement{Size: size, NAgents: n, Sight: 1} }},
+		}
+		for _, l := range landscapes {
+			for _, legacy := range []bool{false, true} {
+				name := fmt.Sprintf("%s/%d", l.name, n)
+				if legacy {
+					name += "/legacy"
+				}
+				b.Run(name, func(b *testing.B) {
+					s := &Simulation{Landscape: l.new(), Model: &testModel{}, Seed: 1}
+					s.AbstInterface.NoOutput = true
+					s.Init()
+					defer s.Stop()
+					b.ReportAllocs()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						if legacy {
+							legacyStep(s)
+						} else {
+							s.Step()
+						}
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// JournalEntry is the dump of the landscape after a step as written to the
+// journal, the agents are decoded as JSON objects. The links of a
+// MultiplexLandscape have a "layer".
+type JournalEntry struct {
+	Step  int                      `json:"step"` // first step is 1
+	Nodes []map[string]interface{} `json:"nodes"`
+	Links []map[string]interface{} `json:"links"`
+}
+
+// JournalReader reads a journal written with the abst.journal flag
+type JournalReader struct {
+	f    *os.File
+	z    *gzip.Reader
+	d    *json.Decoder
+	step int
+}
+
+// OpenJournal opens a journal, it may be compressed or not
+func OpenJournal(path string) (*JournalReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &JournalReader{f: f}
+	br := bufio.NewReader(f)
+	var in io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		if r.z, err = gzip.NewReader(br); err != nil {
+			f.Close()
+			return nil, err
+		}
+		in = r.z
+	}
+	r.d = json.NewDecoder(in)
+	return r, nil
+}
+
+// Next returns the entry of the next step, io.EOF after the last one
+func (r *JournalReader) Next() (*JournalEntry, error) {
+	e := &JournalEntry{}
+	if err := r.d.Decode(e); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("journal: step %d: %v", r.step+1, err)
+	}
+	r.step++
+	e.Step = r.step
+	return e, nil
+}
+
+// Close closes the journal file
+func (r *JournalReader) Close() error {
+	if r.z != nil {
+		r.z.Close()
+	}
+	return r.f.Close()
+}
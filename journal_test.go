@@ -0,0 +1,87 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournalReader(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		journaled := JournaledSimulation
+		JournaledSimulation = true
+		defer func() { JournaledSimulation = journaled }()
+		s := &Simulation{Landscape: &FixedLandscapeNoMovement{Size: 3}, Model: &testModel{P: 1}, Seed: 1}
+		s.Run(MaxSteps(3))
+
+		j, err := OpenJournal(s.AbstInterface.JournalPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer j.Close()
+		for step := 1; step <= 3; step++ {
+			e, err := j.Next()
+			if err != nil {
+				t.Fatalf("step %d: %v", step, err)
+			}
+			if e.Step != step || len(e.Nodes) != 9 || len(e.Links) != 36 {
+				t.Errorf("step %d: got step %d with %d nodes and %d links", step, e.Step, len(e.Nodes), len(e.Links))
+			}
+			// every agent counted up in every step
+			for _, n := range e.Nodes {
+				if n["V"] != float64(step) {
+					t.Errorf("step %d: agent %v", step, n)
+				}
+			}
+		}
+		if _, err := j.Next(); err != io.EOF {
+			t.Errorf("got %v after the last step, want EOF", err)
+		}
+	})
+}
+
+func TestJournalReaderPlain(t *testing.T) {
+	tests := []struct {
+		text  string
+		steps int
+		err   string // part of the error after the steps, EOF if empty
+	}{
+		{"", 0, ""},
+		{`{"nodes": [{"V": 1}], "links": []}` + "\n\r\n" + `{"nodes": [{"V": 2}]}` + "\n", 2, ""},
+		{`{"nodes": [{"V": 1}]}` + "\n" + `{"nodes": [`, 1, "step 2"},
+		{`{"nodes": 1}`, 0, "step 1"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "journal")
+		if err := os.WriteFile(path, []byte(tt.text), 0600); err != nil {
+			t.Fatal(err)
+		}
+		j, err := OpenJournal(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for step := 1; step <= tt.steps; step++ {
+			if e, err := j.Next(); err != nil || e.Step != step {
+				t.Errorf("%q: step %d: got %+v, %v", tt.text, step, e, err)
+			}
+		}
+		_, err = j.Next()
+		if tt.err == "" && err != io.EOF {
+			t.Errorf("%q: got %v, want EOF", tt.text, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%q: got the error %v, want %q", tt.text, err, tt.err)
+		}
+		j.Close()
+	}
+
+	if _, err := OpenJournal(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("a missing journal is opened")
+	}
+}
@@ -0,0 +1,122 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package axelrod
+
+import (
+	"fmt"
+
+	"goabm"
+)
+
+// Agent is a site (or an individual on the landscapes with movement), its
+// culture is a trait for every feature
+type Agent struct {
+	Features []int `goabm:"report"`
+	Site     `json:"site"`
+	model    *Axelrod
+}
+
+// Site is the agent of the landscape, e.g. a *goabm.FLNMAgent
+type Site interface {
+	ID() goabm.AgentID
+}
+
+// mover is implemented by the agents of the landscapes with movement
+type mover interface {
+	MoveRandomly(steplength float64)
+}
+
+// Culture returns the culture as a string
+func (a *Agent) Culture() string {
+	return fmt.Sprint(a.Features)
+}
+
+// Position returns the position of the agent on the landscape
+func (a *Agent) Position() []float64 {
+	if p, ok := a.Site.(goabm.Positioner); ok {
+		return p.Position()
+	}
+	return nil
+}
+
+// Similarity returns the share of features the agents have in common,
+// see Axelrod.Similarity
+func (a *Agent) Similarity(other *Agent) float64 {
+	return a.model.Similarity(a.Features, other.Features)
+}
+
+// Act is called every time the agent is activated: (i) it may move, (ii)
+// it selects a neighbor or the mass media and they interact with a
+// probability of their similarity, (iii) it may change a trait at random
+func (a *Agent) Act() {
+	m := a.model
+	if m.ProbVeloc > 0 && m.RollDice(m.ProbVeloc) {
+		if mv, ok := a.Site.(mover); ok {
+			mv.MoveRandomly(m.Steplength)
+		}
+	}
+
+	if m.Media > 0 && m.RollDice(m.Media) {
+		// the agent interacts with the mass media instead of a neighbor,
+		// it takes one of its traits with a probability of their similarity
+		m.interact(a.Features, m.field)
+	} else if other := a.randomNeighbor(); other != nil {
+		if m.Rule == "impose" {
+			if m.interact(other.Features, a.Features) {
+				m.touched = append(m.touched, other.ID())
+			}
+		} else {
+			m.interact(a.Features, other.Features)
+		}
+	}
+
+	if m.Noise > 0 && m.RollDice(m.Noise) {
+		a.Features[m.Rand().Intn(m.Features)] = m.Rand().Intn(m.Traits)
+	}
+}
+
+// randomNeighbor returns one of the neighbors, nil if there is none
+func (a *Agent) randomNeighbor() *Agent {
+	m := a.model
+	neighbors := m.nb.Neighbors(a.ID())
+	if len(neighbors) == 0 {
+		return nil
+	}
+	other := m.Landscape.GetAgentById(neighbors[m.Rand().Intn(len(neighbors))])
+	if other == nil {
+		return nil
+	}
+	return other.(*Agent)
+}
+
+// interact lets target take one of the traits of source in which they
+// differ, with a probability of their similarity. With metric features
+// the trait moves one step towards the one of source. It returns whether
+// target changed.
+func (m *Axelrod) interact(target, source []int) bool {
+	s := m.Similarity(target, source)
+	if s >= 1 || s <= 0 || s < m.Threshold || !m.RollDice(s) {
+		return false
+	}
+	// a random feature in which they differ
+	f, n := -1, 0
+	for i := range target {
+		if target[i] != source[i] {
+			n++
+			if m.Rand().Intn(n) == 0 {
+				f = i
+			}
+		}
+	}
+	switch {
+	case !m.Metric:
+		target[f] = source[f]
+	case target[f] < source[f]:
+		target[f]++
+	default:
+		target[f]--
+	}
+	return true
+}
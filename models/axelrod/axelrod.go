@@ -0,0 +1,193 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+
+// Package axelrod is Robert Axelrod's model of the dissemination of
+// culture [1] with some of its known extensions:
+//
+//   - cultural drift: random changes of traits [2]
+//   - bounded confidence: agents only interact above a similarity threshold
+//   - a mass media field: the most common trait of every feature [3]
+//   - metric features: ordered traits, influence moves a trait one step
+//     towards the other one [4]
+//   - moving agents on the landscapes with movement
+//
+// The package registers the models "axelrod" on a grid and
+// "axelrod-moving" in a 2d space, so they can be run with the goabm
+// command.
+//
+// [1]: Axelrod, Robert. "The dissemination of culture a model with local convergence and global polarization." Journal of conflict resolution 41, no. 2 (1997): 203-226.
+// [2]: Klemm, Konstantin, et al. "Global culture: A noise-induced transition in finite systems." Physical Review E 67, no. 4 (2003): 045101.
+// [3]: González-Avella, Juan Carlos, et al. "Nonequilibrium transition induced by mass media in a model for social influence." Physical Review E 72, no. 6 (2005): 065102.
+// [4]: Flache, Andreas, and Michael W. Macy. "Local convergence and global diversity: From interpersonal to social influence." Journal of Conflict Resolution 55, no. 6 (2011): 970-995.
+package axelrod
+
+import (
+	"goabm"
+)
+
+func init() {
+	goabm.RegisterModel(goabm.ModelInfo{
+		Name:        "axelrod",
+		Description: "Axelrod's dissemination of culture on a grid",
+		New:         New,
+		Landscape:   goabm.LandscapeConfig{Type: "flnm", Size: 10},
+		Params:      goabm.ParamSet{"Features": 15, "Traits": 15},
+	})
+	goabm.RegisterModel(goabm.ModelInfo{
+		Name:        "axelrod-moving",
+		Description: "Axelrod's dissemination of culture with agents moving in a 2d space",
+		New:         New,
+		Landscape:   goabm.LandscapeConfig{Type: "flwm", Size: 10, Agents: 100, Sight: 1},
+		Params:      goabm.ParamSet{"Features": 5, "Traits": 5, "ProbVeloc": 0.05},
+	})
+}
+
+// New returns a model with the parameters at their zero values, use
+// goabm.NewModel("axelrod") for the defaults
+func New() goabm.Modeler {
+	return &Axelrod{}
+}
+
+// Axelrod is the model, the parameters are set with goabm.Params
+type Axelrod struct {
+	Cultures    int // number of distinct cultures
+	Largest     int // number of agents of the largest culture
+	goabm.Model `goabm:"hide"`
+	Landscape   goabm.Landscaper
+
+	Features   int     `goabm:"hide,param" default:"5" min:"1" desc:"number of cultural features"`
+	Traits     int     `goabm:"hide,param" default:"10" min:"1" desc:"number of traits per feature"`
+	Rule       string  `goabm:"hide,param" choices:"adopt|impose" desc:"adopt: the active agent takes a trait of its neighbor, impose: the neighbor takes a trait of the active agent"`
+	Noise      float64 `goabm:"hide,param" min:"0" max:"1" desc:"probability that an agent changes a trait at random when it acts (cultural drift)"`
+	Threshold  float64 `goabm:"hide,param" min:"0" max:"1" desc:"minimal similarity for an interaction (bounded confidence)"`
+	Media      float64 `goabm:"hide,param" min:"0" max:"1" desc:"probability that an agent interacts with the mass media instead of a neighbor"`
+	Metric     bool    `goabm:"hide,param" desc:"ordered traits: the similarity is based on their distance and influence moves a trait one step"`
+	Steplength float64 `goabm:"hide,param" default:"0.1" min:"0" desc:"maximal distance a agent can travel per step"`
+	ProbVeloc  float64 `goabm:"hide,param" min:"0" max:"1" flag:"pveloc" desc:"probability that an agent moves, on landscapes with movement"`
+
+	field   []int            // the mass media: most common trait of every feature
+	touched []goabm.AgentID  // agents changed by the active agent
+	nb      goabm.Neighborer // the neighbors of the landscape
+}
+
+func (m *Axelrod) Init(l interface{}) {
+	m.Landscape = l.(goabm.Landscaper)
+	nb, ok := l.(goabm.Neighborer)
+	if !ok {
+		panic("axelrod: the landscape does not provide neighbors")
+	}
+	m.nb = nb
+}
+
+func (m *Axelrod) CreateAgent(agenter interface{}) goabm.Agenter {
+	a := &Agent{Site: agenter.(Site), Features: make([]int, m.Features), model: m}
+	for i := range a.Features {
+		a.Features[i] = m.Rand().Intn(m.Traits)
+	}
+	return a
+}
+
+func (m *Axelrod) LandscapeAction() {
+	m.Cultures, m.Largest = m.CountCultures()
+	if m.Media > 0 {
+		m.field = m.MediaField()
+	}
+}
+
+// CountCultures returns the number of distinct cultures and the number of
+// agents of the largest one
+func (m *Axelrod) CountCultures() (cultures, largest int) {
+	count := make(map[string]int)
+	for _, b := range *m.Landscape.GetAgents() {
+		c := b.(*Agent).Culture()
+		count[c]++
+		if count[c] > largest {
+			largest = count[c]
+		}
+	}
+	return len(count), largest
+}
+
+// MediaField returns the most common trait of every feature, ties are
+// broken by the smaller trait
+func (m *Axelrod) MediaField() []int {
+	counts := make([][]int, m.Features)
+	for f := range counts {
+		counts[f] = make([]int, m.Traits)
+	}
+	for _, b := range *m.Landscape.GetAgents() {
+		for f, t := range b.(*Agent).Features {
+			counts[f][t]++
+		}
+	}
+	field := make([]int, m.Features)
+	for f, c := range counts {
+		for t := range c {
+			if c[t] > c[field[f]] {
+				field[f] = t
+			}
+		}
+	}
+	return field
+}
+
+// Similarity is the share of equal features, with metric features one
+// minus the mean distance of the traits relative to the largest one
+func (m *Axelrod) Similarity(a, b []int) float64 {
+	if !m.Metric {
+		same := 0
+		for i := range a {
+			if a[i] == b[i] {
+				same++
+			}
+		}
+		return float64(same) / float64(len(a))
+	}
+	if m.Traits < 2 {
+		return 1
+	}
+	d := 0
+	for i := range a {
+		if a[i] > b[i] {
+			d += a[i] - b[i]
+		} else {
+			d += b[i] - a[i]
+		}
+	}
+	return 1 - float64(d)/float64(len(a)*(m.Traits-1))
+}
+
+// Frozen is true when two agents can not interact any more: they share
+// all traits, none or less than the threshold. With noise or mass media
+// agents never freeze.
+func (m *Axelrod) Frozen(x, y goabm.Agenter) bool {
+	if m.Noise > 0 || m.Media > 0 {
+		return false
+	}
+	s := m.Similarity(x.(*Agent).Features, y.(*Agent).Features)
+	return s >= 1 || s <= 0 || s < m.Threshold
+}
+
+// AfterAct reports the neighbors an imposing agent changed to the
+// absorbing state detection
+func (m *Axelrod) AfterAct(s *goabm.Simulation, a goabm.Agenter) {
+	if s.Active != nil {
+		for _, id := range m.touched {
+			s.Active.Touch(id)
+		}
+	}
+	m.touched = m.touched[:0]
+}
+
+// RunEnd counts the cultures of the final state, they are counted at the
+// beginning of every step otherwise
+func (m *Axelrod) RunEnd(s *goabm.Simulation) {
+	m.Cultures, m.Largest = m.CountCultures()
+}
+
+// OneCulture stops a run when all agents share the same culture
+func (m *Axelrod) OneCulture() goabm.StopCondition {
+	return goabm.When("cultures=1", func(*goabm.Simulation) bool { return m.Cultures == 1 })
+}
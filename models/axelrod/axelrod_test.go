@@ -0,0 +1,184 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package axelrod
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"goabm"
+)
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		metric bool
+		traits int
+		a, b   []int
+		want   float64
+	}{
+		{false, 5, []int{1, 2, 3, 4}, []int{1, 2, 3, 4}, 1},
+		{false, 5, []int{1, 2, 3, 4}, []int{1, 2, 0, 0}, 0.5},
+		{false, 5, []int{1, 2, 3, 4}, []int{0, 0, 0, 1}, 0},
+		{true, 5, []int{0, 0}, []int{0, 0}, 1},
+		{true, 5, []int{0, 0}, []int{2, 0}, 0.75},
+		{true, 5, []int{0, 4}, []int{4, 0}, 0},
+		{true, 5, []int{1, 3}, []int{3, 1}, 0.5},
+		{true, 1, []int{0, 0}, []int{0, 0}, 1},
+	}
+	for _, tt := range tests {
+		m := &Axelrod{Metric: tt.metric, Traits: tt.traits}
+		if got := m.Similarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("metric %v: similarity of %v and %v is %v, want %v", tt.metric, tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestInteract(t *testing.T) {
+	tests := []struct {
+		name     string
+		m        *Axelrod
+		target   []int
+		source   []int
+		interact bool // whether they can interact at all
+	}{
+		{"plain", &Axelrod{Traits: 5}, []int{0, 0, 0, 0}, []int{0, 1, 2, 3}, true},
+		{"metric", &Axelrod{Traits: 4, Metric: true}, []int{0, 0, 0, 0}, []int{0, 3, 3, 3}, true},
+		{"equal", &Axelrod{Traits: 5}, []int{1, 2}, []int{1, 2}, false},
+		{"nothing in common", &Axelrod{Traits: 5}, []int{1, 2}, []int{2, 1}, false},
+		{"below the threshold", &Axelrod{Traits: 5, Threshold: 0.5}, []int{0, 0, 0, 0}, []int{0, 1, 2, 3}, false},
+	}
+	for _, tt := range tests {
+		tt.m.SetRand(rand.New(rand.NewSource(1)))
+		changed := make(map[int]int) // changes per feature
+		for i := 0; i < 1000; i++ {
+			target := append([]int(nil), tt.target...)
+			if !tt.m.interact(target, tt.source) {
+				if !reflect.DeepEqual(target, tt.target) {
+					t.Fatalf("%s: %v changed to %v without an interaction", tt.name, tt.target, target)
+				}
+				continue
+			}
+			// exactly one feature in which they differ changed, it took
+			// the trait of the source or moved one step towards it
+			var diff []int
+			for f := range target {
+				if target[f] != tt.target[f] {
+					diff = append(diff, f)
+				}
+			}
+			if len(diff) != 1 || tt.target[diff[0]] == tt.source[diff[0]] {
+				t.Fatalf("%s: %v changed to %v", tt.name, tt.target, target)
+			}
+			f := diff[0]
+			want := tt.source[f]
+			if tt.m.Metric {
+				want = tt.target[f] + 1
+			}
+			if target[f] != want {
+				t.Fatalf("%s: feature %d changed to %d, want %d", tt.name, f, target[f], want)
+			}
+			changed[f]++
+		}
+		if !tt.interact {
+			if len(changed) > 0 {
+				t.Errorf("%s: %v and %v interacted", tt.name, tt.target, tt.source)
+			}
+			continue
+		}
+		// the similarity is 1/4, every differing feature is chosen
+		n := changed[1] + changed[2] + changed[3]
+		if n < 200 || n > 300 || changed[1] == 0 || changed[2] == 0 || changed[3] == 0 {
+			t.Errorf("%s: %d interactions of 1000, %v", tt.name, n, changed)
+		}
+	}
+}
+
+func TestFrozen(t *testing.T) {
+	half := [2][]int{{0, 0, 0, 0}, {0, 0, 1, 1}}
+	tests := []struct {
+		name string
+		m    *Axelrod
+		a, b []int
+		want bool
+	}{
+		{"equal", &Axelrod{Traits: 5}, []int{1, 2}, []int{1, 2}, true},
+		{"nothing in common", &Axelrod{Traits: 5}, []int{1, 2}, []int{2, 1}, true},
+		{"half", &Axelrod{Traits: 5}, half[0], half[1], false},
+		{"below the threshold", &Axelrod{Traits: 5, Threshold: 0.6}, half[0], half[1], true},
+		{"at the threshold", &Axelrod{Traits: 5, Threshold: 0.5}, half[0], half[1], false},
+		{"metric", &Axelrod{Traits: 3, Metric: true}, []int{0, 0}, []int{2, 2}, true},
+		{"metric, traits in common", &Axelrod{Traits: 3, Metric: true}, []int{0, 0}, []int{1, 2}, false},
+		{"noise", &Axelrod{Traits: 5, Noise: 0.1}, []int{1, 2}, []int{1, 2}, false},
+		{"media", &Axelrod{Traits: 5, Media: 0.1}, []int{1, 2}, []int{2, 1}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Frozen(&Agent{Features: tt.a}, &Agent{Features: tt.b}); got != tt.want {
+			t.Errorf("%s: frozen is %v for %v and %v", tt.name, got, tt.a, tt.b)
+		}
+	}
+}
+
+func TestCountCultures(t *testing.T) {
+	m := &Axelrod{Features: 2, Traits: 3}
+	m.SetRand(rand.New(rand.NewSource(1)))
+	l := &goabm.FixedLandscapeNoMovement{Size: 2}
+	m.Init(l)
+	l.Init(m)
+	tests := []struct {
+		features          [][]int
+		cultures, largest int
+	}{
+		{[][]int{{0, 0}, {0, 0}, {0, 0}, {0, 0}}, 1, 4},
+		{[][]int{{0, 0}, {0, 1}, {1, 0}, {0, 0}}, 3, 2},
+		{[][]int{{0, 1}, {1, 0}, {2, 2}, {1, 2}}, 4, 1},
+		{[][]int{{1, 2}, {2, 1}, {1, 2}, {2, 1}}, 2, 2},
+	}
+	for _, tt := range tests {
+		for i, a := range *l.GetAgents() {
+			a.(*Agent).Features = tt.features[i]
+		}
+		if cultures, largest := m.CountCultures(); cultures != tt.cultures || largest != tt.largest {
+			t.Errorf("%v: %d cultures, the largest with %d agents, want %d and %d", tt.features, cultures, largest, tt.cultures, tt.largest)
+		}
+	}
+}
+
+func TestAbsorbingRun(t *testing.T) {
+	run := func() (*goabm.Simulation, *Axelrod) {
+		// with many traits per feature the grid freezes in several cultures
+		m := &Axelrod{Features: 3, Traits: 8, Steplength: 0.1}
+		s := &goabm.Simulation{Landscape: &goabm.FixedLandscapeNoMovement{Size: 5}, Model: m, Seed: 3}
+		s.AbstInterface.NoOutput = true
+		s.Run(goabm.Absorbed(), goabm.MaxSteps(100000))
+		return s, m
+	}
+	s, m := run()
+	if s.StoppedBy != "absorbed" {
+		t.Fatalf("stopped by %s after %d steps", s.StoppedBy, s.Stats.Steps)
+	}
+	// no pair of neighbors can interact any more
+	nb := s.Landscape.(goabm.Neighborer)
+	for _, a := range *s.Landscape.GetAgents() {
+		for _, id := range nb.Neighbors(a.ID()) {
+			if !m.Frozen(a, s.Landscape.GetAgentById(id)) {
+				t.Errorf("agents %d and %d can still interact", a.ID(), id)
+			}
+		}
+	}
+	if cultures, largest := m.CountCultures(); m.Cultures != cultures || m.Largest != largest {
+		t.Errorf("%d cultures, the largest %d, counted %d and %d", m.Cultures, m.Largest, cultures, largest)
+	}
+	if m.Cultures != 5 {
+		t.Errorf("%d cultures after %d steps, want 5", m.Cultures, s.Stats.Steps)
+	}
+
+	// the same seed ends in the same state
+	again, m2 := run()
+	if again.Stats != s.Stats || m2.Cultures != m.Cultures {
+		t.Errorf("not reproducible: %+v and %+v", again.Stats, s.Stats)
+	}
+}
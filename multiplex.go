@@ -0,0 +1,374 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Layer is one set of relations between the agents of a MultiplexLandscape
+type Layer interface {
+	Neighbors(id AgentID) []AgentID
+	Links() []Link
+}
+
+// LayerIniter is implemented by layers which build their links once the
+// agents exist, e.g. generated networks
+type LayerIniter interface {
+	InitLayer(agents []Agenter, r *rand.Rand)
+}
+
+// LayerUpdater is implemented by layers which follow the population of a
+// MultiplexLandscape, see MultiplexLandscape.AddAgent
+type LayerUpdater interface {
+	AgentAdded(a Agenter, agents []Agenter, r *rand.Rand)
+	AgentRemoved(id AgentID)
+}
+
+// Neighborer is implemented by landscapes which can list the neighbors of an agent
+type Neighborer interface {
+	Neighbors(id AgentID) []AgentID
+}
+
+// NetworkLayer is a layer of explicit undirected links, e.g. a social network
+type NetworkLayer struct {
+	adj  map[AgentID][]AgentID
+	hook func(l Link, added bool)
+}
+
+func (n *NetworkLayer) setLinkHook(hook func(l Link, added bool)) {
+	n.hook = hook
+}
+
+func (n *NetworkLayer) init() {
+	if n.adj == nil {
+		n.adj = make(map[AgentID][]AgentID)
+	}
+}
+
+// Connect links two agents, connecting an already linked pair does nothing
+func (n *NetworkLayer) Connect(a, b AgentID) {
+	n.init()
+	if a == b || n.Connected(a, b) {
+		return
+	}
+	n.adj[a] = append(n.adj[a], b)
+	n.adj[b] = append(n.adj[b], a)
+	if n.hook != nil {
+		n.hook(Link{Source: a, Target: b}, true)
+	}
+}
+
+// Disconnect removes the link between two agents
+func (n *NetworkLayer) Disconnect(a, b AgentID) {
+	remove := func(from, id AgentID) {
+		l := n.adj[from]
+		for i, v := range l {
+			if v == id {
+				l[i] = l[len(l)-1]
+				n.adj[from] = l[:len(l)-1]
+				return
+			}
+		}
+	}
+	if !n.Connected(a, b) {
+		return
+	}
+	remove(a, b)
+	remove(b, a)
+	if n.hook != nil {
+		n.hook(Link{Source: a, Target: b}, false)
+	}
+}
+
+// Connected reports whether the two agents are linked
+func (n *NetworkLayer) Connected(a, b AgentID) bool {
+	for _, v := range n.adj[a] {
+		if v == b {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *NetworkLayer) Neighbors(id AgentID) []AgentID {
+	return n.adj[id]
+}
+
+// AgentAdded does nothing, a new agent has no links
+func (n *NetworkLayer) AgentAdded(a Agenter, agents []Agenter, r *rand.Rand) {}
+
+// AgentRemoved removes all links of the agent
+func (n *NetworkLayer) AgentRemoved(id AgentID) {
+	for len(n.adj[id]) > 0 {
+		n.Disconnect(id, n.adj[id][0])
+	}
+	delete(n.adj, id)
+}
+
+// Links returns every link in both directions, like the landscape dumps
+func (n *NetworkLayer) Links() []Link {
+	ids := make([]int, 0, len(n.adj))
+	for id := range n.adj {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+
+	var links []Link
+	for _, id := range ids {
+		for _, t := range n.adj[AgentID(id)] {
+			links = append(links, Link{Source: AgentID(id), Target: t})
+		}
+	}
+	return links
+}
+
+// RandomNetworkLayer is an Erdős–Rényi network, every pair of agents is
+// linked with probability P
+type RandomNetworkLayer struct {
+	NetworkLayer
+	P float64
+}
+
+func (n *RandomNetworkLayer) InitLayer(agents []Agenter, r *rand.Rand) {
+	n.adj = make(map[AgentID][]AgentID)
+	for i := range agents {
+		for j := i + 1; j < len(agents); j++ {
+			if r.Float64() < n.P {
+				n.Connect(agents[i].ID(), agents[j].ID())
+			}
+		}
+	}
+}
+
+// AgentAdded links a new agent to every other agent with probability P
+func (n *RandomNetworkLayer) AgentAdded(a Agenter, agents []Agenter, r *rand.Rand) {
+	for _, b := range agents {
+		if b.ID() != a.ID() && r.Float64() < n.P {
+			n.Connect(a.ID(), b.ID())
+		}
+	}
+}
+
+// landscapeLayer exposes the spatial relations of a landscape as a layer
+type landscapeLayer struct {
+	ls Landscaper
+}
+
+func (l landscapeLayer) Neighbors(id AgentID) []AgentID {
+	if n, ok := l.ls.(Neighborer); ok {
+		return n.Neighbors(id)
+	}
+	return nil
+}
+
+func (l landscapeLayer) Links() []Link {
+	return l.ls.Dump().Links
+}
+
+// MultiplexLandscape hosts the agents of the Base landscape in several
+// layers, e.g. a FixedLandscapeWithMovement space plus a social network.
+// Neighbor queries are addressed by layer name, the base landscape is
+// available under BaseName. Neighbors returns the neighbors in any layer.
+// Agents can be added and removed if the base landscape is a
+// DynamicLandscaper and all layers are LayerUpdaters.
+type MultiplexLandscape struct {
+	Base     Landscaper       // creates the agents, e.g. a FixedLandscapeWithMovement
+	BaseName string           // layer name of the base landscape, "space" if empty
+	Layers   map[string]Layer // additional layers by name
+	rand     *rand.Rand
+}
+
+func (l *MultiplexLandscape) Init(model Modeler) {
+	if l.rand == nil {
+		l.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	if rs, ok := l.Base.(RandSetter); ok {
+		rs.SetRand(l.rand)
+	}
+	if l.BaseName == "" {
+		l.BaseName = "space"
+	}
+	if _, ok := l.Layers[l.BaseName]; ok {
+		panic("layer " + l.BaseName + " is already used by the base landscape")
+	}
+	l.Base.Init(model)
+
+	for _, layer := range l.Layers {
+		if li, ok := layer.(LayerIniter); ok {
+			li.InitLayer(*l.Base.GetAgents(), l.rand)
+		}
+	}
+}
+
+// LayerNames returns the names of all layers, the base layer first
+func (l *MultiplexLandscape) LayerNames() []string {
+	names := make([]string, 0, len(l.Layers))
+	for name := range l.Layers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{l.BaseName}, names...)
+}
+
+// Layer returns the layer with the given name or nil
+func (l *MultiplexLandscape) Layer(name string) Layer {
+	if name == l.BaseName {
+		return landscapeLayer{l.Base}
+	}
+	if layer, ok := l.Layers[name]; ok {
+		return layer
+	}
+	return nil
+}
+
+// LayerNeighbors returns the neighbors of an agent in the named layer
+func (l *MultiplexLandscape) LayerNeighbors(layer string, id AgentID) []AgentID {
+	lay := l.Layer(layer)
+	if lay == nil {
+		panic("layer does not exist: " + layer)
+	}
+	return lay.Neighbors(id)
+}
+
+// Neighbors returns the neighbors of an agent in any layer, every agent
+// once, in the order of LayerNames
+func (l *MultiplexLandscape) Neighbors(id AgentID) []AgentID {
+	var neighbors []AgentID
+	seen := make(map[AgentID]bool)
+	for _, name := range l.LayerNames() {
+		for _, n := range l.Layer(name).Neighbors(id) {
+			if !seen[n] {
+				seen[n] = true
+				neighbors = append(neighbors, n)
+			}
+		}
+	}
+	return neighbors
+}
+
+// RandomNeighbor returns a random neighbor of an agent in the named layer,
+// nil if it has none
+func (l *MultiplexLandscape) RandomNeighbor(layer string, id AgentID) Agenter {
+	n := l.LayerNeighbors(layer, id)
+	if len(n) < 1 {
+		return nil
+	}
+	return l.GetAgentById(n[l.rand.Intn(len(n))])
+}
+
+func (l *MultiplexLandscape) GetAgents() *[]Agenter {
+	return l.Base.GetAgents()
+}
+
+func (l *MultiplexLandscape) GetAgentById(id AgentID) Agenter {
+	return l.Base.GetAgentById(id)
+}
+
+// dynamic returns the base landscape if agents can be added and removed
+func (l *MultiplexLandscape) dynamic() DynamicLandscaper {
+	d, ok := l.Base.(DynamicLandscaper)
+	if !ok {
+		panic("the base landscape does not support adding or removing agents")
+	}
+	for name, layer := range l.Layers {
+		if _, ok := layer.(LayerUpdater); !ok {
+			panic("layer " + name + " does not support adding or removing agents")
+		}
+	}
+	return d
+}
+
+// AddAgent adds an agent to the base landscape and to every layer
+func (l *MultiplexLandscape) AddAgent(model Modeler) Agenter {
+	a := l.dynamic().AddAgent(model)
+	for _, name := range l.LayerNames()[1:] {
+		l.Layers[name].(LayerUpdater).AgentAdded(a, *l.Base.GetAgents(), l.rand)
+	}
+	return a
+}
+
+// RemoveAgent removes an agent from the base landscape and its links from
+// every layer
+func (l *MultiplexLandscape) RemoveAgent(id AgentID) Agenter {
+	a := l.dynamic().RemoveAgent(id)
+	if a == nil {
+		return nil
+	}
+	for _, name := range l.LayerNames()[1:] {
+		l.Layers[name].(LayerUpdater).AgentRemoved(id)
+	}
+	return a
+}
+
+// SetRand sets the random number generator, it is shared with the base landscape
+func (l *MultiplexLandscape) SetRand(r *rand.Rand) {
+	l.rand = r
+}
+
+func (l *MultiplexLandscape) RandomAgent() Agenter {
+	return l.Base.RandomAgent()
+}
+
+func (l *MultiplexLandscape) RandomAgents(k int) []Agenter {
+	return l.Base.RandomAgents(k)
+}
+
+func (l *MultiplexLandscape) RandomAgentWhere(match func(Agenter) bool) Agenter {
+	return l.Base.RandomAgentWhere(match)
+}
+
+// LayerLink is a link of a layer of a MultiplexLandscape
+type LayerLink struct {
+	Link
+	Layer string `json:"layer"`
+}
+
+// MultiplexDump is a dump of a MultiplexLandscape in which every link
+// names its layer
+type MultiplexDump struct {
+	Nodes []Agenter   `json:"nodes"`
+	Links []LayerLink `json:"links"`
+}
+
+// Dump emits the agents and the links of all layers, the links do not
+// tell their layer, see DumpWithLayers and DumpLayers
+func (l *MultiplexLandscape) Dump() NetworkDump {
+	dump := l.Base.Dump()
+	for _, name := range l.LayerNames()[1:] {
+		dump.Links = append(dump.Links, l.Layers[name].Links()...)
+	}
+	return dump
+}
+
+// DumpWithLayers emits the agents and the links of all layers, each link
+// with the name of its layer, it is written to the journal
+func (l *MultiplexLandscape) DumpWithLayers() MultiplexDump {
+	base := l.Base.Dump()
+	dump := MultiplexDump{Nodes: base.Nodes}
+	for _, name := range l.LayerNames() {
+		links := base.Links
+		if name != l.BaseName {
+			links = l.Layers[name].Links()
+		}
+		for _, link := range links {
+			dump.Links = append(dump.Links, LayerLink{link, name})
+		}
+	}
+	return dump
+}
+
+// DumpLayers dumps every layer as its own network
+func (l *MultiplexLandscape) DumpLayers() map[string]NetworkDump {
+	dumps := make(map[string]NetworkDump)
+	base := l.Base.Dump()
+	dumps[l.BaseName] = base
+	for name, layer := range l.Layers {
+		dumps[name] = NetworkDump{Nodes: base.Nodes, Links: layer.Links()}
+	}
+	return dumps
+}
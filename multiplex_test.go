@@ -0,0 +1,154 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var _ Neighborer = &MultiplexLandscape{}
+var _ DynamicLandscaper = &MultiplexLandscape{}
+
+func TestMultiplexNeighbors(t *testing.T) {
+	friends := &NetworkLayer{}
+	l := &MultiplexLandscape{
+		Base:   &FixedLandscapeNoMovement{Size: 3},
+		Layers: map[string]Layer{"friends": friends},
+	}
+	l.SetRand(rand.New(rand.NewSource(1)))
+	l.Init(&testModel{})
+	friends.Connect(0, 1) // also a neighbor on the grid
+	friends.Connect(0, 4)
+
+	tests := []struct {
+		layer string
+		id    AgentID
+		want  []AgentID
+	}{
+		{"space", 0, []AgentID{3, 1, 6, 2}},
+		{"friends", 0, []AgentID{1, 4}},
+		{"friends", 8, nil},
+	}
+	for _, tt := range tests {
+		if got := l.LayerNeighbors(tt.layer, tt.id); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s neighbors of %d: got %v, want %v", tt.layer, tt.id, got, tt.want)
+		}
+	}
+	// the union of all layers, every agent once
+	if got, want := l.Neighbors(0), []AgentID{3, 1, 6, 2, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("neighbors of 0: got %v, want %v", got, want)
+	}
+}
+
+func TestMultiplexAddRemoveAgent(t *testing.T) {
+	network := &RandomNetworkLayer{P: 1}
+	l := &MultiplexLandscape{
+		Base:   &FixedLandscapeWithMovement{Size: 10, NAgents: 4},
+		Layers: map[string]Layer{"network": network},
+	}
+	l.SetRand(rand.New(rand.NewSource(1)))
+	m := &testModel{}
+	l.Init(m)
+
+	a := l.AddAgent(m)
+	if l.GetAgentById(a.ID()) != a {
+		t.Fatal("the added agent is not in the base landscape")
+	}
+	if got := len(l.LayerNeighbors("network", a.ID())); got != 4 {
+		t.Errorf("the added agent has %d links, want 4", got)
+	}
+
+	removed := (*l.GetAgents())[0].ID()
+	if l.RemoveAgent(removed) == nil {
+		t.Fatal("agent was not removed")
+	}
+	if l.RemoveAgent(removed) != nil {
+		t.Error("agent was removed twice")
+	}
+	for _, b := range *l.GetAgents() {
+		for _, n := range l.LayerNeighbors("network", b.ID()) {
+			if n == removed {
+				t.Errorf("agent %d is still linked to the removed agent", b.ID())
+			}
+		}
+		if got := len(l.LayerNeighbors("network", b.ID())); got != 3 {
+			t.Errorf("agent %d has %d links, want 3", b.ID(), got)
+		}
+	}
+	for _, link := range network.Links() {
+		if link.Source == removed || link.Target == removed {
+			t.Errorf("link %v of the removed agent is left", link)
+		}
+	}
+}
+
+// staticLayer is a layer which can not follow the population
+type staticLayer struct{}
+
+func (staticLayer) Neighbors(id AgentID) []AgentID { return nil }
+func (staticLayer) Links() []Link                  { return nil }
+
+func TestMultiplexRejectsStaticLayers(t *testing.T) {
+	tests := []struct {
+		name string
+		l    *MultiplexLandscape
+	}{
+		{"static base", &MultiplexLandscape{Base: &FixedLandscapeNoMovement{Size: 2}}},
+		{"static layer", &MultiplexLandscape{
+			Base:   &FixedLandscapeWithMovement{Size: 10, NAgents: 2},
+			Layers: map[string]Layer{"static": staticLayer{}},
+		}},
+	}
+	for _, tt := range tests {
+		m := &testModel{}
+		tt.l.Init(m)
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: adding an agent did not panic", tt.name)
+				}
+			}()
+			tt.l.AddAgent(m)
+		}()
+	}
+}
+
+func TestMultiplexJournal(t *testing.T) {
+	friends := &NetworkLayer{}
+	s := &Simulation{
+		Landscape: &MultiplexLandscape{
+			Base:   &FixedLandscapeNoMovement{Size: 3},
+			Layers: map[string]Layer{"friends": friends},
+		},
+		Model:  &testModel{},
+		Seed:   1,
+		Output: &OutputConfig{Dir: t.TempDir(), RunID: "multiplex", Journal: true},
+	}
+	s.Init()
+	friends.Connect(0, 1)
+	friends.Connect(0, 4)
+	s.Run(MaxSteps(1))
+
+	j, err := OpenJournal(filepath.Join(s.Output.Dir, "goabm.multiplex", "journal.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	e, err := j.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every link of the grid and the two friendships, in both directions
+	layers := make(map[interface{}]int)
+	for _, l := range e.Links {
+		layers[l["layer"]]++
+	}
+	if want := map[interface{}]int{"space": 36, "friends": 4}; len(e.Nodes) != 9 || !reflect.DeepEqual(layers, want) {
+		t.Errorf("%d nodes and the links %v, want 9 nodes and %v", len(e.Nodes), layers, want)
+	}
+}
@@ -0,0 +1,318 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Observers are registered on a simulation with Observe and implement one
+// or more of the following interfaces, the hooks are called in the order
+// of registration.
+
+// BeforeStepObserver is called before every step
+type BeforeStepObserver interface {
+	BeforeStep(s *Simulation)
+}
+
+// AfterStepObserver is called after every step
+type AfterStepObserver interface {
+	AfterStep(s *Simulation)
+}
+
+// BeforeActObserver is called before every agent activation
+type BeforeActObserver interface {
+	BeforeAct(s *Simulation, a Agenter)
+}
+
+// AfterActObserver is called after every agent activation
+type AfterActObserver interface {
+	AfterAct(s *Simulation, a Agenter)
+}
+
+// AgentAddedObserver is called when Simulation.AddAgent added an agent
+type AgentAddedObserver interface {
+	AgentAdded(s *Simulation, a Agenter)
+}
+
+// AgentRemovedObserver is called when Simulation.RemoveAgent removed an
+// agent
+type AgentRemovedObserver interface {
+	AgentRemoved(s *Simulation, a Agenter)
+}
+
+// LinkAddedObserver is called when a link was added to a network layer of
+// a MultiplexLandscape during the run
+type LinkAddedObserver interface {
+	LinkAdded(s *Simulation, layer string, l Link)
+}
+
+// LinkRemovedObserver is called when a link was removed from a network
+// layer of a MultiplexLandscape during the run
+type LinkRemovedObserver interface {
+	LinkRemoved(s *Simulation, layer string, l Link)
+}
+
+// RunEndObserver is called once when the simulation stops, before its
+// outputs are closed
+type RunEndObserver interface {
+	RunEnd(s *Simulation)
+}
+
+// Hooks is an observer made of functions, only the hooks which are set
+// are registered
+type Hooks struct {
+	OnBeforeStep   func(s *Simulation)
+	OnAfterStep    func(s *Simulation)
+	OnBeforeAct    func(s *Simulation, a Agenter)
+	OnAfterAct     func(s *Simulation, a Agenter)
+	OnAgentAdded   func(s *Simulation, a Agenter)
+	OnAgentRemoved func(s *Simulation, a Agenter)
+	OnLinkAdded    func(s *Simulation, layer string, l Link)
+	OnLinkRemoved  func(s *Simulation, layer string, l Link)
+	OnRunEnd       func(s *Simulation)
+}
+
+func (h *Hooks) BeforeStep(s *Simulation)                        { h.OnBeforeStep(s) }
+func (h *Hooks) AfterStep(s *Simulation)                         { h.OnAfterStep(s) }
+func (h *Hooks) BeforeAct(s *Simulation, a Agenter)              { h.OnBeforeAct(s, a) }
+func (h *Hooks) AfterAct(s *Simulation, a Agenter)               { h.OnAfterAct(s, a) }
+func (h *Hooks) AgentAdded(s *Simulation, a Agenter)             { h.OnAgentAdded(s, a) }
+func (h *Hooks) AgentRemoved(s *Simulation, a Agenter)           { h.OnAgentRemoved(s, a) }
+func (h *Hooks) LinkAdded(s *Simulation, layer string, l Link)   { h.OnLinkAdded(s, layer, l) }
+func (h *Hooks) LinkRemoved(s *Simulation, layer string, l Link) { h.OnLinkRemoved(s, layer, l) }
+func (h *Hooks) RunEnd(s *Simulation)                            { h.OnRunEnd(s) }
+
+// observers holds the registered observers by hook
+type observers struct {
+	beforeStep   []BeforeStepObserver
+	afterStep    []AfterStepObserver
+	beforeAct    []BeforeActObserver
+	afterAct     []AfterActObserver
+	agentAdded   []AgentAddedObserver
+	agentRemoved []AgentRemovedObserver
+	linkAdded    []LinkAddedObserver
+	linkRemoved  []LinkRemovedObserver
+	runEnd       []RunEndObserver
+}
+
+// Observe registers an observer, it has to implement at least one of the
+// observer interfaces
+func (s *Simulation) Observe(o interface{}) {
+	if h, ok := o.(Hooks); ok {
+		o = &h
+	}
+	if h, ok := o.(*Hooks); ok {
+		s.observeHooks(h)
+		return
+	}
+	n := 0
+	if x, ok := o.(BeforeStepObserver); ok {
+		s.obs.beforeStep = append(s.obs.beforeStep, x)
+		n++
+	}
+	if x, ok := o.(AfterStepObserver); ok {
+		s.obs.afterStep = append(s.obs.afterStep, x)
+		n++
+	}
+	if x, ok := o.(BeforeActObserver); ok {
+		s.obs.beforeAct = append(s.obs.beforeAct, x)
+		n++
+	}
+	if x, ok := o.(AfterActObserver); ok {
+		s.obs.afterAct = append(s.obs.afterAct, x)
+		n++
+	}
+	if x, ok := o.(AgentAddedObserver); ok {
+		s.obs.agentAdded = append(s.obs.agentAdded, x)
+		n++
+	}
+	if x, ok := o.(AgentRemovedObserver); ok {
+		s.obs.agentRemoved = append(s.obs.agentRemoved, x)
+		n++
+	}
+	if x, ok := o.(LinkAddedObserver); ok {
+		s.obs.linkAdded = append(s.obs.linkAdded, x)
+		n++
+	}
+	if x, ok := o.(LinkRemovedObserver); ok {
+		s.obs.linkRemoved = append(s.obs.linkRemoved, x)
+		n++
+	}
+	if x, ok := o.(RunEndObserver); ok {
+		s.obs.runEnd = append(s.obs.runEnd, x)
+		n++
+	}
+	if n == 0 {
+		panic(fmt.Sprintf("%T does not implement an observer interface", o))
+	}
+}
+
+// isObserver reports whether o implements one of the observer interfaces
+func isObserver(o interface{}) bool {
+	switch o.(type) {
+	case BeforeStepObserver, AfterStepObserver, BeforeActObserver, AfterActObserver,
+		AgentAddedObserver, AgentRemovedObserver, LinkAddedObserver, LinkRemovedObserver, RunEndObserver:
+		return true
+	}
+	return false
+}
+
+// observeHooks registers the functions of h which are set, so agent
+// activations are only slowed down if an act hook is set
+func (s *Simulation) observeHooks(h *Hooks) {
+	if h.OnBeforeStep != nil {
+		s.obs.beforeStep = append(s.obs.beforeStep, h)
+	}
+	if h.OnAfterStep != nil {
+		s.obs.afterStep = append(s.obs.afterStep, h)
+	}
+	if h.OnBeforeAct != nil {
+		s.obs.beforeAct = append(s.obs.beforeAct, h)
+	}
+	if h.OnAfterAct != nil {
+		s.obs.afterAct = append(s.obs.afterAct, h)
+	}
+	if h.OnAgentAdded != nil {
+		s.obs.agentAdded = append(s.obs.agentAdded, h)
+	}
+	if h.OnAgentRemoved != nil {
+		s.obs.agentRemoved = append(s.obs.agentRemoved, h)
+	}
+	if h.OnLinkAdded != nil {
+		s.obs.linkAdded = append(s.obs.linkAdded, h)
+	}
+	if h.OnLinkRemoved != nil {
+		s.obs.linkRemoved = append(s.obs.linkRemoved, h)
+	}
+	if h.OnRunEnd != nil {
+		s.obs.runEnd = append(s.obs.runEnd, h)
+	}
+}
+
+// AddAgent adds an agent created by the model to a DynamicLandscaper and
+// notifies the observers
+func (s *Simulation) AddAgent() Agenter {
+	d, ok := s.Landscape.(DynamicLandscaper)
+	if !ok {
+		panic("the landscape does not support adding agents")
+	}
+	a := d.AddAgent(s.Model)
+	for _, o := range s.obs.agentAdded {
+		o.AgentAdded(s, a)
+	}
+	return a
+}
+
+// RemoveAgent removes an agent from a DynamicLandscaper and notifies the
+// observers, it returns nil if the agent does not exist. An agent removed
+// during a step does not act in the rest of it.
+func (s *Simulation) RemoveAgent(id AgentID) Agenter {
+	d, ok := s.Landscape.(DynamicLandscaper)
+	if !ok {
+		panic("the landscape does not support removing agents")
+	}
+	a := d.RemoveAgent(id)
+	if a != nil {
+		if s.removed == nil {
+			s.removed = make(map[AgentID]bool)
+		}
+		s.removed[id] = true
+		for _, o := range s.obs.agentRemoved {
+			o.AgentRemoved(s, a)
+		}
+	}
+	return a
+}
+
+// linkChanged is set as the hook of the network layers
+func (s *Simulation) linkChanged(layer string, l Link, added bool) {
+	if added {
+		for _, o := range s.obs.linkAdded {
+			o.LinkAdded(s, layer, l)
+		}
+		return
+	}
+	for _, o := range s.obs.linkRemoved {
+		o.LinkRemoved(s, layer, l)
+	}
+}
+
+// linkNotifier is implemented by layers which report link changes
+type linkNotifier interface {
+	setLinkHook(func(l Link, added bool))
+}
+
+// observeLinks reports the link changes of the network layers of a
+// multiplex landscape to the observers
+func (s *Simulation) observeLinks() {
+	m, ok := s.Landscape.(*MultiplexLandscape)
+	if !ok {
+		return
+	}
+	for name, layer := range m.Layers {
+		if n, ok := layer.(linkNotifier); ok {
+			name := name
+			n.setLinkHook(func(l Link, added bool) { s.linkChanged(name, l, added) })
+		}
+	}
+}
+
+// the built in observers
+
+// AfterStep writes the model fields
+func (l *Logger) AfterStep(s *Simulation) {
+	l.Step(s.Stats)
+}
+
+// AfterStep collects the reporters if the step is due
+func (c *DataCollector) AfterStep(s *Simulation) {
+	if err := c.Collect(s.Stats, s.Model, *s.Landscape.GetAgents()); err != nil {
+		fmt.Println("error:", err)
+	}
+}
+
+// RunEnd closes the sinks
+func (c *DataCollector) RunEnd(s *Simulation) {
+	if err := c.Close(); err != nil {
+		fmt.Println("error:", err)
+	}
+}
+
+// AfterAct examines the links of the agent which acted again
+func (t *ActiveLinks) AfterAct(s *Simulation, a Agenter) {
+	t.Touch(a.ID())
+}
+
+func (t *ActiveLinks) AgentAdded(s *Simulation, a Agenter) {
+	t.Touch(a.ID())
+}
+
+func (t *ActiveLinks) AgentRemoved(s *Simulation, a Agenter) {
+	t.Touch(a.ID())
+}
+
+// journal writes a dump of the landscape to the journal after every step,
+// see MultiplexLandscape.DumpWithLayers for multiplex landscapes
+type journal struct {
+	a *Abst
+}
+
+func (j journal) AfterStep(s *Simulation) {
+	var dump interface{} = s.Landscape.Dump()
+	if m, ok := s.Landscape.(*MultiplexLandscape); ok {
+		// the links tell their layer
+		dump = m.DumpWithLayers()
+	}
+	b, err := json.Marshal(dump)
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	j.a.ZipJournal.Write(b)
+	j.a.ZipJournal.Write([]byte("\n\r\n"))
+	j.a.Journal.Sync()
+}
@@ -0,0 +1,152 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"reflect"
+	"testing"
+)
+
+// recorder is an observer of every hook which records the calls
+type recorder struct {
+	name  string
+	calls *[]string
+}
+
+func (r recorder) record(hook string) { *r.calls = append(*r.calls, r.name+" "+hook) }
+
+func (r recorder) BeforeStep(s *Simulation)              { r.record("before step") }
+func (r recorder) AfterStep(s *Simulation)               { r.record("after step") }
+func (r recorder) AgentAdded(s *Simulation, a Agenter)   { r.record("added") }
+func (r recorder) AgentRemoved(s *Simulation, a Agenter) { r.record("removed") }
+func (r recorder) RunEnd(s *Simulation)                  { r.record("run end") }
+
+func newDynamicSimulation(agents int) *Simulation {
+	s := &Simulation{Landscape: &FixedLandscapeWithMovement{Size: 10, NAgents: agents, Sight: 1}, Model: &testModel{P: 1}, Seed: 1}
+	s.AbstInterface.NoOutput = true
+	return s
+}
+
+func TestObserverHooks(t *testing.T) {
+	s := newDynamicSimulation(3)
+	var calls []string
+	s.Observe(recorder{"a", &calls})
+	s.Observe(recorder{"b", &calls})
+	s.Init()
+
+	s.Step()
+	added := s.AddAgent()
+	if s.RemoveAgent(added.ID()) != added {
+		t.Error("the added agent is not removed")
+	}
+	if s.RemoveAgent(added.ID()) != nil {
+		t.Error("an agent is removed twice")
+	}
+	s.Stop()
+	s.Stop()
+	want := []string{
+		"a before step", "b before step", "a after step", "b after step",
+		"a added", "b added", "a removed", "b removed",
+		"a run end", "b run end",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got the calls %q, want %q", calls, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("an observer without hooks is accepted")
+		}
+	}()
+	s.Observe(struct{}{})
+}
+
+func TestObserverActHooks(t *testing.T) {
+	s := newDynamicSimulation(20)
+	before := make(map[AgentID]int)
+	after := make(map[AgentID]int)
+	var acting AgentID = -1
+	s.Observe(Hooks{
+		OnBeforeAct: func(s *Simulation, a Agenter) {
+			if acting != -1 {
+				t.Errorf("agent %d acts before agent %d is done", a.ID(), acting)
+			}
+			acting = a.ID()
+			before[a.ID()]++
+		},
+		OnAfterAct: func(s *Simulation, a Agenter) {
+			if acting != a.ID() || a.(*testAgent).V != before[a.ID()] {
+				t.Errorf("agent %d: after act of agent %d with V=%d", a.ID(), acting, a.(*testAgent).V)
+			}
+			acting = -1
+			after[a.ID()]++
+		},
+	})
+	s.Run(MaxSteps(3))
+	if len(before) != 20 || !reflect.DeepEqual(before, after) {
+		t.Errorf("acts of %d agents, %v before and %v after", len(before), before, after)
+	}
+	for id, n := range before {
+		if n != 3 {
+			t.Errorf("agent %d acted %d times in 3 steps", id, n)
+		}
+	}
+	if s.Stats.Events != 60 {
+		t.Errorf("%d events, want 60", s.Stats.Events)
+	}
+}
+
+func TestRemoveDuringStep(t *testing.T) {
+	s := newDynamicSimulation(20)
+	acted := make(map[AgentID]int)
+	removed := make(map[AgentID]bool)
+	s.Observe(Hooks{
+		OnBeforeAct: func(s *Simulation, a Agenter) {
+			if removed[a.ID()] {
+				t.Errorf("the removed agent %d acts", a.ID())
+			}
+			acted[a.ID()]++
+			// the first agent to act removes the last agent and two others,
+			// the removal moves agents in the landscape
+			if len(removed) > 0 {
+				return
+			}
+			agents := *s.Landscape.GetAgents()
+			for _, i := range []int{len(agents) - 1, 0, 5} {
+				if id := agents[i].ID(); id != a.ID() {
+					removed[id] = true
+					s.RemoveAgent(id)
+				}
+			}
+		},
+	})
+	s.Run(MaxSteps(1))
+	if n := len(*s.Landscape.GetAgents()); n != 20-len(removed) {
+		t.Errorf("%d agents left after removing %d", n, len(removed))
+	}
+	// every agent which was not removed acted once
+	for _, a := range *s.Landscape.GetAgents() {
+		if acted[a.ID()] != 1 {
+			t.Errorf("agent %d acted %d times", a.ID(), acted[a.ID()])
+		}
+	}
+	if s.Stats.Events != len(acted) {
+		t.Errorf("%d events for %d acts", s.Stats.Events, len(acted))
+	}
+
+	// agents removed before the step do not act and the next step runs
+	// all the others
+	s = newDynamicSimulation(20)
+	s.Init()
+	for _, a := range (*s.Landscape.GetAgents())[:4] {
+		s.RemoveAgent(a.ID())
+	}
+	s.Step()
+	s.Step()
+	s.Stop()
+	if s.Stats.Events != 2*16 {
+		t.Errorf("%d events in two steps of 16 agents", s.Stats.Events)
+	}
+}
@@ -0,0 +1,388 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Optimizer searches the parameters within the bounds of Params which
+// minimise the objective. Every evaluation runs the simulation returned by
+// Build Replicates times, for Steps steps, until Until returns true or a
+// condition of Stop is met, and averages Objective. Replicate r of every
+// evaluation uses the same seed derived from Seed, so differences between
+// parameter sets are not hidden by noise. Integer parameters are passed
+// as int.
+type Optimizer struct {
+	Params         []Dimension
+	Build          func(p ParamSet, seed int64) (*Simulation, error)
+	Steps          int
+	Until          func(s *Simulation) bool
+	Stop           []StopCondition
+	Objective      func(s *Simulation) float64 // minimised
+	Replicates     int                         // runs per evaluation, 1 if 0
+	Seed           int64
+	Workers        int // parallel runs, number of CPUs if 0
+	MaxEvaluations int // 200 if 0
+	Tolerance      float64
+
+	cache       map[string]float64
+	evaluations int
+}
+
+// Optimum is the best parameter set found by an optimizer
+type Optimum struct {
+	Params      ParamSet
+	Objective   float64
+	Evaluations int       // distinct parameter sets evaluated
+	Runs        int       // simulations
+	History     []float64 // best objective after every iteration
+}
+
+func (o *Optimizer) maxEvaluations() int {
+	if o.MaxEvaluations <= 0 {
+		return 200
+	}
+	return o.MaxEvaluations
+}
+
+// params maps a point of the unit hypercube to a parameter set, points
+// outside are clamped to the bounds
+func (o *Optimizer) params(x []float64) ParamSet {
+	p := make(ParamSet, len(o.Params))
+	for i, d := range o.Params {
+		p[d.Name] = d.Value(math.Max(0, math.Min(1, x[i])))
+	}
+	return p
+}
+
+// unit maps a parameter set to the unit hypercube, missing parameters are
+// set to the middle of their range
+func (o *Optimizer) unit(p ParamSet) []float64 {
+	x := make([]float64, len(o.Params))
+	for i, d := range o.Params {
+		x[i] = 0.5
+		if v, ok := toFloat64(p[d.Name]); ok && d.Max > d.Min {
+			if d.Integer {
+				// the middle of the interval of the integer
+				x[i] = (v - d.Min + 0.5) / (d.Max - d.Min + 1)
+			} else {
+				x[i] = (v - d.Min) / (d.Max - d.Min)
+			}
+		}
+	}
+	return x
+}
+
+// evaluate returns the objective of every point, the runs of all points
+// and replicates are executed in parallel. Parameter sets which were
+// evaluated before are taken from the cache, as integer parameters often
+// map different points to the same set.
+func (o *Optimizer) evaluate(points [][]float64) ([]float64, error) {
+	if o.cache == nil {
+		o.cache = make(map[string]float64)
+	}
+	replicates := o.Replicates
+	if replicates <= 0 {
+		replicates = 1
+	}
+	workers := o.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	res := make([]float64, len(points))
+	keys := make([]string, len(points))
+	var todo []int
+	pending := make(map[string]bool)
+	for i, x := range points {
+		keys[i] = fmt.Sprint(o.paramValues(x))
+		if _, ok := o.cache[keys[i]]; !ok && !pending[keys[i]] {
+			pending[keys[i]] = true
+			todo = append(todo, i)
+		}
+	}
+
+	sums := make([]float64, len(todo)*replicates)
+	errs := make([]error, len(todo)*replicates)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				i, r := todo[j/replicates], j%replicates
+				sim, err := runBuilt(o.Build, o.params(points[i]), DeriveSeed(o.Seed, r), stopConditions(o.Steps, o.Until, o.Stop))
+				if err != nil {
+					errs[j] = err
+					continue
+				}
+				sums[j] = o.Objective(sim)
+			}
+		}()
+	}
+	for j := range sums {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	for t, i := range todo {
+		var mean float64
+		for r := 0; r < replicates; r++ {
+			mean += sums[t*replicates+r]
+		}
+		o.cache[keys[i]] = mean / float64(replicates)
+		o.evaluations++
+	}
+	for i := range points {
+		res[i] = o.cache[keys[i]]
+	}
+	return res, nil
+}
+
+// paramValues returns the parameter values of a point in the order of
+// Params
+func (o *Optimizer) paramValues(x []float64) []interface{} {
+	p := o.params(x)
+	values := make([]interface{}, len(o.Params))
+	for i, d := range o.Params {
+		values[i] = p[d.Name]
+	}
+	return values
+}
+
+func (o *Optimizer) check() error {
+	if o.Build == nil || o.Objective == nil {
+		return fmt.Errorf("optimizer: Build and Objective are required")
+	}
+	if len(o.Params) == 0 {
+		return fmt.Errorf("optimizer: no parameters")
+	}
+	return nil
+}
+
+func (o *Optimizer) optimum(x []float64, f float64, history []float64) *Optimum {
+	replicates := o.Replicates
+	if replicates <= 0 {
+		replicates = 1
+	}
+	return &Optimum{
+		Params:      o.params(x),
+		Objective:   f,
+		Evaluations: o.evaluations,
+		Runs:        o.evaluations * replicates,
+		History:     history,
+	}
+}
+
+// NelderMead minimises the objective with the Nelder-Mead simplex method,
+// starting at start (the middle of the bounds for missing parameters).
+// It stops after MaxEvaluations or when the objectives of the simplex
+// differ by less than Tolerance.
+func (o *Optimizer) NelderMead(start ParamSet) (*Optimum, error) {
+	if err := o.check(); err != nil {
+		return nil, err
+	}
+	o.cache, o.evaluations = nil, 0
+	k := len(o.Params)
+
+	// initial simplex, integer parameters need steps of at least one value
+	simplex := make([][]float64, k+1)
+	simplex[0] = o.unit(start)
+	for i := 0; i < k; i++ {
+		x := append([]float64(nil), simplex[0]...)
+		step := 0.1
+		if d := o.Params[i]; d.Integer {
+			step = math.Max(step, 1/(d.Max-d.Min+1))
+		}
+		if x[i]+step > 1 {
+			step = -step
+		}
+		x[i] += step
+		simplex[i+1] = x
+	}
+	f, err := o.evaluate(simplex)
+	if err != nil {
+		return nil, err
+	}
+
+	clamp := func(x []float64) []float64 {
+		for i := range x {
+			x[i] = math.Max(0, math.Min(1, x[i]))
+		}
+		return x
+	}
+	// along returns c + t*(x-c)
+	along := func(c, x []float64, t float64) []float64 {
+		y := make([]float64, k)
+		for i := range y {
+			y[i] = c[i] + t*(x[i]-c[i])
+		}
+		return clamp(y)
+	}
+	one := func(x []float64) (float64, error) {
+		v, err := o.evaluate([][]float64{x})
+		if err != nil {
+			return 0, err
+		}
+		return v[0], nil
+	}
+
+	var history []float64
+	for o.evaluations < o.maxEvaluations() {
+		sort.Sort(&simplexOrder{simplex, f})
+		history = append(history, f[0])
+		if f[k]-f[0] <= o.Tolerance {
+			break
+		}
+
+		centroid := make([]float64, k)
+		for _, x := range simplex[:k] {
+			for i := range centroid {
+				centroid[i] += x[i] / float64(k)
+			}
+		}
+		reflected := along(centroid, simplex[k], -1)
+		fr, err := one(reflected)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case fr < f[0]:
+			expanded := along(centroid, simplex[k], -2)
+			fe, err := one(expanded)
+			if err != nil {
+				return nil, err
+			}
+			if fe < fr {
+				simplex[k], f[k] = expanded, fe
+			} else {
+				simplex[k], f[k] = reflected, fr
+			}
+		case fr < f[k-1]:
+			simplex[k], f[k] = reflected, fr
+		default:
+			// contract towards the better of the worst and the reflected point
+			t := 0.5
+			if fr < f[k] {
+				t = -0.5
+			}
+			contracted := along(centroid, simplex[k], t)
+			fc, err := one(contracted)
+			if err != nil {
+				return nil, err
+			}
+			if fc < math.Min(fr, f[k]) {
+				simplex[k], f[k] = contracted, fc
+				continue
+			}
+			// shrink towards the best point
+			for i := 1; i <= k; i++ {
+				simplex[i] = along(simplex[0], simplex[i], 0.5)
+			}
+			shrunk, err := o.evaluate(simplex[1:])
+			if err != nil {
+				return nil, err
+			}
+			copy(f[1:], shrunk)
+		}
+	}
+	sort.Sort(&simplexOrder{simplex, f})
+	return o.optimum(simplex[0], f[0], history), nil
+}
+
+// simplexOrder sorts the points of a simplex by their objective
+type simplexOrder struct {
+	x [][]float64
+	f []float64
+}
+
+func (s *simplexOrder) Len() int           { return len(s.f) }
+func (s *simplexOrder) Less(i, j int) bool { return s.f[i] < s.f[j] }
+func (s *simplexOrder) Swap(i, j int) {
+	s.x[i], s.x[j] = s.x[j], s.x[i]
+	s.f[i], s.f[j] = s.f[j], s.f[i]
+}
+
+// Genetic minimises the objective with a real coded genetic algorithm:
+// the first generation is a latin hypercube, parents are selected by
+// binary tournaments, children are blends of their parents with gaussian
+// mutations and the best parameter set always survives. The population of
+// a generation is evaluated in parallel. It stops after the generations or
+// MaxEvaluations.
+func (o *Optimizer) Genetic(population, generations int) (*Optimum, error) {
+	if err := o.check(); err != nil {
+		return nil, err
+	}
+	if population < 2 {
+		population = 20
+	}
+	o.cache, o.evaluations = nil, 0
+	k := len(o.Params)
+	r := rand.New(rand.NewSource(o.Seed))
+
+	pop, _ := LatinHypercube{}.Sample(population, k, r)
+	f, err := o.evaluate(pop)
+	if err != nil {
+		return nil, err
+	}
+
+	best := func() int {
+		b := 0
+		for i := range f {
+			if f[i] < f[b] {
+				b = i
+			}
+		}
+		return b
+	}
+	tournament := func() []float64 {
+		i, j := r.Intn(population), r.Intn(population)
+		if f[j] < f[i] {
+			i = j
+		}
+		return pop[i]
+	}
+
+	var history []float64
+	for g := 0; g < generations && o.evaluations < o.maxEvaluations(); g++ {
+		b := best()
+		history = append(history, f[b])
+		next := [][]float64{pop[b]}
+		for len(next) < population {
+			a, c := tournament(), tournament()
+			child := make([]float64, k)
+			for i := range child {
+				// blend crossover, children may lie a bit outside the parents
+				t := r.Float64()*1.5 - 0.25
+				child[i] = a[i] + t*(c[i]-a[i])
+				if r.Float64() < 1/float64(k) {
+					child[i] += r.NormFloat64() * 0.1
+				}
+				child[i] = math.Max(0, math.Min(1, child[i]))
+			}
+			next = append(next, child)
+		}
+		pop = next
+		if f, err = o.evaluate(pop); err != nil {
+			return nil, err
+		}
+	}
+	b := best()
+	history = append(history, f[b])
+	return o.optimum(pop[b], f[b], history), nil
+}
@@ -0,0 +1,116 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// pointModel is a testModel at a point of the parameter space
+type pointModel struct {
+	testModel
+	X, Y float64
+}
+
+// optimizer returns an optimizer of f on [-2,2]^2
+func optimizer(f func(x, y float64) float64) *Optimizer {
+	return &Optimizer{
+		Params: []Dimension{{Name: "X", Min: -2, Max: 2}, {Name: "Y", Min: -2, Max: 2}},
+		Build: func(p ParamSet, seed int64) (*Simulation, error) {
+			x, _ := toFloat64(p["X"])
+			y, _ := toFloat64(p["Y"])
+			m := &pointModel{X: x, Y: y}
+			return &Simulation{Landscape: &FixedLandscapeNoMovement{Size: 1}, Model: m}, nil
+		},
+		Steps: 1,
+		Objective: func(s *Simulation) float64 {
+			m := s.Model.(*pointModel)
+			return f(m.X, m.Y)
+		},
+		Seed:    1,
+		Workers: 2,
+	}
+}
+
+func quadratic(x, y float64) float64 {
+	return (x-0.3)*(x-0.3) + 2*(y+0.5)*(y+0.5)
+}
+
+func rosenbrock(x, y float64) float64 {
+	return (1-x)*(1-x) + 100*(y-x*x)*(y-x*x)
+}
+
+func TestOptimizers(t *testing.T) {
+	tests := []struct {
+		name      string
+		f         func(x, y float64) float64
+		x, y      float64
+		tolerance float64
+		run       func(o *Optimizer) (*Optimum, error)
+	}{
+		{"nelder-mead quadratic", quadratic, 0.3, -0.5, 0.01, func(o *Optimizer) (*Optimum, error) {
+			o.MaxEvaluations, o.Tolerance = 300, 1e-12
+			return o.NelderMead(ParamSet{"X": -1.0, "Y": 1.0})
+		}},
+		{"nelder-mead rosenbrock", rosenbrock, 1, 1, 0.05, func(o *Optimizer) (*Optimum, error) {
+			o.MaxEvaluations, o.Tolerance = 1000, 1e-12
+			return o.NelderMead(ParamSet{"X": -1.0, "Y": 1.0})
+		}},
+		{"genetic quadratic", quadratic, 0.3, -0.5, 0.05, func(o *Optimizer) (*Optimum, error) {
+			o.MaxEvaluations = 2000
+			return o.Genetic(30, 50)
+		}},
+	}
+	withOutputDir(t, func(dir string) {
+		for _, tt := range tests {
+			o := optimizer(tt.f)
+			opt, err := tt.run(o)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			x, y := opt.Params["X"].(float64), opt.Params["Y"].(float64)
+			if math.Abs(x-tt.x) > tt.tolerance || math.Abs(y-tt.y) > tt.tolerance {
+				t.Errorf("%s: minimum at %.3f/%.3f, want %v/%v", tt.name, x, y, tt.x, tt.y)
+			}
+			if opt.Objective != tt.f(x, y) {
+				t.Errorf("%s: objective %v at the minimum, want %v", tt.name, opt.Objective, tt.f(x, y))
+			}
+			for i := 1; i < len(opt.History); i++ {
+				if opt.History[i] > opt.History[i-1] {
+					t.Errorf("%s: the best objective got worse: %v", tt.name, opt.History)
+					break
+				}
+			}
+			if opt.Evaluations > o.MaxEvaluations+30 {
+				t.Errorf("%s: %d evaluations, the maximum is %d", tt.name, opt.Evaluations, o.MaxEvaluations)
+			}
+
+			// the same seed finds the same optimum
+			again, err := tt.run(optimizer(tt.f))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(again, opt) {
+				t.Errorf("%s: not reproducible: %+v and %+v", tt.name, opt, again)
+			}
+		}
+	})
+}
+
+func TestOptimizerIntegerParams(t *testing.T) {
+	withOutputDir(t, func(dir string) {
+		o := optimizer(func(x, y float64) float64 { return math.Abs(x-1) + math.Abs(y+1) })
+		o.Params = []Dimension{{Name: "X", Min: -5, Max: 5, Integer: true}, {Name: "Y", Min: -5, Max: 5, Integer: true}}
+		opt, err := o.Genetic(20, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opt.Params["X"] != 1 || opt.Params["Y"] != -1 {
+			t.Errorf("minimum at %v, want X=1 and Y=-1", opt.Params)
+		}
+	})
+}
@@ -0,0 +1,383 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParamType is the type of a model parameter
+type ParamType int
+
+const (
+	BoolParam ParamType = iota
+	IntParam
+	FloatParam
+	StringParam
+	EnumParam // a string out of a list of choices
+)
+
+func (t ParamType) String() string {
+	return [...]string{"bool", "int", "float", "string", "enum"}[t]
+}
+
+func (t ParamType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// ParamSpec describes a model parameter. Parameters are fields of the
+// model tagged with `goabm:"param"`, the other tags describe them:
+//
+//	Traits int     `goabm:"hide,param" default:"15" min:"2" desc:"traits per feature"`
+//	Rule   string  `goabm:"hide,param" choices:"random|sequential"`
+//	Noise  float64 `goabm:"hide,param" min:"0" max:"1" flag:"noise"`
+//
+// The default is the value of the field when the parameters are read if
+// there is no default tag.
+type ParamSpec struct {
+	Name        string      `json:"name"`
+	Flag        string      `json:"flag"` // name of the command line flag, the lower case name by default
+	Type        ParamType   `json:"type"`
+	Default     interface{} `json:"default"`
+	Min         float64     `json:"min,omitempty"` // range of numeric parameters
+	Max         float64     `json:"max,omitempty"`
+	HasMin      bool        `json:"has_min,omitempty"`
+	HasMax      bool        `json:"has_max,omitempty"`
+	Choices     []string    `json:"choices,omitempty"`
+	Description string      `json:"description,omitempty"`
+	index       []int
+	kind        reflect.Type
+}
+
+// Params is the parameter schema of a model type
+type Params struct {
+	Specs []ParamSpec `json:"params"`
+	typ   reflect.Type
+}
+
+// NewParams reads the parameters of the model, a pointer to a struct
+func NewParams(model interface{}) (*Params, error) {
+	v := reflect.ValueOf(model)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("params: %T is not a pointer to a struct", model)
+	}
+	p := &Params{typ: v.Type()}
+	if err := p.read(v.Elem(), nil); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// read collects the parameters of the struct v, embedded structs are
+// searched as well
+func (p *Params) read(v reflect.Value, index []int) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		idx := append(append([]int(nil), index...), i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && !hasTagOption(f, "param") {
+			if err := p.read(v.Field(i), idx); err != nil {
+				return err
+			}
+			continue
+		}
+		if f.PkgPath != "" || !hasTagOption(f, "param") {
+			continue
+		}
+		s, err := newParamSpec(f, v.Field(i), idx)
+		if err != nil {
+			return err
+		}
+		p.Specs = append(p.Specs, s)
+	}
+	return nil
+}
+
+func newParamSpec(f reflect.StructField, v reflect.Value, index []int) (ParamSpec, error) {
+	s := ParamSpec{
+		Name:        f.Name,
+		Flag:        f.Tag.Get("flag"),
+		Description: f.Tag.Get("desc"),
+		index:       index,
+		kind:        f.Type,
+	}
+	if s.Flag == "" {
+		s.Flag = strings.ToLower(f.Name)
+	}
+	switch f.Type.Kind() {
+	case reflect.Bool:
+		s.Type = BoolParam
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.Type = IntParam
+	case reflect.Float32, reflect.Float64:
+		s.Type = FloatParam
+	case reflect.String:
+		s.Type = StringParam
+		if c := f.Tag.Get("choices"); c != "" {
+			s.Type = EnumParam
+			s.Choices = strings.Split(c, "|")
+		}
+	default:
+		return s, fmt.Errorf("params: %s has the unsupported type %v", f.Name, f.Type)
+	}
+	for _, b := range []struct {
+		tag string
+		val *float64
+		has *bool
+	}{{"min", &s.Min, &s.HasMin}, {"max", &s.Max, &s.HasMax}} {
+		if t := f.Tag.Get(b.tag); t != "" {
+			x, err := strconv.ParseFloat(t, 64)
+			if err != nil {
+				return s, fmt.Errorf("params: %s: invalid %s %q", f.Name, b.tag, t)
+			}
+			*b.val, *b.has = x, true
+		}
+	}
+
+	s.Default = v.Interface()
+	if d, ok := f.Tag.Lookup("default"); ok {
+		x, err := s.Convert(d)
+		if err != nil {
+			return s, fmt.Errorf("params: default of %s: %v", f.Name, err)
+		}
+		s.Default = x
+	} else if s.Type == EnumParam && v.String() == "" {
+		// an empty enum defaults to the first choice
+		s.Default = reflect.ValueOf(s.Choices[0]).Convert(f.Type).Interface()
+	}
+	return s, nil
+}
+
+// Convert converts a value to the type of the parameter and checks it,
+// strings are parsed, so values from flags, JSON and ParamSets can be used
+func (s *ParamSpec) Convert(value interface{}) (interface{}, error) {
+	var x interface{}
+	str, isString := value.(string)
+	switch s.Type {
+	case BoolParam:
+		if isString {
+			b, err := strconv.ParseBool(str)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %q is not a bool", s.Name, str)
+			}
+			x = b
+		} else if b, ok := value.(bool); ok {
+			x = b
+		}
+	case IntParam:
+		if isString {
+			i, err := strconv.ParseInt(str, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %q is not an integer", s.Name, str)
+			}
+			x = i
+		} else if f, ok := toFloat64(value); ok && reflect.TypeOf(value).Kind() != reflect.Bool {
+			if f != math.Trunc(f) {
+				return nil, fmt.Errorf("%s: %v is not an integer", s.Name, value)
+			}
+			x = int64(f)
+		}
+	case FloatParam:
+		if isString {
+			f, err := strconv.ParseFloat(str, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %q is not a number", s.Name, str)
+			}
+			x = f
+		} else if f, ok := toFloat64(value); ok && reflect.TypeOf(value).Kind() != reflect.Bool {
+			x = f
+		}
+	case StringParam, EnumParam:
+		if v := reflect.ValueOf(value); v.Kind() == reflect.String {
+			x = v.String()
+		}
+	}
+	if x == nil {
+		return nil, fmt.Errorf("%s: %v (%T) is not a %v", s.Name, value, value, s.Type)
+	}
+	res := reflect.ValueOf(x).Convert(s.kind).Interface()
+	if err := s.Check(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Check validates a value of the parameter type against the range or the
+// choices
+func (s *ParamSpec) Check(value interface{}) error {
+	switch s.Type {
+	case IntParam, FloatParam:
+		f, _ := toFloat64(value)
+		if s.HasMin && f < s.Min {
+			return fmt.Errorf("%s: %v is less than the minimum %v", s.Name, value, s.Min)
+		}
+		if s.HasMax && f > s.Max {
+			return fmt.Errorf("%s: %v is greater than the maximum %v", s.Name, value, s.Max)
+		}
+	case EnumParam:
+		str := reflect.ValueOf(value).String()
+		for _, c := range s.Choices {
+			if c == str {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %q is not one of %s", s.Name, str, strings.Join(s.Choices, ", "))
+	}
+	return nil
+}
+
+// Spec returns the parameter with the given name or flag name or nil
+func (p *Params) Spec(name string) *ParamSpec {
+	for i := range p.Specs {
+		if p.Specs[i].Name == name || p.Specs[i].Flag == name {
+			return &p.Specs[i]
+		}
+	}
+	return nil
+}
+
+// field returns the field of the parameter in the model
+func (p *Params) field(model interface{}, s *ParamSpec) reflect.Value {
+	v := reflect.ValueOf(model)
+	if v.Type() != p.typ {
+		panic(fmt.Sprintf("params of %v used with %T", p.typ, model))
+	}
+	return v.Elem().FieldByIndex(s.index)
+}
+
+// Set converts, validates and sets a parameter of the model
+func (p *Params) Set(model interface{}, name string, value interface{}) error {
+	s := p.Spec(name)
+	if s == nil {
+		return fmt.Errorf("unknown parameter %s", name)
+	}
+	x, err := s.Convert(value)
+	if err != nil {
+		return err
+	}
+	p.field(model, s).Set(reflect.ValueOf(x))
+	return nil
+}
+
+// Get returns the value of a parameter of the model
+func (p *Params) Get(model interface{}, name string) interface{} {
+	s := p.Spec(name)
+	if s == nil {
+		return nil
+	}
+	return p.field(model, s).Interface()
+}
+
+// SetDefaults sets all parameters of the model to their defaults
+func (p *Params) SetDefaults(model interface{}) {
+	for i := range p.Specs {
+		p.field(model, &p.Specs[i]).Set(reflect.ValueOf(p.Specs[i].Default))
+	}
+}
+
+// Apply sets the parameters of a batch run, all names have to exist.
+// The parameters are applied in sorted order, the first error is returned.
+func (p *Params) Apply(model interface{}, set ParamSet) error {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := p.Set(model, name, set[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks the current values of all parameters of the model
+func (p *Params) Validate(model interface{}) error {
+	for i := range p.Specs {
+		if err := p.Specs[i].Check(p.field(model, &p.Specs[i]).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dimensions returns the numeric parameters with a range, e.g. for a
+// design of experiments
+func (p *Params) Dimensions() []Dimension {
+	var dims []Dimension
+	for _, s := range p.Specs {
+		if (s.Type == IntParam || s.Type == FloatParam) && s.HasMin && s.HasMax {
+			dims = append(dims, Dimension{Name: s.Name, Min: s.Min, Max: s.Max, Integer: s.Type == IntParam})
+		}
+	}
+	return dims
+}
+
+// paramFlag sets a parameter from the command line
+type paramFlag struct {
+	p     *Params
+	model interface{}
+	spec  *ParamSpec
+}
+
+func (f paramFlag) String() string {
+	if f.p == nil {
+		return ""
+	}
+	return fmt.Sprint(f.p.field(f.model, f.spec).Interface())
+}
+
+func (f paramFlag) Set(s string) error {
+	return f.p.Set(f.model, f.spec.Name, s)
+}
+
+func (f paramFlag) IsBoolFlag() bool {
+	return f.spec != nil && f.spec.Type == BoolParam
+}
+
+// usage is the help text of a parameter flag
+func (s *ParamSpec) usage() string {
+	u := s.Description
+	if u == "" {
+		u = s.Name
+	}
+	switch {
+	case s.Type == EnumParam:
+		u += " (" + strings.Join(s.Choices, ", ") + ")"
+	case s.HasMin && s.HasMax:
+		u += fmt.Sprintf(" (%v to %v)", s.Min, s.Max)
+	case s.HasMin:
+		u += fmt.Sprintf(" (at least %v)", s.Min)
+	case s.HasMax:
+		u += fmt.Sprintf(" (at most %v)", s.Max)
+	}
+	return u
+}
+
+// RegisterFlags sets the parameters of the model to their defaults and
+// adds a flag for every parameter to fs, the flags set the model fields
+func (p *Params) RegisterFlags(fs *flag.FlagSet, model interface{}) {
+	p.SetDefaults(model)
+	for i := range p.Specs {
+		s := &p.Specs[i]
+		fs.Var(paramFlag{p, model, s}, s.Flag, s.usage())
+	}
+}
+
+// ApplyParams sets the parameters of a batch run on the model, see
+// Params.Apply
+func ApplyParams(model interface{}, set ParamSet) error {
+	p, err := NewParams(model)
+	if err != nil {
+		return err
+	}
+	return p.Apply(model, set)
+}
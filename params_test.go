@@ -0,0 +1,160 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// paramModel has a parameter of every type
+type paramModel struct {
+	testModel
+	Traits  int     `goabm:"hide,param" default:"15" min:"2" max:"20" desc:"traits per feature"`
+	Rule    string  `goabm:"hide,param" choices:"random|sequential"`
+	Noise   float64 `goabm:"hide,param" min:"0" max:"1" flag:"noise-rate"`
+	Media   bool    `goabm:"hide,param"`
+	Name    string  `goabm:"hide,param" default:"run"`
+	Ignored int     // not a parameter
+}
+
+func TestParamSpecs(t *testing.T) {
+	m := &paramModel{Noise: 0.5}
+	p, err := NewParams(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ParamSpec{
+		{Name: "P", Flag: "p", Type: FloatParam, Default: 0.0, Min: 0, Max: 1, HasMin: true, HasMax: true},
+		{Name: "Traits", Flag: "traits", Type: IntParam, Default: 15, Min: 2, Max: 20, HasMin: true, HasMax: true, Description: "traits per feature"},
+		{Name: "Rule", Flag: "rule", Type: EnumParam, Default: "random", Choices: []string{"random", "sequential"}},
+		{Name: "Noise", Flag: "noise-rate", Type: FloatParam, Default: 0.5, Min: 0, Max: 1, HasMin: true, HasMax: true},
+		{Name: "Media", Flag: "media", Type: BoolParam, Default: false},
+		{Name: "Name", Flag: "name", Type: StringParam, Default: "run"},
+	}
+	if len(p.Specs) != len(want) {
+		t.Fatalf("%d specs, want %d: %+v", len(p.Specs), len(want), p.Specs)
+	}
+	for i, s := range p.Specs {
+		s.index, s.kind = nil, nil
+		if !reflect.DeepEqual(s, want[i]) {
+			t.Errorf("got %+v, want %+v", s, want[i])
+		}
+	}
+
+	if _, err := NewParams(paramModel{}); err == nil {
+		t.Error("a struct which is not a pointer is accepted")
+	}
+	bad := []interface{}{
+		&struct {
+			X []int `goabm:"param"`
+		}{},
+		&struct {
+			X int `goabm:"param" min:"a"`
+		}{},
+		&struct {
+			X int `goabm:"param" default:"1.5"`
+		}{},
+		&struct {
+			X string `goabm:"param" choices:"a|b" default:"c"`
+		}{},
+	}
+	for _, m := range bad {
+		if _, err := NewParams(m); err == nil {
+			t.Errorf("%T is accepted", m)
+		}
+	}
+}
+
+func TestParamConvert(t *testing.T) {
+	p, err := NewParams(&paramModel{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+		err   string // part of the error, "" if there is none
+	}{
+		{"Traits", "7", 7, ""},
+		{"Traits", 7.0, 7, ""},
+		{"Traits", int64(20), 20, ""},
+		{"Traits", 7.5, nil, "not an integer"},
+		{"Traits", "seven", nil, "not an integer"},
+		{"Traits", true, nil, "is not a int"},
+		{"Traits", 1, nil, "less than the minimum"},
+		{"Traits", "21", nil, "greater than the maximum"},
+		{"Noise", "0.25", 0.25, ""},
+		{"Noise", 1, 1.0, ""},
+		{"Noise", -0.1, nil, "less than the minimum"},
+		{"Noise", "x", nil, "not a number"},
+		{"Rule", "sequential", "sequential", ""},
+		{"Rule", "other", nil, "not one of random, sequential"},
+		{"Rule", 1, nil, "is not a enum"},
+		{"Media", "true", true, ""},
+		{"Media", false, false, ""},
+		{"Media", "yes", nil, "not a bool"},
+		{"Media", 1, nil, "is not a bool"},
+		{"Name", "a b", "a b", ""},
+	}
+	for _, tt := range tests {
+		got, err := p.Spec(tt.name).Convert(tt.value)
+		if tt.err == "" {
+			if err != nil || got != tt.want {
+				t.Errorf("%s %v: got %v (%T) and %v, want %v (%T)", tt.name, tt.value, got, got, err, tt.want, tt.want)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s %v: got the error %v, want %q", tt.name, tt.value, err, tt.err)
+		}
+	}
+
+	// Validate checks the values set directly
+	m := &paramModel{Traits: 10, Rule: "random"}
+	if err := p.Validate(m); err != nil {
+		t.Error(err)
+	}
+	m.Rule = "unknown"
+	if err := p.Validate(m); err == nil {
+		t.Error("an invalid choice is valid")
+	}
+	if err := p.Apply(m, ParamSet{"Traits": 3, "Missing": 1}); err == nil {
+		t.Error("an unknown parameter is applied")
+	}
+}
+
+func TestParamFlags(t *testing.T) {
+	m := &paramModel{}
+	p, err := NewParams(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	p.RegisterFlags(fs, m)
+	// the defaults are set before the flags are parsed
+	if m.Traits != 15 || m.Rule != "random" || m.Name != "run" {
+		t.Errorf("defaults not set: %+v", m)
+	}
+	if fs.Lookup("ignored") != nil {
+		t.Error("a field which is not a parameter has a flag")
+	}
+	if u := fs.Lookup("traits").Usage; u != "traits per feature (2 to 20)" {
+		t.Errorf("usage %q", u)
+	}
+	if err := fs.Parse([]string{"-traits", "4", "-rule", "sequential", "-noise-rate", "0.1", "-media", "-name", "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if m.Traits != 4 || m.Rule != "sequential" || m.Noise != 0.1 || !m.Media || m.Name != "x" {
+		t.Errorf("flags not applied: %+v", m)
+	}
+	fs.SetOutput(new(strings.Builder))
+	for _, args := range [][]string{{"-traits", "1"}, {"-rule", "x"}, {"-noise", "0.1"}} {
+		if err := fs.Parse(args); err == nil {
+			t.Errorf("%v is accepted", args)
+		}
+	}
+}
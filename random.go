@@ -0,0 +1,68 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import "math/rand"
+
+// RandSetter is implemented by landscapes and models which draw from the
+// random number generator of the simulation, Simulation.Init hands it over
+// so a run can be reproduced from Simulation.Seed
+type RandSetter interface {
+	SetRand(*rand.Rand)
+}
+
+// returns a random agent, nil if there are none
+func randomAgent(r *rand.Rand, agents []Agenter) Agenter {
+	if len(agents) == 0 {
+		return nil
+	}
+	return agents[r.Intn(len(agents))]
+}
+
+// returns k distinct random agents in random order, all agents if there
+// are fewer than k
+func randomAgents(r *rand.Rand, agents []Agenter, k int) []Agenter {
+	n := len(agents)
+	if k > n {
+		k = n
+	}
+	if k <= 0 {
+		return nil
+	}
+
+	// Floyd's algorithm, only needs k draws
+	chosen := make(map[int]bool, k)
+	picked := make([]Agenter, 0, k)
+	for j := n - k; j < n; j++ {
+		t := r.Intn(j + 1)
+		if chosen[t] {
+			t = j
+		}
+		chosen[t] = true
+		picked = append(picked, agents[t])
+	}
+	r.Shuffle(len(picked), func(i, j int) {
+		picked[i], picked[j] = picked[j], picked[i]
+	})
+	return picked
+}
+
+// returns a random agent for which match is true, every matching agent is
+// equally likely, nil if none matches
+func randomAgentWhere(r *rand.Rand, agents []Agenter, match func(Agenter) bool) Agenter {
+	var chosen Agenter
+	seen := 0
+	// reservoir sampling over the matching agents
+	for _, a := range agents {
+		if !match(a) {
+			continue
+		}
+		seen++
+		if r.Intn(seen) == 0 {
+			chosen = a
+		}
+	}
+	return chosen
+}
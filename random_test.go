@@ -0,0 +1,111 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// population returns n agents with the ids 0..n-1
+func population(n int) []Agenter {
+	agents := make([]Agenter, n)
+	for i := range agents {
+		agents[i] = &collectAgent{id: AgentID(i)}
+	}
+	return agents
+}
+
+func TestRandomAgents(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	agents := population(10)
+	for _, tt := range []struct{ k, n int }{{0, 0}, {-1, 0}, {1, 1}, {5, 5}, {10, 10}, {15, 10}} {
+		picked := randomAgents(r, agents, tt.k)
+		if len(picked) != tt.n {
+			t.Errorf("k=%d: %d agents, want %d", tt.k, len(picked), tt.n)
+		}
+		seen := make(map[AgentID]bool)
+		for _, a := range picked {
+			if seen[a.ID()] || a.ID() < 0 || a.ID() >= 10 {
+				t.Errorf("k=%d: the agent %d is picked twice or is unknown, %v", tt.k, a.ID(), ids(picked))
+			}
+			seen[a.ID()] = true
+		}
+	}
+	if picked := randomAgents(r, nil, 3); picked != nil {
+		t.Errorf("picked %v from no agents", ids(picked))
+	}
+
+	// every agent is equally likely, in every position of the result
+	const trials = 20000
+	var counts, first [10]int
+	for i := 0; i < trials; i++ {
+		picked := randomAgents(r, agents, 3)
+		for _, a := range picked {
+			counts[a.ID()]++
+		}
+		first[picked[0].ID()]++
+	}
+	for id := range counts {
+		if c := float64(counts[id]) / trials; c < 0.28 || c > 0.32 {
+			t.Errorf("agent %d is picked in %.3f of the trials, want 0.3", id, c)
+		}
+		if c := float64(first[id]) / trials; c < 0.08 || c > 0.12 {
+			t.Errorf("agent %d is first in %.3f of the trials, want 0.1", id, c)
+		}
+	}
+}
+
+func TestRandomAgentWhere(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	agents := population(10)
+	even := func(a Agenter) bool { return a.ID()%2 == 0 }
+
+	const trials = 20000
+	var counts [10]int
+	for i := 0; i < trials; i++ {
+		counts[randomAgentWhere(r, agents, even).ID()]++
+	}
+	for id, n := range counts {
+		c := float64(n) / trials
+		if id%2 == 1 && n > 0 {
+			t.Errorf("the odd agent %d is picked", id)
+		}
+		if id%2 == 0 && (c < 0.18 || c > 0.22) {
+			t.Errorf("agent %d is picked in %.3f of the trials, want 0.2", id, c)
+		}
+	}
+
+	none := func(a Agenter) bool { return false }
+	if a := randomAgentWhere(r, agents, none); a != nil {
+		t.Errorf("picked %d although no agent matches", a.ID())
+	}
+	if a := randomAgentWhere(r, nil, even); a != nil {
+		t.Errorf("picked %d from no agents", a.ID())
+	}
+	if a := randomAgent(r, nil); a != nil {
+		t.Errorf("picked %d from no agents", a.ID())
+	}
+}
+
+func TestLandscapeRandomAgents(t *testing.T) {
+	// the landscapes draw from the generator of the simulation
+	for _, seed := range []int64{1, 2} {
+		var got [2][]AgentID
+		for i := range got {
+			l := &FixedLandscapeNoMovement{Size: 4}
+			l.SetRand(rand.New(rand.NewSource(seed)))
+			l.Init(&testModel{})
+			got[i] = ids(l.RandomAgents(20))
+			if len(got[i]) != 16 {
+				t.Errorf("%d agents of 16, want all", len(got[i]))
+			}
+		}
+		if !reflect.DeepEqual(got[0], got[1]) {
+			t.Errorf("seed %d: the picks %v and %v differ", seed, got[0], got[1])
+		}
+	}
+}
@@ -0,0 +1,551 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Raster is a single band grid of cell values with its georeference.
+// Values are stored row by row, starting with the northern most row.
+type Raster struct {
+	Cols      int
+	Rows      int
+	XLLCorner float64 // x coordinate of the lower left corner
+	YLLCorner float64 // y coordinate of the lower left corner
+	CellSize  float64
+	NoData    float64
+	HasNoData bool
+	Values    []float64
+}
+
+// Value of the cell at col/row
+func (r *Raster) Value(col, row int) float64 {
+	return r.Values[row*r.Cols+col]
+}
+
+// IsNoData reports whether the cell at col/row is marked as no-data
+func (r *Raster) IsNoData(col, row int) bool {
+	v := r.Value(col, row)
+	if math.IsNaN(v) {
+		return true
+	}
+	return r.HasNoData && v == r.NoData
+}
+
+// Coords returns the georeferenced coordinates of the center of a cell
+func (r *Raster) Coords(col, row int) (x, y float64) {
+	x = r.XLLCorner + (float64(col)+0.5)*r.CellSize
+	y = r.YLLCorner + (float64(r.Rows-row)-0.5)*r.CellSize
+	return x, y
+}
+
+// LoadRaster reads an ESRI ASCII Grid (.asc) or a GeoTIFF (.tif, .tiff)
+// depending on the file extension
+func LoadRaster(path string) (*Raster, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".asc":
+		return ReadASCIIGrid(f)
+	case ".tif", ".tiff":
+		return ReadGeoTIFF(f)
+	}
+	return nil, fmt.Errorf("unknown raster format: %s", path)
+}
+
+// ReadASCIIGrid reads a raster in the ESRI ASCII Grid format
+func ReadASCIIGrid(in io.Reader) (*Raster, error) {
+	r := &Raster{}
+	s := bufio.NewScanner(in)
+	s.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	s.Split(bufio.ScanWords)
+
+	next := func() (string, bool) {
+		if !s.Scan() {
+			return "", false
+		}
+		return s.Text(), true
+	}
+
+	// the header is a list of key value pairs, followed by the values
+	var first string
+	center := false
+	for {
+		key, ok := next()
+		if !ok {
+			return nil, errors.New("asc: unexpected end of header")
+		}
+		if _, err := strconv.ParseFloat(key, 64); err == nil {
+			first = key
+			break
+		}
+		val, ok := next()
+		if !ok {
+			return nil, errors.New("asc: missing value for " + key)
+		}
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("asc: invalid value for %s: %v", key, err)
+		}
+		switch strings.ToLower(key) {
+		case "ncols":
+			r.Cols = int(f)
+		case "nrows":
+			r.Rows = int(f)
+		case "xllcorner":
+			r.XLLCorner = f
+		case "yllcorner":
+			r.YLLCorner = f
+		case "xllcenter":
+			r.XLLCorner = f
+			center = true
+		case "yllcenter":
+			r.YLLCorner = f
+			center = true
+		case "cellsize":
+			r.CellSize = f
+		case "nodata_value":
+			r.NoData = f
+			r.HasNoData = true
+		default:
+			return nil, errors.New("asc: unknown header field " + key)
+		}
+	}
+	if r.Cols <= 0 || r.Rows <= 0 {
+		return nil, errors.New("asc: invalid dimensions")
+	}
+	if center {
+		r.XLLCorner -= r.CellSize / 2
+		r.YLLCorner -= r.CellSize / 2
+	}
+
+	r.Values = make([]float64, 0, r.Cols*r.Rows)
+	for tok := first; ; {
+		v, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("asc: invalid cell value: %v", err)
+		}
+		r.Values = append(r.Values, v)
+		if len(r.Values) == r.Cols*r.Rows {
+			break
+		}
+		var ok bool
+		if tok, ok = next(); !ok {
+			return nil, fmt.Errorf("asc: expected %d values, got %d", r.Cols*r.Rows, len(r.Values))
+		}
+	}
+	return r, s.Err()
+}
+
+// tiff tags used by ReadGeoTIFF
+const (
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffStripOffsets    = 273
+	tiffSamplesPerPixel = 277
+	tiffStripByteCounts = 279
+	tiffSampleFormat    = 339
+	tiffModelPixelScale = 33550
+	tiffModelTiepoint   = 33922
+	tiffGDALNoData      = 42113
+)
+
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// ReadGeoTIFF reads a simple GeoTIFF: one uncompressed band stored in
+// strips, with integer or floating point samples. The georeference is
+// taken from the model tiepoint and pixel scale, no-data from the GDAL
+// no-data tag.
+func ReadGeoTIFF(in io.Reader) (*Raster, error) {
+	buf, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < 8 {
+		return nil, errors.New("tiff: file too short")
+	}
+
+	var bo binary.ByteOrder
+	switch string(buf[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return nil, errors.New("tiff: invalid byte order")
+	}
+	if bo.Uint16(buf[2:]) != 42 {
+		return nil, errors.New("tiff: not a tiff file (BigTIFF is not supported)")
+	}
+
+	// read the first image file directory
+	ifd := int(bo.Uint32(buf[4:]))
+	if ifd+2 > len(buf) {
+		return nil, errors.New("tiff: invalid directory offset")
+	}
+	typeSize := map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 6: 1, 7: 1, 8: 2, 9: 4, 11: 4, 12: 8}
+	entries := make(map[uint16]tiffEntry)
+	n := int(bo.Uint16(buf[ifd:]))
+	for i := 0; i < n; i++ {
+		e := ifd + 2 + i*12
+		if e+12 > len(buf) {
+			return nil, errors.New("tiff: truncated directory")
+		}
+		tag := bo.Uint16(buf[e:])
+		typ := bo.Uint16(buf[e+2:])
+		count := bo.Uint32(buf[e+4:])
+		size, ok := typeSize[typ]
+		if !ok {
+			continue
+		}
+		length := size * int(count)
+		var data []byte
+		if length <= 4 {
+			data = buf[e+8 : e+8+length]
+		} else {
+			off := int(bo.Uint32(buf[e+8:]))
+			if off+length > len(buf) {
+				return nil, fmt.Errorf("tiff: tag %d out of bounds", tag)
+			}
+			data = buf[off : off+length]
+		}
+		entries[tag] = tiffEntry{typ, count, data}
+	}
+
+	// numeric values of a tag
+	values := func(tag uint16) []float64 {
+		e, ok := entries[tag]
+		if !ok {
+			return nil
+		}
+		v := make([]float64, e.count)
+		for i := range v {
+			switch e.typ {
+			case 1, 7:
+				v[i] = float64(e.data[i])
+			case 6:
+				v[i] = float64(int8(e.data[i]))
+			case 3:
+				v[i] = float64(bo.Uint16(e.data[i*2:]))
+			case 8:
+				v[i] = float64(int16(bo.Uint16(e.data[i*2:])))
+			case 4:
+				v[i] = float64(bo.Uint32(e.data[i*4:]))
+			case 9:
+				v[i] = float64(int32(bo.Uint32(e.data[i*4:])))
+			case 11:
+				v[i] = float64(math.Float32frombits(bo.Uint32(e.data[i*4:])))
+			case 12:
+				v[i] = math.Float64frombits(bo.Uint64(e.data[i*8:]))
+			}
+		}
+		return v
+	}
+	single := func(tag uint16, def float64) float64 {
+		if v := values(tag); len(v) > 0 {
+			return v[0]
+		}
+		return def
+	}
+
+	r := &Raster{
+		Cols: int(single(tiffImageWidth, 0)),
+		Rows: int(single(tiffImageLength, 0)),
+	}
+	if r.Cols <= 0 || r.Rows <= 0 {
+		return nil, errors.New("tiff: invalid dimensions")
+	}
+	if single(tiffCompression, 1) != 1 {
+		return nil, errors.New("tiff: compressed images are not supported")
+	}
+	if single(tiffSamplesPerPixel, 1) != 1 {
+		return nil, errors.New("tiff: only single band images are supported")
+	}
+	bits := int(single(tiffBitsPerSample, 1))
+	format := int(single(tiffSampleFormat, 1))
+	offsets := values(tiffStripOffsets)
+	counts := values(tiffStripByteCounts)
+	if offsets == nil || len(offsets) != len(counts) {
+		return nil, errors.New("tiff: only stripped images are supported")
+	}
+
+	// georeference, pixel (i,j) is at model coordinates (x,y)
+	scale := values(tiffModelPixelScale)
+	tie := values(tiffModelTiepoint)
+	if len(scale) >= 2 && len(tie) >= 6 {
+		r.CellSize = scale[0]
+		if scale[1] != scale[0] {
+			return nil, errors.New("tiff: non square cells are not supported")
+		}
+		r.XLLCorner = tie[3] - tie[0]*scale[0]
+		r.YLLCorner = tie[4] + tie[1]*scale[1] - float64(r.Rows)*scale[1]
+	} else {
+		r.CellSize = 1
+	}
+	if e, ok := entries[tiffGDALNoData]; ok {
+		nd, err := strconv.ParseFloat(strings.Trim(string(e.data), "\x00 "), 64)
+		if err == nil {
+			r.NoData = nd
+			r.HasNoData = true
+		}
+	}
+
+	var pixels []byte
+	for i := range offsets {
+		off, cnt := int(offsets[i]), int(counts[i])
+		if off+cnt > len(buf) {
+			return nil, errors.New("tiff: strip out of bounds")
+		}
+		pixels = append(pixels, buf[off:off+cnt]...)
+	}
+	size := bits / 8
+	if size == 0 || len(pixels) < r.Cols*r.Rows*size {
+		return nil, errors.New("tiff: not enough pixel data")
+	}
+
+	r.Values = make([]float64, r.Cols*r.Rows)
+	for i := range r.Values {
+		p := pixels[i*size:]
+		switch {
+		case format == 3 && bits == 32:
+			r.Values[i] = float64(math.Float32frombits(bo.Uint32(p)))
+		case format == 3 && bits == 64:
+			r.Values[i] = math.Float64frombits(bo.Uint64(p))
+		case format == 2 && bits == 8:
+			r.Values[i] = float64(int8(p[0]))
+		case format == 2 && bits == 16:
+			r.Values[i] = float64(int16(bo.Uint16(p)))
+		case format == 2 && bits == 32:
+			r.Values[i] = float64(int32(bo.Uint32(p)))
+		case format == 1 && bits == 8:
+			r.Values[i] = float64(p[0])
+		case format == 1 && bits == 16:
+			r.Values[i] = float64(bo.Uint16(p))
+		case format == 1 && bits == 32:
+			r.Values[i] = float64(bo.Uint32(p))
+		default:
+			return nil, fmt.Errorf("tiff: unsupported sample format %d with %d bits", format, bits)
+		}
+	}
+	return r, nil
+}
+
+// 2d grid landscape initialised from a raster, every cell holding data
+// is a patch with one agent, no-data cells stay empty.
+// Additional rasters of the same shape can be loaded as named attributes.
+type RasterLandscape struct {
+	Agents     []RasterAgent     // library agent object, implements neighbor selection etc.
+	UserAgents []Agenter         // agents from the user
+	File       string            // raster file (.asc or .tif) defining the grid
+	Layers     map[string]string // additional attribute rasters by name
+	Raster     *Raster           // the grid, loaded from File if nil
+	cells      []int             // cell -> agent index, -1 for no-data
+	rand       *rand.Rand
+}
+
+type RasterAgent struct {
+	*GenericAgent
+	Col        int                `json:"col"`
+	Row        int                `json:"row"`
+	X          float64            `json:"x"` // georeferenced coordinates of the cell center
+	Y          float64            `json:"y"`
+	Value      float64            `json:"value"` // cell value of the raster
+	Attributes map[string]float64 `json:"attributes,omitempty"`
+	ls         *RasterLandscape
+}
+
+// Position returns the georeferenced coordinates of the cell center
+func (a *RasterAgent) Position() []float64 {
+	return []float64{a.X, a.Y}
+}
+
+// Attribute returns the value of the cell in the named layer
+func (a *RasterAgent) Attribute(name string) float64 {
+	return a.Attributes[name]
+}
+
+// returns the agent index at col/row, -1 if there is none
+func (l *RasterLandscape) cellAgent(col, row int) int {
+	if col < 0 || row < 0 || col >= l.Raster.Cols || row >= l.Raster.Rows {
+		return -1
+	}
+	return l.cells[row*l.Raster.Cols+col]
+}
+
+// neighbors in the von Neumann neighborhood, the landscape does not wrap
+func (l *RasterLandscape) neighbors(a *RasterAgent) []int {
+	var n []int
+	for _, d := range [4][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+		if i := l.cellAgent(a.Col+d[0], a.Row+d[1]); i >= 0 {
+			n = append(n, i)
+		}
+	}
+	return n
+}
+
+func (l *RasterLandscape) Dump() NetworkDump {
+	// dump as a network, the nodes carry the georeferenced coordinates
+	nodes := l.UserAgents
+	var links []Link
+
+	for i := range l.Agents {
+		for _, n := range l.neighbors(&l.Agents[i]) {
+			links = append(links, Link{Source: l.Agents[i].ID(), Target: l.Agents[n].ID()})
+		}
+	}
+
+	return NetworkDump{Nodes: nodes, Links: links}
+}
+
+func (l *RasterLandscape) GetAgents() *[]Agenter {
+
+	return &l.UserAgents
+}
+
+// GetAgentById returns the agent in constant time, the population of the
+// raster is fixed so an id is the position of the agent in UserAgents
+func (l *RasterLandscape) GetAgentById(id AgentID) Agenter {
+	if id < 0 || int(id) >= len(l.UserAgents) {
+		return nil
+	}
+	return l.UserAgents[id]
+}
+
+// SetRand sets the random number generator used for agent selection
+func (l *RasterLandscape) SetRand(r *rand.Rand) {
+	l.rand = r
+}
+
+func (l *RasterLandscape) RandomAgent() Agenter {
+	return randomAgent(l.rand, l.UserAgents)
+}
+
+// RandomAgents returns k distinct random agents
+func (l *RasterLandscape) RandomAgents(k int) []Agenter {
+	return randomAgents(l.rand, l.UserAgents, k)
+}
+
+// RandomAgentWhere returns a random agent for which match is true, nil if there is none
+func (l *RasterLandscape) RandomAgentWhere(match func(Agenter) bool) Agenter {
+	return randomAgentWhere(l.rand, l.UserAgents, match)
+}
+
+// GetAgent returns the agent on the cell at col/row, nil for no-data cells
+func (l *RasterLandscape) GetAgent(col, row int) Agenter {
+	if i := l.cellAgent(col, row); i >= 0 {
+		return l.UserAgents[i]
+	}
+	return nil
+}
+
+// Neighbors returns the ids of the agents on the adjacent cells with data
+func (l *RasterLandscape) Neighbors(id AgentID) []AgentID {
+	if id < 0 || int(id) >= len(l.Agents) {
+		return nil
+	}
+	var neighbors []AgentID
+	for _, n := range l.neighbors(&l.Agents[id]) {
+		neighbors = append(neighbors, l.Agents[n].ID())
+	}
+	return neighbors
+}
+
+func (a *RasterAgent) GetRandomNeighbor() (AgentID, error) {
+	return a.GetRandomLink()
+}
+
+func (l *RasterLandscape) Init(model Modeler) {
+	if l.rand == nil {
+		l.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	if l.Raster == nil {
+		r, err := LoadRaster(l.File)
+		if err != nil {
+			panic(err)
+		}
+		l.Raster = r
+	}
+	layers := make(map[string]*Raster)
+	for name, path := range l.Layers {
+		r, err := LoadRaster(path)
+		if err != nil {
+			panic(err)
+		}
+		if r.Cols != l.Raster.Cols || r.Rows != l.Raster.Rows {
+			panic("raster layer " + name + " does not match the landscape")
+		}
+		layers[name] = r
+	}
+
+	// only cells with data become patches
+	l.cells = make([]int, l.Raster.Cols*l.Raster.Rows)
+	numAgents := 0
+	for row := 0; row < l.Raster.Rows; row++ {
+		for col := 0; col < l.Raster.Cols; col++ {
+			if l.Raster.IsNoData(col, row) {
+				l.cells[row*l.Raster.Cols+col] = -1
+			} else {
+				l.cells[row*l.Raster.Cols+col] = numAgents
+				numAgents++
+			}
+		}
+	}
+	l.Agents = make([]RasterAgent, numAgents)
+	l.UserAgents = make([]Agenter, numAgents)
+	for cell, i := range l.cells {
+		if i < 0 {
+			continue
+		}
+		a := &l.Agents[i]
+		a.GenericAgent = &GenericAgent{}
+		a.SetID(AgentID(i))
+		a.Col = cell % l.Raster.Cols
+		a.Row = cell / l.Raster.Cols
+		a.X, a.Y = l.Raster.Coords(a.Col, a.Row)
+		a.Value = l.Raster.Values[cell]
+		if len(layers) > 0 {
+			a.Attributes = make(map[string]float64, len(layers))
+			for name, r := range layers {
+				a.Attributes[name] = r.Values[cell]
+			}
+		}
+		a.ls = l
+
+		l.UserAgents[i] = model.CreateAgent(a)
+	}
+
+	// connect network
+	for i := range l.Agents {
+		a := &l.Agents[i]
+		for _, n := range [2]int{l.cellAgent(a.Col+1, a.Row), l.cellAgent(a.Col, a.Row+1)} {
+			if n >= 0 {
+				a.ConnectTo(l.Agents[n].GenericAgent)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestLoadRaster(t *testing.T) {
+	// testdata/small.asc and testdata/small.tif hold the same grid:
+	//   1   2   no-data
+	//   4.5 5   6
+	for _, path := range []string{"testdata/small.asc", "testdata/small.tif"} {
+		r, err := LoadRaster(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if r.Cols != 3 || r.Rows != 2 {
+			t.Fatalf("%s: got %dx%d cells, want 3x2", path, r.Cols, r.Rows)
+		}
+		if r.XLLCorner != 100 || r.YLLCorner != 200 || r.CellSize != 10 {
+			t.Errorf("%s: got corner %v/%v and cell size %v, want 100/200 and 10", path, r.XLLCorner, r.YLLCorner, r.CellSize)
+		}
+		want := []float64{1, 2, -9999, 4.5, 5, 6}
+		for i, v := range want {
+			if r.Values[i] != v {
+				t.Errorf("%s: value %d is %v, want %v", path, i, r.Values[i], v)
+			}
+		}
+		if !r.IsNoData(2, 0) || r.IsNoData(0, 0) {
+			t.Errorf("%s: no-data is not detected", path)
+		}
+		if x, y := r.Coords(0, 0); x != 105 || y != 215 {
+			t.Errorf("%s: cell 0/0 is at %v/%v, want 105/215", path, x, y)
+		}
+	}
+}
+
+func TestReadGeoTIFFSigned(t *testing.T) {
+	// big endian, 16 bit signed samples, the dimensions and strips are
+	// stored with the signed types SSHORT, SLONG and SBYTE
+	r, err := LoadRaster("testdata/signed.tif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Cols != 3 || r.Rows != 2 {
+		t.Fatalf("got %dx%d cells, want 3x2", r.Cols, r.Rows)
+	}
+	want := []float64{-3, -2, -1, 0, 1, 300}
+	for i, v := range want {
+		if r.Values[i] != v {
+			t.Errorf("value %d is %v, want %v", i, r.Values[i], v)
+		}
+	}
+}
+
+func TestReadRasterErrors(t *testing.T) {
+	tif, err := ioutil.ReadFile("testdata/small.tif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		read func() (*Raster, error)
+	}{
+		{"asc missing values", func() (*Raster, error) {
+			return ReadASCIIGrid(bytes.NewBufferString("ncols 2\nnrows 2\ncellsize 1\n1 2 3\n"))
+		}},
+		{"asc unknown field", func() (*Raster, error) {
+			return ReadASCIIGrid(bytes.NewBufferString("ncols 1\nnrows 1\ncolor 3\n1\n"))
+		}},
+		{"asc invalid value", func() (*Raster, error) {
+			return ReadASCIIGrid(bytes.NewBufferString("ncols 2\nnrows 1\n1 x\n"))
+		}},
+		{"tiff byte order", func() (*Raster, error) {
+			return ReadGeoTIFF(bytes.NewBufferString("XX*\x00\x08\x00\x00\x00"))
+		}},
+		{"tiff truncated", func() (*Raster, error) {
+			return ReadGeoTIFF(bytes.NewReader(tif[:40]))
+		}},
+		{"tiff missing pixels", func() (*Raster, error) {
+			return ReadGeoTIFF(bytes.NewReader(tif[:len(tif)-4]))
+		}},
+	}
+	for _, tt := range tests {
+		if _, err := tt.read(); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
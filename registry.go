@@ -0,0 +1,139 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ModelInfo describes a registered model: how to create it, the landscape
+// it runs on by default and parameter values which differ from the
+// defaults of its tags
+type ModelInfo struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	New         func() Modeler  `json:"-"`
+	Landscape   LandscapeConfig `json:"landscape"` // DefaultConfig's landscape if the type is empty
+	Params      ParamSet        `json:"defaults,omitempty"`
+}
+
+// the registered models by name
+var registry = struct {
+	sync.Mutex
+	models map[string]*ModelInfo
+}{models: make(map[string]*ModelInfo)}
+
+// RegisterModel makes a model available by name, e.g. to the goabm
+// command or a Config. It is called in the init function of the model
+// package, registering a name twice or a model whose parameters can not
+// be read panics.
+func RegisterModel(info ModelInfo) {
+	if info.Name == "" || info.New == nil {
+		panic("goabm: a model needs a name and a constructor")
+	}
+	if info.Landscape.Type == "" {
+		info.Landscape = DefaultConfig().Landscape
+	}
+	// check the schema and the parameters now instead of at the first run
+	if _, err := info.NewModel(); err != nil {
+		panic(fmt.Sprintf("goabm: model %s: %v", info.Name, err))
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.models[info.Name]; ok {
+		panic("goabm: model " + info.Name + " registered twice")
+	}
+	registry.models[info.Name] = &info
+}
+
+// Register registers a model with the default landscape, see RegisterModel
+func Register(name string, newModel func() Modeler) {
+	RegisterModel(ModelInfo{Name: name, New: newModel})
+}
+
+// LookupModel returns a registered model
+func LookupModel(name string) (*ModelInfo, error) {
+	registry.Lock()
+	defer registry.Unlock()
+	info, ok := registry.models[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown model %q", name)
+	}
+	return info, nil
+}
+
+// NewModel creates a new instance of a registered model with its default
+// parameters
+func NewModel(name string) (Modeler, error) {
+	info, err := LookupModel(name)
+	if err != nil {
+		return nil, err
+	}
+	return info.NewModel()
+}
+
+// Models returns the names of the registered models
+func Models() []string {
+	registry.Lock()
+	defer registry.Unlock()
+	names := make([]string, 0, len(registry.models))
+	for name := range registry.models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewModel creates a new instance of the model with the parameters at
+// their defaults
+func (info *ModelInfo) NewModel() (Modeler, error) {
+	p, err := info.Schema()
+	if err != nil {
+		return nil, err
+	}
+	m := info.New()
+	if p != nil {
+		p.SetDefaults(m)
+	}
+	return m, nil
+}
+
+// Schema returns the parameters of the model with the defaults of Params,
+// nil if it has none. It can be marshalled to JSON, e.g. for a web UI.
+func (info *ModelInfo) Schema() (*Params, error) {
+	p, err := NewParams(info.New())
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Specs) == 0 {
+		if len(info.Params) > 0 {
+			return nil, fmt.Errorf("the model has no parameters")
+		}
+		return nil, nil
+	}
+	// the defaults of the model override the ones of the tags
+	for name, v := range info.Params {
+		s := p.Spec(name)
+		if s == nil {
+			return nil, fmt.Errorf("unknown parameter %s", name)
+		}
+		x, err := s.Convert(v)
+		if err != nil {
+			return nil, err
+		}
+		s.Default = x
+	}
+	return p, nil
+}
+
+// Config returns the default configuration of the model
+func (info *ModelInfo) Config() *Config {
+	c := DefaultConfig()
+	c.Model = info.Name
+	c.Landscape = info.Landscape
+	return c
+}
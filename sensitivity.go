@@ -0,0 +1,310 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// NewMorrisDesign builds the trajectories of the Morris method: every
+// trajectory starts at a random point of a grid with the given number of
+// levels (4 if 0) and changes one parameter after the other by the same
+// step. The points of a trajectory share their seed.
+func NewMorrisDesign(dims []Dimension, trajectories, levels int, seed int64) (*Design, error) {
+	if levels <= 0 {
+		levels = 4
+	}
+	if levels < 2 || levels%2 != 0 {
+		return nil, fmt.Errorf("morris: the number of levels has to be even")
+	}
+	r := rand.New(rand.NewSource(seed))
+	k := len(dims)
+	grid := float64(levels - 1)
+	delta := float64(levels) / (2 * grid)
+
+	unit := make([][]float64, 0, trajectories*(k+1))
+	for t := 0; t < trajectories; t++ {
+		x := make([]float64, k)
+		dir := make([]float64, k)
+		for i := range x {
+			// the lower half of the levels, so x+delta is on the grid
+			x[i] = float64(r.Intn(levels/2)) / grid
+			dir[i] = 1
+			if r.Intn(2) == 0 {
+				x[i] += delta
+				dir[i] = -1
+			}
+		}
+		unit = append(unit, append([]float64(nil), x...))
+		for _, i := range r.Perm(k) {
+			x[i] += dir[i] * delta
+			unit = append(unit, append([]float64(nil), x...))
+		}
+	}
+	return newDesign("morris", dims, unit, seed, k+1), nil
+}
+
+// NewSaltelliDesign builds the samples needed for the Sobol indices: the
+// sampler draws n points of twice the dimensions which are split into the
+// matrices A and B. For every row the design holds A, B and for every
+// parameter i the row of A with the value of i taken from B, so a design
+// has n*(k+2) samples. The samples of a row share their seed.
+func NewSaltelliDesign(s Sampler, dims []Dimension, n int, seed int64) (*Design, error) {
+	k := len(dims)
+	ab, err := s.Sample(n, 2*k, rand.New(rand.NewSource(seed)))
+	if err != nil {
+		return nil, err
+	}
+	unit := make([][]float64, 0, n*(k+2))
+	for _, p := range ab {
+		a, b := p[:k], p[k:]
+		unit = append(unit, append([]float64(nil), a...), append([]float64(nil), b...))
+		for i := 0; i < k; i++ {
+			x := append([]float64(nil), a...)
+			x[i] = b[i]
+			unit = append(unit, x)
+		}
+	}
+	return newDesign("saltelli-"+s.Name(), dims, unit, seed, k+2), nil
+}
+
+// Interval is a confidence interval
+type Interval struct {
+	Low, High float64
+}
+
+// Bootstrap configures the confidence intervals of the sensitivity
+// indices, which are computed from Resamples (1000 if 0) resamples of the
+// trajectories or rows, at the given Level (0.95 if 0)
+type Bootstrap struct {
+	Resamples int
+	Level     float64
+	Seed      int64
+}
+
+// interval returns the percentile interval of the statistic computed on
+// resamples of n units
+func (b Bootstrap) interval(n int, statistic func(units []int) []float64) []Interval {
+	resamples := b.Resamples
+	if resamples <= 0 {
+		resamples = 1000
+	}
+	level := b.Level
+	if level <= 0 || level >= 1 {
+		level = 0.95
+	}
+	r := rand.New(rand.NewSource(b.Seed))
+
+	var estimates [][]float64
+	units := make([]int, n)
+	for s := 0; s < resamples; s++ {
+		for i := range units {
+			units[i] = r.Intn(n)
+		}
+		for i, v := range statistic(units) {
+			if s == 0 {
+				estimates = append(estimates, make([]float64, 0, resamples))
+			}
+			if !math.IsNaN(v) {
+				estimates[i] = append(estimates[i], v)
+			}
+		}
+	}
+
+	res := make([]Interval, len(estimates))
+	for i, e := range estimates {
+		if len(e) == 0 {
+			res[i] = Interval{math.NaN(), math.NaN()}
+			continue
+		}
+		sort.Float64s(e)
+		lo := int(math.Floor((1 - level) / 2 * float64(len(e)-1)))
+		hi := int(math.Ceil((1 + level) / 2 * float64(len(e)-1)))
+		res[i] = Interval{e[lo], e[hi]}
+	}
+	return res
+}
+
+// designOutputs returns the value of the reporter for every sample of the
+// design, averaged over the replicates
+func designOutputs(d *Design, results []BatchResult, reporter string) ([]float64, error) {
+	sum := make([]float64, len(d.Samples))
+	n := make([]int, len(d.Samples))
+	for _, r := range results {
+		if r.Err != nil {
+			return nil, fmt.Errorf("run %d failed: %v", r.Run, r.Err)
+		}
+		if r.Combination >= len(sum) {
+			return nil, fmt.Errorf("run %d is not part of the design", r.Run)
+		}
+		var v float64
+		var ok bool
+		switch reporter {
+		case "Steps":
+			v, ok = float64(r.Stats.Steps), true
+		case "Events":
+			v, ok = float64(r.Stats.Events), true
+		default:
+			v, ok = toFloat64(r.Values[reporter])
+		}
+		if !ok {
+			return nil, fmt.Errorf("run %d has no numeric value %s", r.Run, reporter)
+		}
+		sum[r.Combination] += v
+		n[r.Combination]++
+	}
+	for i := range sum {
+		if n[i] == 0 {
+			return nil, fmt.Errorf("sample %d of the design has no runs", i)
+		}
+		sum[i] /= float64(n[i])
+	}
+	return sum, nil
+}
+
+// MorrisIndex are the statistics of the elementary effects of a parameter,
+// measured in changes of the output per unit of the normalised parameter
+type MorrisIndex struct {
+	Name       string
+	Mu         float64 // mean effect
+	MuStar     float64 // mean absolute effect, the overall influence
+	Sigma      float64 // standard deviation, non-linearity and interactions
+	MuStarConf Interval
+}
+
+// Morris computes the elementary effects of a Morris design on the final
+// value of reporter (a model field, a reporter of the Collector, Steps or
+// Events) from the results of the batch run of the design
+func Morris(d *Design, results []BatchResult, reporter string, b Bootstrap) ([]MorrisIndex, error) {
+	if d.Sampler != "morris" {
+		return nil, fmt.Errorf("morris: not a morris design: %s", d.Sampler)
+	}
+	y, err := designOutputs(d, results, reporter)
+	if err != nil {
+		return nil, err
+	}
+	k := len(d.Dimensions)
+	trajectories := len(d.Unit) / (k + 1)
+
+	// effects[t][i] is the effect of parameter i in trajectory t
+	effects := make([][]float64, trajectories)
+	for t := range effects {
+		effects[t] = make([]float64, k)
+		for s := 0; s < k; s++ {
+			p := t*(k+1) + s
+			for i := 0; i < k; i++ {
+				if delta := d.Unit[p+1][i] - d.Unit[p][i]; delta != 0 {
+					effects[t][i] = (y[p+1] - y[p]) / delta
+				}
+			}
+		}
+	}
+
+	muStar := func(units []int) []float64 {
+		res := make([]float64, k)
+		for _, t := range units {
+			for i, e := range effects[t] {
+				res[i] += math.Abs(e) / float64(len(units))
+			}
+		}
+		return res
+	}
+	all := make([]int, trajectories)
+	for t := range all {
+		all[t] = t
+	}
+	conf := b.interval(trajectories, muStar)
+
+	res := make([]MorrisIndex, k)
+	for i, dim := range d.Dimensions {
+		m := MorrisIndex{Name: dim.Name, MuStarConf: conf[i]}
+		for _, e := range effects {
+			m.Mu += e[i] / float64(trajectories)
+		}
+		m.MuStar = muStar(all)[i]
+		if trajectories > 1 {
+			for _, e := range effects {
+				m.Sigma += (e[i] - m.Mu) * (e[i] - m.Mu)
+			}
+			m.Sigma = math.Sqrt(m.Sigma / float64(trajectories-1))
+		}
+		res[i] = m
+	}
+	return res, nil
+}
+
+// SobolIndex are the variance based sensitivity indices of a parameter
+type SobolIndex struct {
+	Name   string
+	S1     float64 // first order: share of the variance caused by the parameter alone
+	ST     float64 // total: share including all interactions
+	S1Conf Interval
+	STConf Interval
+}
+
+// SobolIndices computes the first order and total Sobol indices of a
+// Saltelli design on the final value of reporter from the results of the
+// batch run of the design, with the estimators of Saltelli (2010) and
+// Jansen (1999)
+func SobolIndices(d *Design, results []BatchResult, reporter string, b Bootstrap) ([]SobolIndex, error) {
+	if !strings.HasPrefix(d.Sampler, "saltelli") {
+		return nil, fmt.Errorf("sobol: not a saltelli design: %s", d.Sampler)
+	}
+	y, err := designOutputs(d, results, reporter)
+	if err != nil {
+		return nil, err
+	}
+	k := len(d.Dimensions)
+	n := len(y) / (k + 2)
+
+	// indices returns S1 of all parameters followed by ST
+	indices := func(rows []int) []float64 {
+		var mean, variance float64
+		for _, j := range rows {
+			mean += y[j*(k+2)] + y[j*(k+2)+1]
+		}
+		mean /= float64(2 * len(rows))
+		for _, j := range rows {
+			a, b := y[j*(k+2)]-mean, y[j*(k+2)+1]-mean
+			variance += a*a + b*b
+		}
+		variance /= float64(2*len(rows) - 1)
+
+		res := make([]float64, 2*k)
+		for i := 0; i < k; i++ {
+			var first, total float64
+			for _, j := range rows {
+				fa, fb, fab := y[j*(k+2)], y[j*(k+2)+1], y[j*(k+2)+2+i]
+				first += fb * (fab - fa)
+				total += (fa - fab) * (fa - fab)
+			}
+			res[i] = first / float64(len(rows)) / variance
+			res[k+i] = total / float64(2*len(rows)) / variance
+		}
+		return res
+	}
+	all := make([]int, n)
+	for j := range all {
+		all[j] = j
+	}
+	est := indices(all)
+	conf := b.interval(n, indices)
+
+	res := make([]SobolIndex, k)
+	for i, dim := range d.Dimensions {
+		res[i] = SobolIndex{
+			Name:   dim.Name,
+			S1:     est[i],
+			ST:     est[k+i],
+			S1Conf: conf[i],
+			STConf: conf[k+i],
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,133 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"math"
+	"testing"
+)
+
+// evaluate returns the results of a batch run of the design on f
+func evaluate(d *Design, f func(p ParamSet) float64) []BatchResult {
+	results := make([]BatchResult, len(d.Samples))
+	for i, p := range d.Samples {
+		results[i] = BatchResult{Run: i, Combination: i, Values: map[string]interface{}{"y": f(p)}}
+	}
+	return results
+}
+
+// ishigami is the Ishigami function with a=7 and b=0.1 on [-pi,pi]^3
+func ishigami(p ParamSet) float64 {
+	x1, x2, x3 := p["x1"].(float64), p["x2"].(float64), p["x3"].(float64)
+	return math.Sin(x1) + 7*math.Pow(math.Sin(x2), 2) + 0.1*math.Pow(x3, 4)*math.Sin(x1)
+}
+
+// gFunction is the Sobol g-function on [0,1]^4, the smaller a the more
+// important the parameter
+func gFunction(p ParamSet) float64 {
+	y := 1.0
+	for i, a := range []float64{0, 1, 9, 99} {
+		x := p[string(rune('a'+i))].(float64)
+		y *= (math.Abs(4*x-2) + a) / (1 + a)
+	}
+	return y
+}
+
+func TestSobolIndicesIshigami(t *testing.T) {
+	dims := []Dimension{
+		{Name: "x1", Min: -math.Pi, Max: math.Pi},
+		{Name: "x2", Min: -math.Pi, Max: math.Pi},
+		{Name: "x3", Min: -math.Pi, Max: math.Pi},
+	}
+	d, err := NewSaltelliDesign(Sobol{}, dims, 4096, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Samples) != 4096*5 {
+		t.Fatalf("%d samples, want %d", len(d.Samples), 4096*5)
+	}
+	indices, err := SobolIndices(d, evaluate(d, ishigami), "y", Bootstrap{Resamples: 100, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the analytical values
+	want := []struct{ s1, st float64 }{{0.3139, 0.5576}, {0.4424, 0.4424}, {0, 0.2437}}
+	const tolerance = 0.05
+	for i, idx := range indices {
+		if math.Abs(idx.S1-want[i].s1) > tolerance || math.Abs(idx.ST-want[i].st) > tolerance {
+			t.Errorf("%s: got S1 %.3f and ST %.3f, want %.3f and %.3f", idx.Name, idx.S1, idx.ST, want[i].s1, want[i].st)
+		}
+		if idx.S1Conf.Low > idx.S1 || idx.S1Conf.High < idx.S1 || idx.STConf.Low > idx.ST || idx.STConf.High < idx.ST {
+			t.Errorf("%s: the intervals %v and %v do not contain the estimates", idx.Name, idx.S1Conf, idx.STConf)
+		}
+	}
+}
+
+func TestMorrisLinear(t *testing.T) {
+	// the elementary effects of a linear function are its slopes times
+	// the ranges, without any spread
+	dims := []Dimension{{Name: "a", Min: 0, Max: 2}, {Name: "b", Min: -1, Max: 1}, {Name: "c", Min: 0, Max: 10}}
+	linear := func(p ParamSet) float64 {
+		return 3*p["a"].(float64) - p["b"].(float64) + 0*p["c"].(float64)
+	}
+	d, err := NewMorrisDesign(dims, 20, 4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indices, err := Morris(d, evaluate(d, linear), "y", Bootstrap{Resamples: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{6, -2, 0}
+	for i, idx := range indices {
+		if math.Abs(idx.Mu-want[i]) > 1e-9 || math.Abs(idx.MuStar-math.Abs(want[i])) > 1e-9 || idx.Sigma > 1e-9 {
+			t.Errorf("%s: got mu %v, mu* %v and sigma %v, want %v, %v and 0", idx.Name, idx.Mu, idx.MuStar, idx.Sigma, want[i], math.Abs(want[i]))
+		}
+	}
+}
+
+func TestMorrisGFunction(t *testing.T) {
+	var dims []Dimension
+	for _, name := range []string{"a", "b", "c", "d"} {
+		dims = append(dims, Dimension{Name: name, Min: 0, Max: 1})
+	}
+	d, err := NewMorrisDesign(dims, 200, 4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indices, err := Morris(d, evaluate(d, gFunction), "y", Bootstrap{Resamples: 100, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the parameters are ranked by their importance
+	for i := 1; i < len(indices); i++ {
+		if indices[i].MuStar >= indices[i-1].MuStar {
+			t.Errorf("mu* of %s (%.3f) is not below the one of %s (%.3f)", indices[i].Name, indices[i].MuStar, indices[i-1].Name, indices[i-1].MuStar)
+		}
+	}
+	if idx := indices[0]; idx.MuStarConf.Low > idx.MuStar || idx.MuStarConf.High < idx.MuStar {
+		t.Errorf("the interval %v does not contain mu* %v", idx.MuStarConf, idx.MuStar)
+	}
+	// with a=99 the last parameter hardly matters
+	if indices[3].MuStar > 0.1*indices[0].MuStar {
+		t.Errorf("mu* of d is %.3f, a is %.3f", indices[3].MuStar, indices[0].MuStar)
+	}
+}
+
+func TestSensitivityDesignTypes(t *testing.T) {
+	dims := []Dimension{{Name: "a", Min: 0, Max: 1}}
+	f := func(p ParamSet) float64 { return p["a"].(float64) }
+	morris, _ := NewMorrisDesign(dims, 2, 4, 1)
+	saltelli, _ := NewSaltelliDesign(RandomUniform{}, dims, 2, 1)
+	if _, err := SobolIndices(morris, evaluate(morris, f), "y", Bootstrap{}); err == nil {
+		t.Error("sobol indices of a morris design")
+	}
+	if _, err := Morris(saltelli, evaluate(saltelli, f), "y", Bootstrap{}); err == nil {
+		t.Error("morris of a saltelli design")
+	}
+	if _, err := NewMorrisDesign(dims, 2, 3, 1); err == nil {
+		t.Error("odd number of levels")
+	}
+}
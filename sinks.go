@@ -0,0 +1,304 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// formatCell converts a value to the text of a CSV/TSV cell, numbers and
+// strings are written as is, slices, maps and structs as JSON
+func formatCell(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case fmt.Stringer:
+		return x.String()
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'g', -1, 32)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, bool, AgentID:
+		return fmt.Sprint(x)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// CSVSink writes a table as CSV (RFC 4180), or as TSV when Comma is a tab.
+// Every row is flushed so the output can be followed during a run.
+type CSVSink struct {
+	w      *csv.Writer
+	closer io.Closer
+}
+
+// NewCSVSink writes comma separated values to w
+func NewCSVSink(w io.Writer) *CSVSink {
+	return &CSVSink{w: csv.NewWriter(w)}
+}
+
+// NewTSVSink writes tab separated values to w
+func NewTSVSink(w io.Writer) *CSVSink {
+	s := NewCSVSink(w)
+	s.w.Comma = '\t'
+	return s
+}
+
+func (s *CSVSink) WriteHeader(columns []string) error {
+	s.w.Write(columns)
+	s.w.Flush()
+	return s.w.Error()
+}
+
+func (s *CSVSink) WriteRow(row []interface{}) error {
+	record := make([]string, len(row))
+	for i, v := range row {
+		record[i] = formatCell(v)
+	}
+	s.w.Write(record)
+	s.w.Flush()
+	return s.w.Error()
+}
+
+func (s *CSVSink) Close() error {
+	s.w.Flush()
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return s.w.Error()
+}
+
+// JSONLinesSink writes every row as a JSON object on its own line, the
+// keys are the column names in column order. Nested values are kept.
+type JSONLinesSink struct {
+	w       *bufio.Writer
+	columns [][]byte
+	closer  io.Closer
+}
+
+// NewJSONLinesSink writes JSON Lines to w
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: bufio.NewWriter(w)}
+}
+
+func (s *JSONLinesSink) WriteHeader(columns []string) error {
+	s.columns = make([][]byte, len(columns))
+	for i, c := range columns {
+		b, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		s.columns[i] = b
+	}
+	return nil
+}
+
+func (s *JSONLinesSink) WriteRow(row []interface{}) error {
+	s.w.WriteByte('{')
+	for i, v := range row {
+		if i > 0 {
+			s.w.WriteByte(',')
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		s.w.Write(s.columns[i])
+		s.w.WriteByte(':')
+		s.w.Write(b)
+	}
+	s.w.WriteString("}\n")
+	return s.w.Flush()
+}
+
+func (s *JSONLinesSink) Close() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+// NewSink returns a sink writing to w in the given format: "csv", "tsv",
+// "jsonl" or the columnar Arrow IPC format "arrow" (or "feather")
+func NewSink(w io.Writer, format string) (Sink, error) {
+	switch format {
+	case "csv", "":
+		return NewCSVSink(w), nil
+	case "tsv":
+		return NewTSVSink(w), nil
+	case "jsonl", "json":
+		return NewJSONLinesSink(w), nil
+	case "arrow", "feather":
+		return NewColumnarSink(w), nil
+	}
+	return nil, fmt.Errorf("unknown output format: %s", format)
+}
+
+// CreateSink creates the file at path and returns a sink writing to it,
+// the format is taken from the extension (.csv, .tsv, .jsonl, .arrow, .feather)
+func CreateSink(path string) (Sink, error) {
+	format := filepath.Ext(path)
+	if format != "" {
+		format = format[1:]
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewSink(f, format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	switch s := s.(type) {
+	case *CSVSink:
+		s.closer = f
+	case *JSONLinesSink:
+		s.closer = f
+	case *ColumnarSink:
+		s.closer = f
+	}
+	return s, nil
+}
+
+// ReadTable reads a table written by one of the sinks. The format is
+// detected from the content, so logs without an extension can be read:
+// Arrow files by their magic, JSON Lines by the leading brace, TSV by a
+// tab in the header and CSV otherwise. Numbers in CSV and TSV cells are
+// parsed, JSON numbers are float64.
+func ReadTable(path string) (*Table, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte(columnarMagic)):
+		f, err := ParseColumnar(data)
+		if err != nil {
+			return nil, err
+		}
+		return f.Table()
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")):
+		return readJSONLines(data)
+	}
+	r := csv.NewReader(bytes.NewReader(data))
+	if i := bytes.IndexByte(data, '\n'); bytes.IndexByte(data[:i+1], '\t') >= 0 {
+		r.Comma = '\t'
+	}
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	t := &Table{}
+	if len(records) == 0 {
+		return t, nil
+	}
+	t.Columns = records[0]
+	for _, rec := range records[1:] {
+		row := make([]interface{}, len(t.Columns))
+		for i := range row {
+			if i < len(rec) {
+				row[i] = parseCell(rec[i])
+			}
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t, nil
+}
+
+// parseCell is the inverse of formatCell for numbers and bools
+func parseCell(s string) interface{} {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	if b, err := strconv.ParseBool(s); err == nil && (s == "true" || s == "false") {
+		return b
+	}
+	return s
+}
+
+// readJSONLines reads JSON Lines, the columns are the keys of the first
+// line in their order followed by new keys of later lines
+func readJSONLines(data []byte) (*Table, error) {
+	t := &Table{}
+	index := make(map[string]int)
+	d := json.NewDecoder(bytes.NewReader(data))
+	for line := 1; ; line++ {
+		var raw json.RawMessage
+		if err := d.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		keys, err := objectKeys(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		var values map[string]interface{}
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		for _, k := range keys {
+			if _, ok := index[k]; !ok {
+				index[k] = len(t.Columns)
+				t.Columns = append(t.Columns, k)
+			}
+		}
+		row := make([]interface{}, len(t.Columns))
+		for k, v := range values {
+			row[index[k]] = v
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	// earlier rows are shorter if columns were added later
+	for i, row := range t.Rows {
+		if len(row) < len(t.Columns) {
+			t.Rows[i] = append(row, make([]interface{}, len(t.Columns)-len(row))...)
+		}
+	}
+	return t, nil
+}
+
+// objectKeys returns the keys of a JSON object in their order
+func objectKeys(raw []byte) ([]string, error) {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := d.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("not a JSON object")
+	}
+	var keys []string
+	for d.More() {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, tok.(string))
+		var skip json.RawMessage
+		if err := d.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,154 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeSink writes the header and the rows to s and closes it
+func writeSink(t *testing.T, s Sink, columns []string, rows [][]interface{}) {
+	t.Helper()
+	if err := s.WriteHeader(columns); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := s.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCSVSink(t *testing.T) {
+	var buf bytes.Buffer
+	writeSink(t, NewCSVSink(&buf), []string{"Steps", "Name, full", "Values"}, [][]interface{}{
+		{1, `a "b"`, []int{1, 2}},
+		{2, "two\nlines", map[string]int{"x": 1}},
+		{3, nil, 0.5},
+	})
+	want := "Steps,\"Name, full\",Values\n" +
+		"1,\"a \"\"b\"\"\",\"[1,2]\"\n" +
+		"2,\"two\nlines\",\"{\"\"x\"\":1}\"\n" +
+		"3,,0.5\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestTSVSink(t *testing.T) {
+	var buf bytes.Buffer
+	writeSink(t, NewTSVSink(&buf), []string{"Steps", "Name"}, [][]interface{}{
+		{1, "a\tb"},
+		{2, `say "hi"`},
+		{3, "a,b"},
+	})
+	// only cells with a tab, a quote or a newline are quoted
+	want := "Steps\tName\n1\t\"a\tb\"\n2\t\"say \"\"hi\"\"\"\n3\ta,b\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	var buf bytes.Buffer
+	writeSink(t, NewJSONLinesSink(&buf), []string{"Steps", `a"b`, "N"}, [][]interface{}{
+		{1, map[string][]int{"k": {1, 2}}, nil},
+		{2, "x", 0.5},
+	})
+	// the keys are in column order and nested values are kept
+	want := `{"Steps":1,"a\"b":{"k":[1,2]},"N":null}` + "\n" + `{"Steps":2,"a\"b":"x","N":0.5}` + "\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestReadTableRoundTrip(t *testing.T) {
+	columns := []string{"Steps", "Rate", "Name", "Done"}
+	rows := [][]interface{}{
+		{1, 0.5, "plain", true},
+		{2, 1.25, `a,"b"` + "\tc\nd", false},
+		{3, -2.0, "", true},
+	}
+	dir := t.TempDir()
+	// log has no extension, it is CSV
+	for _, name := range []string{"t.csv", "t.tsv", "t.jsonl", "t.arrow", "log"} {
+		path := filepath.Join(dir, name)
+		s, err := CreateSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeSink(t, s, columns, rows)
+
+		tab, err := ReadTable(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(tab.Columns, columns) || tab.Len() != len(rows) {
+			t.Errorf("%s: %d rows with the columns %v", name, tab.Len(), tab.Columns)
+			continue
+		}
+		// the types differ between the formats, their text does not
+		for i, row := range rows {
+			for j, v := range row {
+				if got := formatCell(tab.Rows[i][j]); got != formatCell(v) {
+					t.Errorf("%s: row %d, %s is %q, want %q", name, i, columns[j], got, formatCell(v))
+				}
+			}
+		}
+		if f := tab.Float64s("Rate"); !reflect.DeepEqual(f, []float64{0.5, 1.25, -2}) {
+			t.Errorf("%s: the rates are %v", name, f)
+		}
+	}
+
+	if _, err := CreateSink(filepath.Join(dir, "t.xls")); err == nil {
+		t.Error("a sink for .xls is created")
+	}
+	if _, err := ReadTable(filepath.Join(dir, "missing.csv")); err == nil {
+		t.Error("a missing table is read")
+	}
+}
+
+func TestReadTableCells(t *testing.T) {
+	dir := t.TempDir()
+	// numbers and bools in CSV are parsed, short records are filled with nil
+	path := filepath.Join(dir, "cells.csv")
+	if err := os.WriteFile(path, []byte("a,b,c\n1,2.5,true\nTrue,x\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tab, err := ReadTable(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]interface{}{{int64(1), 2.5, true}, {"True", "x", nil}}
+	if !reflect.DeepEqual(tab.Rows, want) {
+		t.Errorf("got %v, want %v", tab.Rows, want)
+	}
+
+	// keys of later JSON lines are new columns
+	path = filepath.Join(dir, "cells.jsonl")
+	if err := os.WriteFile(path, []byte(`{"b":1,"a":"x"}`+"\n"+`{"a":"y","c":[1]}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if tab, err = ReadTable(path); err != nil {
+		t.Fatal(err)
+	}
+	want = [][]interface{}{{1.0, "x", nil}, {nil, "y", []interface{}{1.0}}}
+	if !reflect.DeepEqual(tab.Columns, []string{"b", "a", "c"}) || !reflect.DeepEqual(tab.Rows, want) {
+		t.Errorf("got %v %v, want [b a c] %v", tab.Columns, tab.Rows, want)
+	}
+	if err := os.WriteFile(path, []byte(`{"a":1}`+"\n"+`[1]`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadTable(path); err == nil {
+		t.Error("a line which is not an object is read")
+	}
+}
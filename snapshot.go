@@ -0,0 +1,68 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"path/filepath"
+	"strconv"
+)
+
+// Positioner is implemented by the library agents of all landscapes
+type Positioner interface {
+	Position() []float64
+}
+
+var positionNames = []string{"X", "Y", "Z"}
+
+// NewAgentSnapshots returns a collector which writes panel data of all
+// agents to sink every interval steps: one row per agent and step with the
+// columns Steps, ID, the position (X, Y and Z on 3d landscapes) and the
+// fields of the agent type tagged with `goabm:"report"`, e.g.
+//
+//	Features Feature `goabm:"report"`
+//
+// agent is a sample of the user's agent type. The rows are not kept in
+// memory.
+func NewAgentSnapshots(agent Agenter, interval int, sink Sink) *DataCollector {
+	c := &DataCollector{Interval: interval, AgentSinks: []Sink{sink}, Stream: true}
+	if p, ok := agent.(Positioner); ok {
+		for i := range p.Position() {
+			i := i
+			name := "P" + strconv.Itoa(i)
+			if i < len(positionNames) {
+				name = positionNames[i]
+			}
+			c.AddAgentReporter(name, func(a Agenter) interface{} {
+				if p, ok := a.(Positioner); ok {
+					return p.Position()[i]
+				}
+				return nil
+			})
+		}
+	}
+	c.AddAgentFields(agent)
+	return c
+}
+
+// createSnapshots sets up the agent snapshots of a run in the run
+// directory as agents.csv (or .tsv/.jsonl/.arrow following the log format)
+func (s *Simulation) createSnapshots() {
+	agents := *s.Landscape.GetAgents()
+	if len(agents) == 0 {
+		return
+	}
+	out := s.output()
+	format := out.Format
+	if format == "" {
+		format = "csv"
+	}
+	path := filepath.Join(s.AbstInterface.RunDir, "agents."+format)
+	sink, err := CreateSink(path)
+	if err != nil {
+		panic(err)
+	}
+	s.AbstInterface.SnapshotPath = path
+	s.Snapshots = NewAgentSnapshots(agents[0], out.Snapshot, sink)
+}
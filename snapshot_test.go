@@ -0,0 +1,131 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// snapModel creates snapAgents, which count their acts, on a 2d grid
+type snapModel struct {
+	testModel
+}
+
+type snapAgent struct {
+	*FLNMAgent
+	V int `goabm:"report"`
+}
+
+func (m *snapModel) CreateAgent(a interface{}) Agenter {
+	return &snapAgent{FLNMAgent: a.(*FLNMAgent)}
+}
+
+func (m *snapModel) LandscapeAction() {}
+
+func (a *snapAgent) Act() {
+	a.V++
+}
+
+type snap3DAgent struct {
+	*FLWM3DAgent
+}
+
+func (a *snap3DAgent) Act() {}
+
+func TestNewAgentSnapshots(t *testing.T) {
+	tests := []struct {
+		agent   Agenter
+		columns []string
+	}{
+		{&collectAgent{}, []string{"Steps", "ID", "V", "Pos.X", "Pos.Y"}},
+		{&snapAgent{FLNMAgent: &FLNMAgent{}}, []string{"Steps", "ID", "X", "Y", "V"}},
+		{&snap3DAgent{&FLWM3DAgent{}}, []string{"Steps", "ID", "X", "Y", "Z"}},
+	}
+	for _, tt := range tests {
+		sink := &recordSink{}
+		c := NewAgentSnapshots(tt.agent, 3, sink)
+		for step := 1; step <= 7; step++ {
+			if err := c.Collect(Statistics{Steps: step}, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !reflect.DeepEqual(sink.header, tt.columns) {
+			t.Errorf("%T: the columns are %v, want %v", tt.agent, sink.header, tt.columns)
+		}
+	}
+
+	// every agent in every third step, not kept in memory
+	sink := &recordSink{}
+	c := NewAgentSnapshots(&collectAgent{}, 3, sink)
+	agents := []Agenter{&collectAgent{id: 1, V: 10}, &collectAgent{id: 2, V: 20}}
+	for step := 1; step <= 7; step++ {
+		if err := c.Collect(Statistics{Steps: step}, nil, agents); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := [][]interface{}{
+		{3, AgentID(1), 10, 0.0, 0.0}, {3, AgentID(2), 20, 0.0, 0.0},
+		{6, AgentID(1), 10, 0.0, 0.0}, {6, AgentID(2), 20, 0.0, 0.0},
+	}
+	if !reflect.DeepEqual(sink.rows, want) || c.AgentTable.Len() != 0 {
+		t.Errorf("the rows are %v with %d in memory, want %v", sink.rows, c.AgentTable.Len(), want)
+	}
+}
+
+func TestSimulationSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	for _, format := range []string{"csv", "jsonl", "arrow"} {
+		s := &Simulation{
+			Landscape: &FixedLandscapeNoMovement{Size: 3},
+			Model:     &snapModel{},
+			Seed:      1,
+			Output:    &OutputConfig{Dir: dir, RunID: format, Format: format, Snapshot: 2},
+		}
+		s.Run(MaxSteps(5))
+
+		path := filepath.Join(dir, "goabm."+format, "agents."+format)
+		if s.AbstInterface.SnapshotPath != path {
+			t.Errorf("%s: the snapshots are in %q, want %q", format, s.AbstInterface.SnapshotPath, path)
+		}
+		tab, err := ReadTable(path)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if want := []string{"Steps", "ID", "X", "Y", "V"}; !reflect.DeepEqual(tab.Columns, want) {
+			t.Errorf("%s: the columns are %v, want %v", format, tab.Columns, want)
+		}
+		// the 9 agents after the steps 2 and 4, every agent acted once a step
+		if tab.Len() != 18 {
+			t.Fatalf("%s: %d rows, want 18", format, tab.Len())
+		}
+		for i := 0; i < tab.Len(); i++ {
+			row := tab.Row(i)
+			steps, _ := toFloat64(row["Steps"])
+			v, _ := toFloat64(row["V"])
+			if want := float64(2 + 2*(i/9)); steps != want || v != steps {
+				t.Errorf("%s: row %d is %v, want the step %v", format, i, row, want)
+			}
+			a := s.Landscape.GetAgentById(AgentID(i % 9)).(*snapAgent)
+			x, _ := toFloat64(row["X"])
+			y, _ := toFloat64(row["Y"])
+			if id, _ := toFloat64(row["ID"]); id != float64(i%9) || x != float64(a.X) || y != float64(a.Y) {
+				t.Errorf("%s: row %d is %v, want agent %d at %d/%d", format, i, row, i%9, a.X, a.Y)
+			}
+		}
+	}
+
+	// no snapshots without an interval
+	s := &Simulation{
+		Landscape: &FixedLandscapeNoMovement{Size: 3},
+		Model:     &snapModel{},
+		Output:    &OutputConfig{Dir: dir, RunID: "none", Format: "csv"},
+	}
+	s.Run(MaxSteps(2))
+	if s.Snapshots != nil || s.AbstInterface.SnapshotPath != "" {
+		t.Errorf("snapshots in %q without an interval", s.AbstInterface.SnapshotPath)
+	}
+}
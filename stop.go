@@ -0,0 +1,285 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// StopCondition ends a run when Done returns true, it is checked before
+// every step. String names the condition in the results.
+type StopCondition interface {
+	Done(s *Simulation) bool
+	String() string
+}
+
+// StatefulCondition is a stop condition which keeps state during a run,
+// Run calls Start at the beginning of every run and uses the returned
+// condition, so the condition can be shared by parallel runs
+type StatefulCondition interface {
+	StopCondition
+	Start() StopCondition
+}
+
+// ProgressCondition is a stop condition which knows how far a run is,
+// Fraction is between 0 and 1 or negative if it is not known
+type ProgressCondition interface {
+	StopCondition
+	Fraction(s *Simulation) float64
+}
+
+type stopFunc struct {
+	name     string
+	done     func(s *Simulation) bool
+	fraction func(s *Simulation) float64
+}
+
+func (c stopFunc) Done(s *Simulation) bool { return c.done(s) }
+func (c stopFunc) String() string          { return c.name }
+
+func (c stopFunc) Fraction(s *Simulation) float64 {
+	if c.fraction == nil {
+		return -1
+	}
+	return c.fraction(s)
+}
+
+// When stops the run when the predicate on the simulation is true, e.g.
+// when all agents share the same culture
+func When(name string, predicate func(s *Simulation) bool) StopCondition {
+	return stopFunc{name: name, done: predicate}
+}
+
+// MaxSteps stops the run after n steps
+func MaxSteps(n int) StopCondition {
+	return stopFunc{fmt.Sprintf("steps=%d", n), func(s *Simulation) bool {
+		return s.Stats.Steps >= n
+	}, func(s *Simulation) float64 {
+		return float64(s.Stats.Steps) / float64(n)
+	}}
+}
+
+// MaxEvents stops the run after n events (agent actions)
+func MaxEvents(n int) StopCondition {
+	return stopFunc{fmt.Sprintf("events=%d", n), func(s *Simulation) bool {
+		return s.Stats.Events >= n
+	}, func(s *Simulation) float64 {
+		return float64(s.Stats.Events) / float64(n)
+	}}
+}
+
+// WallClock stops the run when it took longer than d
+func WallClock(d time.Duration) StopCondition {
+	return stopFunc{fmt.Sprintf("wallclock=%v", d), func(s *Simulation) bool {
+		return time.Since(s.started) >= d
+	}, func(s *Simulation) float64 {
+		return float64(time.Since(s.started)) / float64(d)
+	}}
+}
+
+// StateHasher is implemented by models which summarize their state
+// cheaply, e.g. by a count of their changes. Unchanged compares the hashes
+// instead of the fields of the model.
+type StateHasher interface {
+	StateHash() uint64
+}
+
+// unchanged stops when the state did not change for k steps
+type unchanged struct {
+	k      int
+	fields []string
+	state  func(s *Simulation) []interface{}
+	last   []interface{}
+	since  int // step of the last change
+}
+
+// Unchanged stops the run when the state did not change for k steps,
+// which detects absorbing states. The state is the hash of a StateHasher,
+// otherwise the named fields of the model, all logged fields if there are
+// none. Numbers, strings and other comparable values are compared as they
+// are, slices, maps and pointers by their JSON encoding.
+func Unchanged(k int, fields ...string) StopCondition {
+	return &unchanged{k: k, fields: fields}
+}
+
+func (c *unchanged) Start() StopCondition {
+	return &unchanged{k: c.k, fields: c.fields, since: -1}
+}
+
+func (c *unchanged) Done(s *Simulation) bool {
+	if c.state == nil {
+		c.state = modelState(s.Model, c.fields)
+	}
+	state := c.state(s)
+	if c.since < 0 || !sameState(state, c.last) {
+		c.last, c.since = state, s.Stats.Steps
+		return false
+	}
+	return s.Stats.Steps-c.since >= c.k
+}
+
+// modelState returns a function which reads the state of the model which
+// Unchanged compares
+func modelState(model Modeler, fields []string) func(s *Simulation) []interface{} {
+	if _, ok := model.(StateHasher); ok {
+		return func(s *Simulation) []interface{} {
+			return []interface{}{s.Model.(StateHasher).StateHash()}
+		}
+	}
+	names, reporters := structReporters(model, nil)
+	if len(fields) > 0 {
+		index := make(map[string]int)
+		for i, name := range names {
+			index[name] = i
+		}
+		var selected []func(interface{}) interface{}
+		for _, f := range fields {
+			i, ok := index[f]
+			if !ok {
+				panic(fmt.Sprintf("unchanged: the model has no field %s", f))
+			}
+			selected = append(selected, reporters[i])
+		}
+		reporters = selected
+	}
+	return func(s *Simulation) []interface{} {
+		state := make([]interface{}, len(reporters))
+		for i, r := range reporters {
+			v := r(s.Model)
+			if t := reflect.TypeOf(v); t != nil && (!t.Comparable() || t.Kind() == reflect.Ptr) {
+				b, err := json.Marshal(v)
+				if err != nil {
+					panic(err)
+				}
+				v = string(b)
+			}
+			state[i] = v
+		}
+		return state
+	}
+}
+
+func sameState(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *unchanged) String() string { return fmt.Sprintf("unchanged=%d", c.k) }
+
+// Run initialises the simulation if Init was not called yet, steps it
+// until one of the conditions is met and stops it. It returns the
+// condition which ended the run, it is also kept in StoppedBy.
+func (s *Simulation) Run(conds ...StopCondition) StopCondition {
+	c, _ := s.RunContext(context.Background(), conds...)
+	return c
+}
+
+// Progress describes how far a run is
+type Progress struct {
+	Steps    int
+	Events   int
+	Elapsed  time.Duration
+	Fraction float64       // from the conditions, negative if not known
+	ETA      time.Duration // estimated time until the end, 0 if not known
+	Done     bool          // the run ended
+}
+
+// progress reports the progress, the fraction is the largest fraction of
+// the conditions as the first of them ends the run
+func (s *Simulation) progress(conds []StopCondition, done bool) {
+	p := Progress{
+		Steps:    s.Stats.Steps,
+		Events:   s.Stats.Events,
+		Elapsed:  time.Since(s.started),
+		Fraction: -1,
+		Done:     done,
+	}
+	for _, c := range conds {
+		if pc, ok := c.(ProgressCondition); ok {
+			if f := pc.Fraction(s); f > p.Fraction {
+				p.Fraction = f
+			}
+		}
+	}
+	if p.Fraction > 1 {
+		p.Fraction = 1
+	}
+	if !done && p.Fraction > 0 {
+		p.ETA = time.Duration(float64(p.Elapsed) * (1 - p.Fraction) / p.Fraction)
+	}
+	s.OnProgress(p)
+}
+
+// RunContext is Run which also ends when the context is done, the
+// simulation is then stopped as usual so logs and journal are complete.
+// It returns the error of the context in this case. OnProgress is called
+// at most every ProgressInterval during the run and once at its end.
+func (s *Simulation) RunContext(ctx context.Context, conds ...StopCondition) (StopCondition, error) {
+	if len(conds) == 0 {
+		panic("Run needs at least one stop condition")
+	}
+	if s.rand == nil {
+		s.Init()
+	}
+	run := make([]StopCondition, len(conds))
+	for i, c := range conds {
+		if sc, ok := c.(StatefulCondition); ok {
+			c = sc.Start()
+		}
+		run[i] = c
+	}
+	var reported time.Time
+	for {
+		for i, c := range run {
+			if c.Done(s) {
+				s.StoppedBy = c.String()
+				if s.OnProgress != nil {
+					s.progress(run, true)
+				}
+				s.Stop()
+				return conds[i], nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			s.StoppedBy = ctx.Err().Error()
+			if s.OnProgress != nil {
+				s.progress(run, true)
+			}
+			s.Stop()
+			return nil, ctx.Err()
+		default:
+		}
+		s.Step()
+		if s.OnProgress != nil && time.Since(reported) >= s.ProgressInterval {
+			reported = time.Now()
+			s.progress(run, false)
+		}
+	}
+}
+
+// stopConditions combines the Steps and Until options of the batch
+// runners with their stop conditions
+func stopConditions(steps int, until func(s *Simulation) bool, stop []StopCondition) []StopCondition {
+	var conds []StopCondition
+	if steps > 0 {
+		conds = append(conds, MaxSteps(steps))
+	}
+	if until != nil {
+		conds = append(conds, When("until", until))
+	}
+	return append(conds, stop...)
+}
@@ -0,0 +1,316 @@
+/*
+This file is part of GoABM
+Copyright 2013 by Remo Hertig <remo.hertig@bluewin.ch>
+*/
+package goabm
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+// hashModel is a testModel which summarizes its state by a counter
+type hashModel struct {
+	testModel
+	changes uint64
+}
+
+func (m *hashModel) StateHash() uint64 { return m.changes }
+
+// sliceModel is a testModel with a field which is not comparable, the
+// fields of the embedded testModel are not logged
+type sliceModel struct {
+	testModel
+	Counts []int
+	Steps  int
+}
+
+func TestUnchanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		model  Modeler
+		fields []string
+		change func(m Modeler, step int) // changes the model before a step
+		stop   int                       // step at which the run stops
+	}{
+		{"logged fields", &testModel{}, nil, func(m Modeler, step int) {
+			if step < 3 {
+				m.(*testModel).Total = step
+			}
+		}, 5},
+		{"named field", &sliceModel{Counts: []int{0}}, []string{"Steps"}, func(m Modeler, step int) {
+			m.(*sliceModel).Counts[0] = step // not compared
+			if step < 3 {
+				m.(*sliceModel).Steps = step
+			}
+		}, 5},
+		{"state hash", &hashModel{}, nil, func(m Modeler, step int) {
+			m.(*hashModel).Total = step // not compared
+			if step < 4 {
+				m.(*hashModel).changes++
+			}
+		}, 6},
+		{"slice", &sliceModel{Counts: []int{0}}, nil, func(m Modeler, step int) {
+			if step < 3 {
+				m.(*sliceModel).Counts[0] = step // changed in place
+			}
+		}, 5},
+	}
+	for _, tt := range tests {
+		c := Unchanged(3, tt.fields...).(StatefulCondition).Start()
+		s := &Simulation{Model: tt.model}
+		for step := 0; step < 20; step++ {
+			s.Stats.Steps = step
+			tt.change(tt.model, step)
+			if c.Done(s) {
+				if step != tt.stop {
+					t.Errorf("%s: stopped at step %d, want %d", tt.name, step, tt.stop)
+				}
+				break
+			}
+			if step == 19 {
+				t.Errorf("%s: did not stop", tt.name)
+			}
+		}
+	}
+}
+
+func TestUnchangedUnknownField(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("an unknown field is accepted")
+		}
+	}()
+	c := Unchanged(1, "Missing").(StatefulCondition).Start()
+	c.Done(&Simulation{Model: &testModel{}})
+}
+
+// stopSim returns a simulation of 9 testAgents with a journal in dir
+func stopSim(dir, id string) *Simulation {
+	return &Simulation{
+		Landscape: &FixedLandscapeNoMovement{Size: 3},
+		Model:     &testModel{},
+		Seed:      1,
+		Output:    &OutputConfig{Dir: dir, RunID: id, Journal: true},
+	}
+}
+
+// journalSteps returns the steps in the journal of the simulation, it
+// fails if the journal was not flushed
+func journalSteps(t *testing.T, s *Simulation) []int {
+	t.Helper()
+	j, err := OpenJournal(s.AbstInterface.JournalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	var steps []int
+	for {
+		e, err := j.Next()
+		if err == io.EOF {
+			return steps
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", s.AbstInterface.JournalPath, err)
+		}
+		steps = append(steps, e.Step)
+	}
+}
+
+func TestStopConditions(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name          string
+		conds         []StopCondition
+		stoppedBy     string
+		steps, events int
+	}{
+		{"steps", []StopCondition{MaxSteps(4)}, "steps=4", 4, 36},
+		// the events are checked before a step, so the step which
+		// reaches them is completed
+		{"events", []StopCondition{MaxEvents(20)}, "events=20", 3, 27},
+		{"first", []StopCondition{MaxSteps(10), MaxEvents(20)}, "events=20", 3, 27},
+		{"none", []StopCondition{MaxSteps(0)}, "steps=0", 0, 0},
+		{"when", []StopCondition{MaxSteps(10), When("five", func(s *Simulation) bool { return s.Stats.Steps == 5 })}, "five", 5, 45},
+	}
+	for _, tt := range tests {
+		s := stopSim(dir, tt.name)
+		c := s.Run(tt.conds...)
+		if c == nil || c.String() != tt.stoppedBy || s.StoppedBy != tt.stoppedBy {
+			t.Errorf("%s: stopped by %v and %q, want %q", tt.name, c, s.StoppedBy, tt.stoppedBy)
+		}
+		if s.Stats.Steps != tt.steps || s.Stats.Events != tt.events {
+			t.Errorf("%s: %d steps and %d events, want %d and %d", tt.name, s.Stats.Steps, s.Stats.Events, tt.steps, tt.events)
+		}
+		if n := len(journalSteps(t, s)); n != tt.steps {
+			t.Errorf("%s: %d steps in the journal, want %d", tt.name, n, tt.steps)
+		}
+	}
+}
+
+func TestWallClock(t *testing.T) {
+	s := stopSim(t.TempDir(), "wallclock")
+	start := time.Now()
+	c := s.Run(MaxSteps(1<<30), WallClock(20*time.Millisecond))
+	if c.String() != "wallclock=20ms" || s.StoppedBy != "wallclock=20ms" {
+		t.Errorf("stopped by %v and %q", c, s.StoppedBy)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond || s.Stats.Steps == 0 {
+		t.Errorf("stopped after %v and %d steps", d, s.Stats.Steps)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := stopSim(dir, "cancel")
+	// the context is canceled after three steps, during the checks of the
+	// conditions
+	cancelAt := When("cancel", func(s *Simulation) bool {
+		if s.Stats.Steps == 3 {
+			cancel()
+		}
+		return false
+	})
+	c, err := s.RunContext(ctx, MaxSteps(10), cancelAt)
+	if c != nil || err != context.Canceled || s.StoppedBy != context.Canceled.Error() {
+		t.Errorf("got %v, %v and stopped by %q, want the cancellation", c, err, s.StoppedBy)
+	}
+	if s.Stats.Steps != 3 {
+		t.Errorf("%d steps, want 3", s.Stats.Steps)
+	}
+	// the run was stopped, so the journal is complete
+	if steps := journalSteps(t, s); len(steps) != 3 || steps[2] != 3 {
+		t.Errorf("the journal has the steps %v, want 1 to 3", steps)
+	}
+	if r := s.record(); r.StoppedBy != context.Canceled.Error() {
+		t.Errorf("the run record is stopped by %q", r.StoppedBy)
+	}
+
+	// a context which is already done ends the run before the first step
+	s = stopSim(dir, "done")
+	if _, err := s.RunContext(ctx, MaxSteps(10)); err != context.Canceled || s.Stats.Steps != 0 {
+		t.Errorf("got %v after %d steps", err, s.Stats.Steps)
+	}
+	if steps := journalSteps(t, s); len(steps) != 0 {
+		t.Errorf("the journal has the steps %v", steps)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	s = stopSim(dir, "timeout")
+	if _, err := s.RunContext(ctx, MaxSteps(1<<30)); err != context.DeadlineExceeded || s.StoppedBy != err.Error() {
+		t.Errorf("got %v and stopped by %q, want the deadline", err, s.StoppedBy)
+	}
+	if steps := journalSteps(t, s); len(steps) != s.Stats.Steps {
+		t.Errorf("%d steps in the journal of %d", len(steps), s.Stats.Steps)
+	}
+}
+
+func TestRunWithoutConditions(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("a run without a stop condition is started")
+		}
+	}()
+	(&Simulation{}).Run()
+}
+
+func TestProgressFraction(t *testing.T) {
+	for _, tt := range []struct {
+		c     StopCondition
+		stats Statistics
+		want  float64
+	}{
+		{MaxSteps(4), Statistics{Steps: 1}, 0.25},
+		{MaxSteps(4), Statistics{Steps: 6}, 1.5}, // progress caps it at 1
+		{MaxEvents(10), Statistics{Steps: 9, Events: 5}, 0.5},
+		{When("never", func(*Simulation) bool { return false }), Statistics{Steps: 3}, -1},
+	} {
+		if f := tt.c.(ProgressCondition).Fraction(&Simulation{Stats: tt.stats}); f != tt.want {
+			t.Errorf("%s at %+v: %v, want %v", tt.c, tt.stats, f, tt.want)
+		}
+	}
+}
+
+// runProgress runs a simulation of 9 testAgents without outputs and
+// returns the reported progress
+func runProgress(interval time.Duration, conds ...StopCondition) []Progress {
+	var reports []Progress
+	s := &Simulation{
+		Landscape:        &FixedLandscapeNoMovement{Size: 3},
+		Model:            &testModel{},
+		Seed:             1,
+		ProgressInterval: interval,
+		OnProgress:       func(p Progress) { reports = append(reports, p) },
+	}
+	s.AbstInterface.NoOutput = true
+	s.Run(conds...)
+	return reports
+}
+
+func TestProgress(t *testing.T) {
+	// every step and once at the end
+	reports := runProgress(0, MaxSteps(10))
+	if len(reports) != 11 {
+		t.Fatalf("%d reports, want 11", len(reports))
+	}
+	for i, p := range reports[:10] {
+		f := float64(i+1) / 10
+		if p.Steps != i+1 || p.Events != 9*(i+1) || p.Fraction != f || p.Done {
+			t.Errorf("report %d: %+v, want %d steps and the fraction %v", i, p, i+1, f)
+		}
+		// the remaining steps take as long as the ones so far
+		if eta := time.Duration(float64(p.Elapsed) * (1 - f) / f); p.ETA != eta {
+			t.Errorf("report %d: the ETA is %v, want %v", i, p.ETA, eta)
+		}
+	}
+	if p := reports[10]; !p.Done || p.Steps != 10 || p.Fraction != 1 || p.ETA != 0 {
+		t.Errorf("the last report is %+v", p)
+	}
+
+	// the largest fraction of the conditions, 9 events per step
+	reports = runProgress(0, MaxSteps(10), MaxEvents(45))
+	if p := reports[1]; p.Fraction != 0.4 {
+		t.Errorf("the fraction after 2 steps is %v, want 0.4", p.Fraction)
+	}
+	if p := reports[len(reports)-1]; !p.Done || p.Steps != 5 || p.Fraction != 1 {
+		t.Errorf("the last report is %+v", p)
+	}
+
+	// unknown without a progress condition
+	reports = runProgress(0, When("five", func(s *Simulation) bool { return s.Stats.Steps == 5 }))
+	for _, p := range reports {
+		if p.Fraction != -1 || p.ETA != 0 {
+			t.Errorf("got the fraction %v and ETA %v without a progress condition", p.Fraction, p.ETA)
+		}
+	}
+}
+
+func TestProgressInterval(t *testing.T) {
+	// the first step is reported, then not before the interval passed
+	reports := runProgress(time.Hour, MaxSteps(50))
+	if len(reports) != 2 || reports[0].Steps != 1 || reports[1].Steps != 50 || !reports[1].Done {
+		t.Errorf("got the reports %+v, want steps 1 and 50", reports)
+	}
+
+	// a step takes at least 2ms, so there are at most 20ms/10ms+1 reports
+	// of the first 10 steps
+	slow := When("slow", func(s *Simulation) bool {
+		time.Sleep(2 * time.Millisecond)
+		return false
+	})
+	reports = runProgress(10*time.Millisecond, MaxSteps(10), slow)
+	if len(reports) < 2 || len(reports) > 5 {
+		t.Errorf("%d reports of 10 steps, want 2 to 5", len(reports))
+	}
+	// Elapsed is measured just after the time of a report is taken
+	for i := 1; i < len(reports)-1; i++ {
+		if d := reports[i].Elapsed - reports[i-1].Elapsed; d < 9*time.Millisecond {
+			t.Errorf("report %d came %v after the previous one", i, d)
+		}
+	}
+}